@@ -5,6 +5,7 @@ import API_BASE_URL from '../config';
 import { useUI } from '../context/UIContext';
 import { useAuth } from '../context/AuthContext';
 import { printQRCode } from '../utils/print';
+import { uploadSrc } from '../utils/upload';
 
 function CreateOrder() {
     const { fetchWithAuth } = useAuth();
@@ -110,7 +111,7 @@ function CreateOrder() {
             if (data.url) {
                 return data.url;
             } else {
-                toast.error('图片上传失败');
+                toast.error(data.error || '图片上传失败');
                 return null;
             }
         } catch (err) {
@@ -351,7 +352,7 @@ function CreateOrder() {
         const payload = {
             ...formData,
             amount: totalAmount,
-            attachments: JSON.stringify(attachments),
+            attachment_urls: attachments,
             items: orderItems.map(({ product_name, total_price, extra_attrs, extra_attrs_json, ...rest }) => ({
                 ...rest,
                 extra_attrs: extra_attrs_json || JSON.stringify(extra_attrs || {})
@@ -737,7 +738,7 @@ function CreateOrder() {
                             <p className="text-gray-500 text-sm">
                                 点击上传图片，或 <span className="font-bold text-black">Ctrl+V 粘贴</span> 图片
                             </p>
-                            <p className="text-gray-400 text-xs mt-1">支持 JPG、PNG 格式</p>
+                            <p className="text-gray-400 text-xs mt-1">支持 JPG、PNG、GIF、WebP 格式</p>
                         </label>
                         {uploadingImage && (
                             <div className="mt-2 text-blue-500 text-sm">上传中...</div>
@@ -750,7 +751,7 @@ function CreateOrder() {
                             {attachments.map((url, index) => (
                                 <div key={index} className="relative group">
                                     <img
-                                        src={url.startsWith('http') ? url : `${IMAGE_BASE_URL}${url}`}
+                                        src={uploadSrc(url, IMAGE_BASE_URL)}
                                         alt={`附件 ${index + 1}`}
                                         className="w-full h-24 object-cover rounded border border-gray-200"
                                     />
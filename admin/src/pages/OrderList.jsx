@@ -3,8 +3,9 @@ import React, { useEffect, useState } from 'react';
 import API_BASE_URL from '../config';
 import { Link } from 'react-router-dom';
 import { useUI } from '../context/UIContext';
-import { printQRCode, printInvoice } from '../utils/print';
+import { printQRCode, printInvoice, attachmentUrls } from '../utils/print';
 import { useAuth } from '../context/AuthContext';
+import { uploadSrc } from '../utils/upload';
 
 function OrderList() {
     const { fetchWithAuth } = useAuth();
@@ -220,15 +221,7 @@ function OrderList() {
         setEditingItemIndex(-1);
         
         // 初始化附件
-        let attachments = [];
-        if (order.attachments) {
-            try {
-                attachments = JSON.parse(order.attachments);
-            } catch (e) {
-                console.error('Failed to parse attachments:', e);
-            }
-        }
-        setEditAttachments(attachments);
+        setEditAttachments(attachmentUrls(order.attachments));
         
         setIsEditModalOpen(true);
     };
@@ -253,7 +246,7 @@ function OrderList() {
             if (data.url) {
                 return data.url;
             } else {
-                toast.error('图片上传失败');
+                toast.error(data.error || '图片上传失败');
                 return null;
             }
         } catch (err) {
@@ -518,7 +511,8 @@ function OrderList() {
             address: editingOrder.address,
             amount: editTotalAmount,
             remark: editingOrder.remark,
-            attachments: JSON.stringify(editAttachments),
+            // 未加载到附件列表时不提交，避免误删订单已有附件
+            attachment_urls: Array.isArray(editingOrder.attachments) ? editAttachments : undefined,
             items: editOrderItems.map(({ id, product_name, total_price, extra_attrs, ...rest }) => ({
                 ...rest,
                 extra_attrs: JSON.stringify(extra_attrs || {})
@@ -1214,7 +1208,7 @@ function OrderList() {
                                         {editAttachments.map((url, index) => (
                                             <div key={index} className="relative group">
                                                 <img
-                                                    src={url.startsWith('http') ? url : `${IMAGE_BASE_URL}${url}`}
+                                                    src={uploadSrc(url, IMAGE_BASE_URL)}
                                                     alt={`附件 ${index + 1}`}
                                                     className="w-full h-16 object-cover rounded border border-gray-200"
                                                 />
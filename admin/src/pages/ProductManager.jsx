@@ -2,6 +2,7 @@ import React, { useState, useEffect } from 'react';
 import API_BASE_URL from '../config';
 import { useUI } from '../context/UIContext';
 import { useAuth } from '../context/AuthContext';
+import { uploadSrc } from '../utils/upload';
 
 function ProductManager() {
     const { fetchWithAuth } = useAuth();
@@ -263,7 +264,7 @@ function ProductManager() {
                     setEditingProduct({ ...editingProduct, image: data.url });
                     toast.success('图片上传成功');
                 } else {
-                    toast.error('图片上传失败');
+                    toast.error(data.error || '图片上传失败');
                 }
             })
             .catch(err => {
@@ -343,7 +344,7 @@ function ProductManager() {
                                 />
                                 {prod.image ? (
                                     <img
-                                        src={prod.image.startsWith('http') ? prod.image : `${IMAGE_BASE_URL}${prod.image}`}
+                                        src={uploadSrc(prod.image, IMAGE_BASE_URL)}
                                         alt={prod.name}
                                         className="w-10 h-10 object-cover rounded border border-gray-100"
                                     />
@@ -555,7 +556,7 @@ function ProductManager() {
                                     <div className="w-16 h-16 bg-gray-100 rounded border border-gray-200 flex items-center justify-center overflow-hidden">
                                         {editingProduct.image ? (
                                             <img
-                                                src={editingProduct.image.startsWith('http') ? editingProduct.image : `${IMAGE_BASE_URL}${editingProduct.image}`}
+                                                src={uploadSrc(editingProduct.image, IMAGE_BASE_URL)}
                                                 alt="Preview"
                                                 className="w-full h-full object-cover"
                                             />
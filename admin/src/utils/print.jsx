@@ -1,6 +1,7 @@
 import React from 'react';
 import { QRCodeSVG } from 'qrcode.react';
 import { renderToStaticMarkup } from 'react-dom/server';
+import { uploadSrc } from './upload';
 
 /**
  * 格式化日期为 YYYY-MM-DD 格式
@@ -154,10 +155,30 @@ const parseExtraAttrs = (extraAttrsStr) => {
     }
 };
 
+/**
+ * 订单附件列表转为图片URL数组（兼容旧版 JSON 字符串格式）
+ */
+export const attachmentUrls = (attachments) => {
+    if (!attachments) return [];
+    if (Array.isArray(attachments)) return attachments.map(a => a.url);
+    try {
+        return JSON.parse(attachments);
+    } catch {
+        return [];
+    }
+};
+
 /**
  * 打印销货清单（完整版，用于发货）
  */
-export const printInvoice = (order) => {
+export const printInvoice = (order, options = {}) => {
+    const {
+        title = '销货清单',
+        subtitle = '(代合同)',
+        noLabel = '订单号',
+        validUntil = null,
+    } = options;
+
     const printWindow = window.open('', '_blank', 'width=800,height=900');
     if (!printWindow) {
         alert('请允许弹出窗口以打印');
@@ -246,15 +267,17 @@ export const printInvoice = (order) => {
     // 金额大写转换
     const amountChinese = numberToChinese(order.amount || 0);
 
+    // 折扣信息（行折扣合计 + 整单折扣）
+    const lineDiscount = products.reduce((sum, op) => sum + (op.discount || 0), 0);
+    const discountRow = (lineDiscount > 0 || order.discount > 0) ? `
+            <div class="total-row" style="border-bottom: none; font-weight: normal;">
+                <span>${lineDiscount > 0 ? `明细优惠：¥ ${lineDiscount.toFixed(2)}` : ''}</span>
+                <span>${order.discount > 0 ? `整单优惠${order.discount_type === 'percent' ? `(${order.discount_value}%)` : ''}：-¥ ${order.discount.toFixed(2)}　合计：¥ ${(order.subtotal || 0).toFixed(2)}` : ''}</span>
+            </div>
+    ` : '';
+
     // 解析附件
-    let attachments = [];
-    if (order.attachments) {
-        try {
-            attachments = JSON.parse(order.attachments);
-        } catch {
-            attachments = [];
-        }
-    }
+    const attachments = attachmentUrls(order.attachments);
 
     // 生成附件图片HTML
     // 使用完整URL确保在打印窗口中能正确加载
@@ -264,7 +287,7 @@ export const printInvoice = (order) => {
             <div class="attachments-title">附件图片</div>
             <div class="attachments-grid">
                 ${attachments.map((url, index) => {
-                    const fullUrl = url.startsWith('http') ? url : baseUrl + url;
+                    const fullUrl = uploadSrc(url, baseUrl);
                     return `<img src="${fullUrl}" alt="附件${index + 1}" onclick="showImage('${fullUrl}')" onerror="this.style.display='none'" />`;
                 }).join('')}
             </div>
@@ -279,7 +302,7 @@ export const printInvoice = (order) => {
         <!DOCTYPE html>
         <html>
         <head>
-            <title>销货清单 - ${order.customer_name}</title>
+            <title>${title} - ${order.customer_name}</title>
             <meta charset="utf-8">
             <style>
                 * { margin: 0; padding: 0; box-sizing: border-box; }
@@ -448,7 +471,7 @@ export const printInvoice = (order) => {
             </style>
         </head>
         <body>
-            <div class="title">销货清单<span style="font-size: 14px; color: #666;">(代合同)</span></div>
+            <div class="title">${title}<span style="font-size: 14px; color: #666;">${subtitle}</span></div>
             <div class="subtitle">旭日盛唐全国运营中心（青岛榻榻米垫工厂）</div>
 
             <div class="header-info">
@@ -457,7 +480,8 @@ export const printInvoice = (order) => {
                     <span>客户：${order.customer_name}</span>
                 </div>
                 <div class="header-right">
-                    <span>订单号：${order.order_no || order.ID}</span>
+                    <span>${noLabel}：${order.order_no || order.ID}</span>
+                    ${validUntil ? `<span>有效期至：${formatDate(validUntil)}</span>` : ''}
                 </div>
             </div>
             <div class="header-info" style="border-bottom: none;">
@@ -484,6 +508,7 @@ export const printInvoice = (order) => {
                 </tbody>
             </table>
 
+            ${discountRow}
             <div class="total-row">
                 <span>大写：${amountChinese}</span>
                 <span>小写：¥ ${(order.amount || 0).toFixed(2)}</span>
@@ -648,5 +673,22 @@ function numberToChinese(num) {
     return result;
 }
 
+/**
+ * 打印报价单（复用销货清单版式）
+ */
+export const printQuotation = (quotation) => printInvoice(
+    {
+        ...quotation,
+        order_no: quotation.quote_no,
+        order_products: quotation.items || [],
+    },
+    {
+        title: '报价单',
+        subtitle: '',
+        noLabel: '报价单号',
+        validUntil: quotation.valid_until,
+    }
+);
+
 // 保留旧的 printOrder 函数作为兼容（内部调用 printQRCode）
 export const printOrder = printQRCode;
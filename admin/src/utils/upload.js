@@ -0,0 +1,8 @@
+// 上传文件地址（/uploads/...）转为可直接用于 <img> 的地址。
+// 服务端开启签名访问或使用对象存储时 /uploads 需要登录，<img> 无法带请求头，令牌放在 token 参数中。
+export const uploadSrc = (url, base = '') => {
+    if (!url || url.startsWith('http') || url.startsWith('data:')) return url;
+    const token = localStorage.getItem('token');
+    if (!token || !url.startsWith('/uploads/')) return base + url;
+    return `${base}${url}${url.includes('?') ? '&' : '?'}token=${encodeURIComponent(token)}`;
+};
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"trace-server/config"
+	"trace-server/database"
+	"trace-server/handlers"
+	"trace-server/storage"
+)
+
+// runCommand 执行命令行子命令
+func runCommand(args []string) {
+	switch args[0] {
+	case "migrate-storage":
+		migrateStorage(args[1:])
+	case "import-orders":
+		importOrders(args[1:])
+	case "drop-legacy-attachments":
+		dropLegacyAttachments()
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+		fmt.Fprintln(os.Stderr, "commands:")
+		fmt.Fprintln(os.Stderr, "  migrate-storage  在存储后端之间迁移上传文件")
+		fmt.Fprintln(os.Stderr, "  import-orders    从销货清单 xlsx/csv 导入订单")
+		fmt.Fprintln(os.Stderr, "  drop-legacy-attachments  删除已迁移到附件表的旧附件字段")
+		os.Exit(2)
+	}
+}
+
+// migrateStorage 将上传文件从一个存储后端复制到另一个，两个后端的参数均取自配置文件 storage 段
+func migrateStorage(args []string) {
+	fs := flag.NewFlagSet("migrate-storage", flag.ExitOnError)
+	from := fs.String("from", storage.DriverLocal, "源存储: local 或 s3")
+	to := fs.String("to", storage.DriverS3, "目标存储: local 或 s3")
+	removeSource := fs.Bool("delete", false, "复制成功后删除源文件")
+	dryRun := fs.Bool("dry-run", false, "只统计需要迁移的文件，不复制")
+	fs.Parse(args)
+
+	if *from == *to {
+		log.Fatal("源存储和目标存储相同")
+	}
+	if _, err := config.LoadConfig(); err != nil {
+		log.Fatal("Failed to load config:", err)
+	}
+	src, err := storage.New(*from)
+	if err != nil {
+		log.Fatal("Failed to init source storage:", err)
+	}
+	dst, err := storage.New(*to)
+	if err != nil {
+		log.Fatal("Failed to init target storage:", err)
+	}
+
+	result, err := storage.Migrate(context.Background(), src, dst, *removeSource, *dryRun)
+	if err != nil {
+		log.Fatal("Migration failed:", err)
+	}
+	action := "Copied"
+	if *dryRun {
+		action = "To copy"
+	}
+	fmt.Printf("%s: %d files (%d bytes), skipped: %d, failed: %d\n", action, result.Copied, result.Bytes, result.Skipped, result.Failed)
+	if result.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// importOrders 从销货清单导入订单，规则与后台导入相同
+func importOrders(args []string) {
+	fs := flag.NewFlagSet("import-orders", flag.ExitOnError)
+	path := fs.String("file", "", "销货清单文件 (.xlsx 或 .csv)")
+	dryRun := fs.Bool("dry-run", false, "只解析和校验，不写入数据库")
+	fs.Parse(args)
+
+	if *path == "" {
+		log.Fatal("请用 -file 指定文件")
+	}
+	f, err := os.Open(*path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	database.Connect()
+	result, err := handlers.ImportOrdersFrom(f, *path, *dryRun)
+	if err != nil {
+		log.Fatal("Import failed:", err)
+	}
+
+	for _, o := range result.Orders {
+		status := "OK"
+		switch {
+		case len(o.Errors) > 0:
+			status = "ERROR"
+		case o.OrderNo != "":
+			status = o.OrderNo
+		}
+		fmt.Printf("[%s] %s 第%d行 %s %s %d项 ¥%.2f\n", status, o.Sheet, o.Row, o.CustomerName, o.Phone, len(o.Items), o.Amount)
+		for _, e := range o.Errors {
+			fmt.Printf("    错误: %s\n", e)
+		}
+		for _, w := range o.Warnings {
+			fmt.Printf("    提示: %s\n", w)
+		}
+	}
+	fmt.Printf("Orders: %d, valid: %d, created: %d, failed: %d, amount: %.2f\n",
+		result.Total, result.Valid, result.Created, result.Failed, result.Amount)
+	if result.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// dropLegacyAttachments 确认附件迁移无误后删除旧的附件字段
+func dropLegacyAttachments() {
+	database.Connect()
+	if err := database.DropLegacyAttachmentColumns(); err != nil {
+		log.Fatal("Failed to drop legacy attachment columns:", err)
+	}
+}
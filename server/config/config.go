@@ -16,8 +16,49 @@ type Config struct {
 		DBName   string `yaml:"dbname"`
 		Charset  string `yaml:"charset"`
 	} `yaml:"database"`
+	Recycle struct {
+		RetentionDays int `yaml:"retention_days"` // 已删除订单保留天数，超过后可永久清除
+	} `yaml:"recycle"`
+	Upload struct {
+		MaxSizeMB      int   `yaml:"max_size_mb"`     // 单个上传文件大小上限 (MB)，默认 10
+		ThumbnailSizes []int `yaml:"thumbnail_sizes"` // 图片缩略图最长边 (像素)，默认 200、800
+	} `yaml:"upload"`
+	Storage struct {
+		Driver           string `yaml:"driver"`             // local（默认）或 s3
+		LocalDir         string `yaml:"local_dir"`          // 本地存储目录，默认 ./uploads
+		SignSecret       string `yaml:"sign_secret"`        // 本地存储签名链接密钥
+		RequireSigned    bool   `yaml:"require_signed"`     // 访问 /uploads 是否必须带签名
+		SignedURLMinutes int    `yaml:"signed_url_minutes"` // 签名链接有效期，默认 10 分钟
+		S3               struct {
+			Endpoint  string `yaml:"endpoint"`
+			Region    string `yaml:"region"`
+			Bucket    string `yaml:"bucket"`
+			AccessKey string `yaml:"access_key"`
+			SecretKey string `yaml:"secret_key"`
+			UseSSL    bool   `yaml:"use_ssl"`
+			Prefix    string `yaml:"prefix"`
+		} `yaml:"s3"`
+	} `yaml:"storage"`
+	PDF struct {
+		FontPath    string   `yaml:"font_path"`    // 中文 TTF 字体，如 ./fonts/simhei.ttf
+		CompanyName string   `yaml:"company_name"` // 销货清单抬头
+		Contact     string   `yaml:"contact"`      // 页脚联系方式
+		Notes       []string `yaml:"notes"`        // 销货清单注意事项
+	} `yaml:"pdf"`
+	Scanner struct {
+		SilentMinutes int    `yaml:"silent_minutes"` // 工作时间内工位扫码枪多久没有扫码视为静默，默认 30
+		WorkStart     string `yaml:"work_start"`     // 未设置默认班次时的上班时间，默认 08:00
+		WorkEnd       string `yaml:"work_end"`       // 未设置默认班次时的下班时间，默认 18:00
+	} `yaml:"scanner"`
+	WIP struct {
+		MaxQueue     int     `yaml:"max_queue"`      // 工位前排队订单数超过该值标记，默认 20；工位可单独设置
+		MaxWaitHours float64 `yaml:"max_wait_hours"` // 平均等待超过该小时数标记，默认 24；工位可单独设置
+	} `yaml:"wip"`
 }
 
+// Current 当前加载的配置，供各模块读取
+var Current = &Config{}
+
 func LoadConfig() (*Config, error) {
 	// Priority 1: Production path / Config Volume
 	paths := []string{
@@ -50,6 +91,7 @@ func LoadConfig() (*Config, error) {
 	if err := decoder.Decode(&config); err != nil {
 		return nil, err
 	}
+	Current = &config
 
 	return &config, nil
 }
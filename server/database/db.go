@@ -1,8 +1,13 @@
 package database
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
 	"trace-server/config"
 	"trace-server/models"
 
@@ -56,6 +61,16 @@ func Connect() {
 		}
 	}
 
+	// order_no 增加唯一索引前，为历史重复订单号追加订单ID
+	if DB.Migrator().HasTable("orders") && !DB.Migrator().HasIndex(&models.Order{}, "OrderNo") {
+		result := DB.Exec(`UPDATE orders o
+			JOIN (SELECT order_no FROM orders GROUP BY order_no HAVING COUNT(*) > 1) d ON o.order_no = d.order_no
+			SET o.order_no = CONCAT(o.order_no, '-', o.id)`)
+		if result.RowsAffected > 0 {
+			log.Printf("Renamed %d orders with duplicate order_no\n", result.RowsAffected)
+		}
+	}
+
 	err = DB.AutoMigrate(
 		&models.User{},
 		&models.Worker{},
@@ -66,13 +81,168 @@ func Connect() {
 		&models.OrderProduct{},
 		&models.Customer{},
 		&models.ScanLog{},
+		&models.PriceList{},
+		&models.PriceListItem{},
+		&models.Quotation{},
+		&models.QuotationItem{},
+		&models.Payment{},
+		&models.Sequence{},
+		&models.SequenceCounter{},
+		&models.OrderTemplate{},
+		&models.OrderTemplateItem{},
+		&models.DeliveryBatch{},
+		&models.DeliveryStop{},
+		&models.AfterSaleTicket{},
+		&models.AfterSaleItem{},
+		&models.Attachment{},
+		&models.Printer{},
+		&models.PrintJob{},
+		&models.PieceRate{},
+		&models.PayrollPeriod{},
+		&models.PayrollLine{},
+		&models.PayrollAdjustment{},
+		&models.Shift{},
+		&models.Attendance{},
+		&models.WorkerStation{},
+		&models.ScannerDevice{},
+		&models.Station{},
+		&models.ScannerAlert{},
 	)
 	if err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 
+	ensureFulltextIndexes()
+	migrateLegacyAttachments()
+
 	// 初始化默认产品
 	seedProducts()
+	seedSequences()
+	backfillCompletedPayments()
+	backfillStatusChangedAt()
+	seedStations()
+	migrateStationNames()
+	seedScannerDevices()
+}
+
+// 全文索引（ngram 分词，支持中文）；列与 handlers/search.go 中的 MATCH 子句一致
+var fulltextIndexes = []struct {
+	Table   string
+	Name    string
+	Columns string
+}{
+	{"orders", "ft_orders_search", "order_no, customer_name, phone, address, specs, remark"},
+	{"order_products", "ft_order_products_attrs", "extra_attrs"},
+	{"customers", "ft_customers_search", "name, phone, address, remark"},
+	{"products", "ft_products_search", "name, code"},
+}
+
+// ensureFulltextIndexes 创建统一搜索使用的全文索引
+func ensureFulltextIndexes() {
+	for _, idx := range fulltextIndexes {
+		var count int64
+		DB.Raw("SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = ? AND index_name = ?",
+			idx.Table, idx.Name).Scan(&count)
+		if count > 0 {
+			continue
+		}
+		sql := fmt.Sprintf("ALTER TABLE %s ADD FULLTEXT INDEX %s (%s) WITH PARSER ngram", idx.Table, idx.Name, idx.Columns)
+		if err := DB.Exec(sql).Error; err != nil {
+			log.Printf("Failed to create fulltext index %s: %v\n", idx.Name, err)
+		}
+	}
+}
+
+// 旧版以 JSON 数组字符串保存附件URL的字段
+var legacyAttachmentColumns = []struct {
+	Table     string
+	Column    string
+	OwnerType string
+}{
+	{"orders", "attachments", models.AttachmentOwnerOrder},
+	{"after_sale_tickets", "photos", models.AttachmentOwnerAfterSale},
+}
+
+// 迁移旧附件字段时记录的上传人，用于判断是否已迁移
+const legacyAttachmentUploader = "旧附件迁移"
+
+// migrateLegacyAttachments 将旧的附件字段复制到附件表。旧字段保留不删，
+// 确认迁移无误后用 drop-legacy-attachments 命令删除；已迁移过的表不再重复复制。
+func migrateLegacyAttachments() {
+	for _, legacy := range legacyAttachmentColumns {
+		if !DB.Migrator().HasColumn(legacy.Table, legacy.Column) {
+			continue
+		}
+		var migrated int64
+		DB.Unscoped().Model(&models.Attachment{}).
+			Where("owner_type = ? AND uploader = ?", legacy.OwnerType, legacyAttachmentUploader).
+			Count(&migrated)
+		if migrated > 0 {
+			continue
+		}
+
+		var rows []struct {
+			ID   uint
+			URLs string `gorm:"column:urls"`
+		}
+		DB.Raw(fmt.Sprintf("SELECT id, %s AS urls FROM %s WHERE %s IS NOT NULL AND %s <> ''",
+			legacy.Column, legacy.Table, legacy.Column, legacy.Column)).Scan(&rows)
+		if len(rows) == 0 {
+			continue
+		}
+
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			for _, row := range rows {
+				var urls []string
+				if err := json.Unmarshal([]byte(row.URLs), &urls); err != nil {
+					log.Printf("Skip invalid %s.%s of id %d: %v\n", legacy.Table, legacy.Column, row.ID, err)
+					continue
+				}
+				for i, url := range urls {
+					if !strings.HasPrefix(url, "/uploads/") {
+						continue
+					}
+					name := filepath.Base(url)
+					att := models.Attachment{
+						OwnerType: legacy.OwnerType,
+						OwnerID:   row.ID,
+						FileName:  name,
+						Path:      name,
+						URL:       "/uploads/" + name,
+						MimeType:  mime.TypeByExtension(filepath.Ext(name)),
+						SortOrder: i,
+						Uploader:  legacyAttachmentUploader,
+					}
+					if info, err := os.Stat(filepath.Join("./uploads", name)); err == nil {
+						att.Size = info.Size()
+					}
+					if err := tx.Create(&att).Error; err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("Failed to migrate %s.%s: %v\n", legacy.Table, legacy.Column, err)
+			continue
+		}
+		log.Printf("Copied %d rows of %s.%s to attachments, the old column is kept\n", len(rows), legacy.Table, legacy.Column)
+	}
+}
+
+// DropLegacyAttachmentColumns 删除已迁移到附件表的旧附件字段（不可恢复，由命令行显式执行）
+func DropLegacyAttachmentColumns() error {
+	for _, legacy := range legacyAttachmentColumns {
+		if !DB.Migrator().HasColumn(legacy.Table, legacy.Column) {
+			continue
+		}
+		if err := DB.Exec(fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", legacy.Table, legacy.Column)).Error; err != nil {
+			return fmt.Errorf("drop %s.%s: %w", legacy.Table, legacy.Column, err)
+		}
+		log.Printf("Dropped %s.%s\n", legacy.Table, legacy.Column)
+	}
+	return nil
 }
 
 // seedProducts 初始化默认产品
@@ -93,3 +263,185 @@ func seedProducts() {
 		}
 	}
 }
+
+// seedSequences 初始化默认编号规则
+func seedSequences() {
+	defaultSequences := []models.Sequence{
+		{Name: models.SequenceOrder, Pattern: "TT{YY}{MM}-{SEQ}", Padding: 4, Reset: models.SequenceResetMonth},
+		{Name: models.SequenceQuotation, Pattern: "QT{YY}{MM}{DD}-{SEQ}", Padding: 3, Reset: models.SequenceResetDay},
+		{Name: models.SequenceDelivery, Pattern: "PS{YY}{MM}{DD}-{SEQ}", Padding: 2, Reset: models.SequenceResetDay},
+		{Name: models.SequenceAfterSale, Pattern: "AS{YY}{MM}-{SEQ}", Padding: 3, Reset: models.SequenceResetMonth},
+	}
+
+	for _, seq := range defaultSequences {
+		var existing models.Sequence
+		if err := DB.Where("name = ?", seq.Name).First(&existing).Error; err != nil {
+			DB.Create(&seq)
+		}
+	}
+}
+
+// backfillStatusChangedAt 补齐旧订单进入当前状态的时间：取最后一次工序时间；没有工序时待下料订单取下单时间，
+// 其他状态为手动修改，取最后修改时间。只处理未记录的订单，可重复执行
+func backfillStatusChangedAt() {
+	err := DB.Exec(`UPDATE orders SET status_changed_at = COALESCE(
+		(SELECT MAX(p.created_at) FROM processes p WHERE p.order_id = orders.id),
+		CASE WHEN status = ? THEN created_at ELSE updated_at END)
+		WHERE status_changed_at IS NULL`, "待下料").Error
+	if err != nil {
+		log.Printf("Failed to backfill order status times: %v\n", err)
+	}
+}
+
+// backfillCompletedPayments 收款功能上线前已完成的订单没有收款记录，按订单金额补录一笔收款，
+// 避免在应收账龄和客户余额中显示为未收。只处理早于第一笔收款记录的订单，可重复执行。
+func backfillCompletedPayments() {
+	query := DB.Model(&models.Order{}).
+		Where("status = ? AND amount > 0 AND paid_amount = 0", "已完成").
+		Where("id NOT IN (?)", DB.Unscoped().Model(&models.Payment{}).Select("order_id"))
+	var first models.Payment
+	if DB.Unscoped().Order("created_at asc").First(&first).Error == nil {
+		query = query.Where("updated_at < ?", first.CreatedAt)
+	}
+	var orders []models.Order
+	query.Select("id, customer_id, amount, updated_at").Find(&orders)
+	if len(orders) == 0 {
+		return
+	}
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		for _, o := range orders {
+			payment := models.Payment{
+				OrderID:    o.ID,
+				CustomerID: o.CustomerID,
+				Type:       models.PaymentNormal,
+				Method:     models.PayMethodOther,
+				Amount:     o.Amount,
+				PaidAt:     o.UpdatedAt,
+				Operator:   "系统",
+				Remark:     "历史已完成订单补录",
+			}
+			if err := tx.Create(&payment).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&models.Order{}).Where("id = ?", o.ID).UpdateColumn("paid_amount", o.Amount).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to backfill payments of completed orders: %v\n", err)
+		return
+	}
+	log.Printf("Backfilled payments for %d completed orders\n", len(orders))
+}
+
+// seedStations 初始化默认工位（工位表为空时）
+func seedStations() {
+	var count int64
+	DB.Model(&models.Station{}).Count(&count)
+	if count > 0 {
+		return
+	}
+	defaultStations := []models.Station{
+		{Code: "XL", Name: "下料", SortOrder: 1},
+		{Code: "CM", Name: "裁面", SortOrder: 2},
+		{Code: "FM", Name: "封面", SortOrder: 3},
+		{Code: "SH", Name: "送货", Aliases: "运货", SortOrder: 4},
+		{Code: "SK", Name: "收款", SortOrder: 5},
+	}
+	DB.Create(&defaultStations)
+}
+
+// StationNameTable 以工位名记录工位的表；HasID 表示同时保存 station_id
+type StationNameTable struct {
+	Name  string
+	HasID bool
+}
+
+// StationNameTables 所有保存工位名的表：工位改名时全部同步，启动时为带 station_id 的表补关联
+var StationNameTables = []StationNameTable{
+	{"workers", true},
+	{"worker_stations", true},
+	{"scanner_devices", true},
+	{"processes", true},
+	{"scan_logs", true},
+	{"piece_rates", false},
+	{"printers", false},
+	{"scanner_alerts", false},
+	{"payroll_lines", false},
+}
+
+// migrateStationNames 将旧记录中的工位名关联到工位表，别名统一为工位名；工位表中没有的名称自动新建工位
+func migrateStationNames() {
+	var stations []models.Station
+	DB.Order("sort_order asc, id asc").Find(&stations)
+	find := func(name string) *models.Station {
+		for i := range stations {
+			if stations[i].Name == name || stations[i].Code == name {
+				return &stations[i]
+			}
+			for _, alias := range strings.Split(stations[i].Aliases, ",") {
+				if strings.TrimSpace(alias) == name {
+					return &stations[i]
+				}
+			}
+		}
+		return nil
+	}
+
+	for _, t := range StationNameTables {
+		if !t.HasID {
+			continue
+		}
+		table := t.Name
+		var names []string
+		DB.Table(table).Where("(station_id IS NULL OR station_id = 0) AND station <> ''").Distinct().Pluck("station", &names)
+		for _, name := range names {
+			station := find(name)
+			if station == nil {
+				created := models.Station{Code: name, Name: name, SortOrder: len(stations) + 1}
+				if err := DB.Create(&created).Error; err != nil {
+					log.Printf("Failed to create station %s: %v\n", name, err)
+					continue
+				}
+				stations = append(stations, created)
+				station = &stations[len(stations)-1]
+				log.Printf("Created station %s from existing %s\n", name, table)
+			}
+			// worker_stations 上 (worker_id, station) 唯一，改名可能与已有记录冲突，只补 station_id
+			updates := map[string]interface{}{"station_id": station.ID, "station": station.Name}
+			if table == "worker_stations" {
+				updates = map[string]interface{}{"station_id": station.ID}
+			}
+			err := DB.Table(table).Where("station = ? AND (station_id IS NULL OR station_id = 0)", name).Updates(updates).Error
+			if err != nil {
+				log.Printf("Failed to migrate %s.station %s: %v\n", table, name, err)
+			}
+		}
+	}
+}
+
+// seedScannerDevices 登记工人已有的扫码枪，最后扫码时间取扫码记录。
+// 登记时不指定工人，扫码时仍按工人的扫码枪代码识别
+func seedScannerDevices() {
+	// 早期自动登记的设备指定了同一扫码枪代码的工人，清除后工人改扫码枪代码才能生效
+	DB.Model(&models.ScannerDevice{}).
+		Where("remark IN ? AND worker_id IN (?)", []string{"由工人扫码枪代码登记", "首次扫码自动登记"},
+			DB.Model(&models.Worker{}).Select("id").Where("workers.scanner_code = scanner_devices.code")).
+		Update("worker_id", nil)
+
+	var workers []models.Worker
+	DB.Where("scanner_code <> '' AND scanner_code NOT IN (?)", DB.Model(&models.ScannerDevice{}).Select("code")).Find(&workers)
+	for _, w := range workers {
+		device := models.ScannerDevice{Code: w.ScannerCode, Name: w.Name, Remark: "由工人扫码枪代码登记"}
+		var last models.ScanLog
+		if DB.Where("scanner_code = ?", w.ScannerCode).Order("id desc").First(&last).Error == nil {
+			device.LastSeenAt = &last.CreatedAt
+		}
+		if err := DB.Create(&device).Error; err != nil {
+			log.Printf("Failed to register scanner %s: %v\n", w.ScannerCode, err)
+		}
+	}
+}
@@ -0,0 +1,443 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"trace-server/database"
+	"trace-server/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// afterSaleItemInput 售后明细输入
+type afterSaleItemInput struct {
+	OrderProductID uint   `json:"order_product_id"`
+	Quantity       int    `json:"quantity"` // 为 0 表示整行
+	Remark         string `json:"remark"`
+}
+
+// buildAfterSaleItems 校验售后明细属于该订单且数量不超过下单数量
+func buildAfterSaleItems(orderID uint, inputs []afterSaleItemInput) ([]models.AfterSaleItem, error) {
+	if len(inputs) == 0 {
+		return nil, errors.New("请选择有问题的产品明细")
+	}
+	items := make([]models.AfterSaleItem, 0, len(inputs))
+	for _, in := range inputs {
+		var op models.OrderProduct
+		if err := database.DB.Where("id = ? AND order_id = ?", in.OrderProductID, orderID).First(&op).Error; err != nil {
+			return nil, fmt.Errorf("明细 %d 不属于该订单", in.OrderProductID)
+		}
+		qty := in.Quantity
+		if qty == 0 {
+			qty = op.Quantity
+		}
+		if qty < 0 || qty > op.Quantity {
+			return nil, fmt.Errorf("明细 %d 售后数量必须在 1-%d 之间", op.ID, op.Quantity)
+		}
+		items = append(items, models.AfterSaleItem{OrderProductID: op.ID, Quantity: qty, Remark: in.Remark})
+	}
+	return items, nil
+}
+
+// loadAfterSaleTicket 加载售后工单及明细
+func loadAfterSaleTicket(id interface{}) (models.AfterSaleTicket, error) {
+	var ticket models.AfterSaleTicket
+	err := database.DB.
+		Preload("Order").
+		Preload("Items").
+		Preload("Items.OrderProduct").
+		Preload("Items.OrderProduct.Product").
+		Preload("Attachments", orderedAttachments).
+		First(&ticket, id).Error
+	return ticket, err
+}
+
+// resolveRemakeTicket 重做订单完成后，对应售后工单自动结案
+func resolveRemakeTicket(order *models.Order) {
+	if order.AfterSaleID == nil || order.Status != "已完成" {
+		return
+	}
+	now := time.Now()
+	database.DB.Model(&models.AfterSaleTicket{}).
+		Where("id = ? AND status = ?", *order.AfterSaleID, models.AfterSaleProcessing).
+		Updates(map[string]interface{}{"status": models.AfterSaleResolved, "resolved_at": now})
+}
+
+// GetAfterSaleTickets 售后工单列表
+func GetAfterSaleTickets(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	offset := (page - 1) * pageSize
+
+	var tickets []models.AfterSaleTicket
+	var total int64
+	query := database.DB.Model(&models.AfterSaleTicket{}).Preload("Items")
+
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if resolution := c.Query("resolution"); resolution != "" {
+		query = query.Where("resolution = ?", resolution)
+	}
+	if q := c.Query("q"); q != "" {
+		wildcard := "%" + q + "%"
+		query = query.Where("ticket_no LIKE ? OR customer_name LIKE ? OR phone LIKE ? OR reason LIKE ?", wildcard, wildcard, wildcard, wildcard)
+	}
+
+	query.Count(&total)
+	query.Order("id desc").Offset(offset).Limit(pageSize).Find(&tickets)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  tickets,
+		"total": total,
+		"page":  page,
+	})
+}
+
+// GetAfterSaleTicket 售后工单详情
+func GetAfterSaleTicket(c *gin.Context) {
+	ticket, err := loadAfterSaleTicket(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "售后工单不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, ticket)
+}
+
+// GetOrderAfterSales 订单的售后记录
+func GetOrderAfterSales(c *gin.Context) {
+	tickets := make([]models.AfterSaleTicket, 0)
+	database.DB.Preload("Items").Where("order_id = ?", c.Param("id")).Order("id desc").Find(&tickets)
+	c.JSON(http.StatusOK, gin.H{"data": tickets})
+}
+
+// CreateAfterSaleTicket 登记售后工单
+func CreateAfterSaleTicket(c *gin.Context) {
+	var input struct {
+		OrderID     uint                 `json:"order_id"`
+		Reason      string               `json:"reason"`
+		Description string               `json:"description"`
+		Photos      []string             `json:"photos"`
+		Items       []afterSaleItemInput `json:"items"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var order models.Order
+	if err := database.DB.First(&order, input.OrderID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
+		return
+	}
+	if input.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请填写售后原因"})
+		return
+	}
+	items, err := buildAfterSaleItems(order.ID, input.Items)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ticket := models.AfterSaleTicket{
+		OrderID:      order.ID,
+		CustomerID:   order.CustomerID,
+		CustomerName: order.CustomerName,
+		Phone:        order.Phone,
+		Reason:       input.Reason,
+		Description:  input.Description,
+		Status:       models.AfterSalePending,
+		Operator:     c.GetString("username"),
+		Items:        items,
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		ticketNo, err := nextSequence(tx, models.SequenceAfterSale)
+		if err != nil {
+			return err
+		}
+		ticket.TicketNo = ticketNo
+		if err := tx.Create(&ticket).Error; err != nil {
+			return err
+		}
+		_, err = syncAttachments(tx, models.AttachmentOwnerAfterSale, ticket.ID, input.Photos, ticket.Operator)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ticket, _ = loadAfterSaleTicket(ticket.ID)
+	c.JSON(http.StatusOK, ticket)
+}
+
+// UpdateAfterSaleTicket 修改待处理的售后工单
+func UpdateAfterSaleTicket(c *gin.Context) {
+	var ticket models.AfterSaleTicket
+	if err := database.DB.First(&ticket, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "售后工单不存在"})
+		return
+	}
+	if ticket.Status != models.AfterSalePending {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "只有待处理的售后工单可以修改"})
+		return
+	}
+
+	var input struct {
+		Reason      string               `json:"reason"`
+		Description string               `json:"description"`
+		Photos      []string             `json:"photos"`
+		Items       []afterSaleItemInput `json:"items"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请填写售后原因"})
+		return
+	}
+	items, err := buildAfterSaleItems(ticket.OrderID, input.Items)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ticket.Reason = input.Reason
+	ticket.Description = input.Description
+
+	var removed []models.Attachment
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("ticket_id = ?", ticket.ID).Delete(&models.AfterSaleItem{}).Error; err != nil {
+			return err
+		}
+		for i := range items {
+			items[i].TicketID = ticket.ID
+		}
+		if err := tx.Create(&items).Error; err != nil {
+			return err
+		}
+		if removed, err = syncAttachments(tx, models.AttachmentOwnerAfterSale, ticket.ID, input.Photos, c.GetString("username")); err != nil {
+			return err
+		}
+		return tx.Omit("Order", "Items", "Attachments").Save(&ticket).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	removeAttachmentFiles(removed)
+
+	ticket, _ = loadAfterSaleTicket(ticket.ID)
+	c.JSON(http.StatusOK, ticket)
+}
+
+// ResolveAfterSaleTicket 确定处理方式：维修直接结案；重做生成免费重做订单进入生产流程；
+// 退款登记退款和等额折让，订单金额保持原销售额不变
+func ResolveAfterSaleTicket(c *gin.Context) {
+	ticket, err := loadAfterSaleTicket(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "售后工单不存在"})
+		return
+	}
+	if ticket.Status != models.AfterSalePending {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "售后工单当前状态为 " + ticket.Status + "，不能重复处理"})
+		return
+	}
+
+	var input struct {
+		Resolution   string  `json:"resolution"` // repair, remake, refund
+		Remark       string  `json:"remark"`
+		RefundAmount float64 `json:"refund_amount"`
+		RefundMethod string  `json:"refund_method"`
+		DeadlineStr  string  `json:"deadline_str"` // 重做单交货日期
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var order models.Order
+	if err := database.DB.Preload("OrderProducts").First(&order, ticket.OrderID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "原订单不存在"})
+		return
+	}
+
+	now := time.Now()
+	ticket.Resolution = input.Resolution
+	ticket.Remark = input.Remark
+	ticket.Operator = c.GetString("username")
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		switch input.Resolution {
+		case models.ResolutionRepair:
+			ticket.Status = models.AfterSaleResolved
+			ticket.ResolvedAt = &now
+
+		case models.ResolutionRemake:
+			// 重做单按原规格和原单价生产，订单金额计入产值；不另收费，以等额折让结清
+			remake := models.Order{
+				CustomerID:   order.CustomerID,
+				CustomerName: order.CustomerName,
+				Phone:        order.Phone,
+				Address:      order.Address,
+				Specs:        order.Specs,
+				Remark:       fmt.Sprintf("售后重做（%s，原订单 %s）", ticket.TicketNo, order.OrderNo),
+				Deadline:     parseDeadline(input.DeadlineStr),
+				AfterSaleID:  &ticket.ID,
+			}
+			for _, item := range ticket.Items {
+				if item.OrderProduct == nil {
+					return errors.New("售后明细对应的订单产品不存在")
+				}
+				op := *item.OrderProduct
+				op.ID = 0
+				op.OrderID = 0
+				op.CreatedAt, op.UpdatedAt = time.Time{}, time.Time{}
+				op.Product = nil
+				op.Quantity = item.Quantity
+				op.DiscountType, op.DiscountValue, op.Discount = "", 0, 0
+				priceLine(&op)
+				remake.OrderProducts = append(remake.OrderProducts, op)
+			}
+			// 原订单明细无单价时按数量比例取原订单金额
+			subtotal := sumLines(remake.OrderProducts)
+			if subtotal <= 0 {
+				subtotal = roundMoney(order.Amount * float64(sumQuantity(remake.OrderProducts)) / float64(max(sumQuantity(order.OrderProducts), 1)))
+			}
+			applyOrderDiscount(&remake, subtotal)
+			if err := createOrder(tx, &remake); err != nil {
+				return err
+			}
+			if remake.Amount > 0 {
+				free := models.Payment{
+					Type:     models.PaymentAllowance,
+					Method:   models.PayMethodOther,
+					Amount:   remake.Amount,
+					Operator: ticket.Operator,
+					Remark:   "售后重做免费 " + ticket.TicketNo,
+				}
+				if err := recordPayment(tx, &remake, &free); err != nil {
+					return err
+				}
+			}
+			ticket.RemakeOrderID = &remake.ID
+			ticket.Status = models.AfterSaleProcessing
+
+		case models.ResolutionRefund:
+			amount := roundMoney(input.RefundAmount)
+			if amount <= 0 {
+				return errors.New("退款金额必须大于0")
+			}
+			if amount > order.Amount {
+				return errors.New("退款金额不能超过订单金额")
+			}
+			// 此前的退款都登记了等额折让，已收金额不变，须按实收减去已退金额控制
+			refundable, err := refundableAmount(tx, order.ID)
+			if err != nil {
+				return err
+			}
+			if amount > refundable {
+				return fmt.Errorf("退款金额不能超过可退金额 %.2f（已收款减去此前退款）", refundable)
+			}
+			method := input.RefundMethod
+			if method == "" {
+				method = models.PayMethodOther
+			}
+			payment := models.Payment{
+				Type:     models.PaymentRefund,
+				Method:   method,
+				Amount:   amount,
+				Operator: ticket.Operator,
+				Remark:   "售后退款 " + ticket.TicketNo,
+			}
+			if err := recordPayment(tx, &order, &payment); err != nil {
+				return err
+			}
+			// 退款同时登记等额折让，避免退款后产生应收余额；订单金额不变
+			allowance := models.Payment{
+				Type:     models.PaymentAllowance,
+				Method:   models.PayMethodOther,
+				Amount:   amount,
+				Operator: ticket.Operator,
+				Remark:   "售后退款折让 " + ticket.TicketNo,
+			}
+			if err := recordPayment(tx, &order, &allowance); err != nil {
+				return err
+			}
+			ticket.RefundAmount = amount
+			ticket.PaymentID = &payment.ID
+			ticket.Status = models.AfterSaleResolved
+			ticket.ResolvedAt = &now
+
+		default:
+			return errors.New("无效的处理方式: " + input.Resolution)
+		}
+		return tx.Omit("Order", "Items", "Attachments").Save(&ticket).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ticket, _ = loadAfterSaleTicket(ticket.ID)
+	c.JSON(http.StatusOK, ticket)
+}
+
+// CloseAfterSaleTicket 关闭售后工单（不予处理或客户撤回）
+func CloseAfterSaleTicket(c *gin.Context) {
+	var ticket models.AfterSaleTicket
+	if err := database.DB.First(&ticket, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "售后工单不存在"})
+		return
+	}
+	if ticket.Status != models.AfterSalePending {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "只有待处理的售后工单可以关闭"})
+		return
+	}
+
+	var input struct {
+		Remark string `json:"remark"`
+	}
+	c.ShouldBindJSON(&input)
+
+	now := time.Now()
+	database.DB.Model(&ticket).Updates(map[string]interface{}{
+		"status":      models.AfterSaleClosed,
+		"remark":      input.Remark,
+		"operator":    c.GetString("username"),
+		"resolved_at": now,
+	})
+	c.JSON(http.StatusOK, gin.H{"message": "售后工单已关闭"})
+}
+
+// DeleteAfterSaleTicket 删除误登记的售后工单
+func DeleteAfterSaleTicket(c *gin.Context) {
+	var ticket models.AfterSaleTicket
+	if err := database.DB.First(&ticket, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "售后工单不存在"})
+		return
+	}
+	if ticket.Status != models.AfterSalePending {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "已处理的售后工单不能删除"})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("ticket_id = ?", ticket.ID).Delete(&models.AfterSaleItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&ticket).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "售后工单已删除"})
+}
@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"trace-server/database"
+	"trace-server/models"
+	"trace-server/storage"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 未被引用的上传文件超过该时长才视为孤儿文件（下单页先上传后提交订单）
+const orphanFileGrace = 24 * time.Hour
+
+// attachmentFromURL 根据上传接口返回的URL生成附件记录，非本地上传的URL返回 false
+func attachmentFromURL(ctx context.Context, url string) (models.Attachment, bool) {
+	key, ok := uploadKey(url)
+	if !ok {
+		return models.Attachment{}, false
+	}
+	att := models.Attachment{
+		FileName: filepath.Base(key),
+		Path:     key,
+		URL:      uploadURLPrefix + key,
+	}
+	if obj, err := storage.Current.Stat(ctx, key); err == nil {
+		att.Size = obj.Size
+		att.MimeType = obj.ContentType
+	}
+	att.Thumbnails = thumbnailsJSON(existingThumbnails(ctx, key))
+	return att, true
+}
+
+// orderedAttachments 预加载附件时按排序号排列
+func orderedAttachments(db *gorm.DB) *gorm.DB {
+	return db.Order("sort_order asc, id asc")
+}
+
+// removeAttachmentFiles 删除附件对应的文件；同一文件仍被其他附件引用时保留
+func removeAttachmentFiles(atts []models.Attachment) {
+	for _, att := range atts {
+		var refs int64
+		database.DB.Model(&models.Attachment{}).Where("path = ?", att.Path).Count(&refs)
+		if refs > 0 {
+			continue
+		}
+		if err := removeUploadFile(context.Background(), att.Path); err != nil {
+			log.Printf("Failed to remove attachment %s: %v\n", att.Path, err)
+		}
+	}
+}
+
+// syncAttachments 按URL列表同步对象的附件：新增缺少的、删除列表中没有的，并按列表顺序排序。
+// urls 为 nil（请求中未提供或为 null）时不做任何修改，只有显式传入空列表才清空附件。
+// 返回被删除的附件，调用方在事务提交后删除其文件。
+func syncAttachments(tx *gorm.DB, ownerType string, ownerID uint, urls []string, uploader string) ([]models.Attachment, error) {
+	if urls == nil {
+		return nil, nil
+	}
+	var existing []models.Attachment
+	if err := tx.Where("owner_type = ? AND owner_id = ?", ownerType, ownerID).Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	byURL := make(map[string]models.Attachment, len(existing))
+	for _, att := range existing {
+		byURL[att.URL] = att
+	}
+
+	keep := make(map[string]bool, len(urls))
+	for i, url := range urls {
+		url = strings.TrimSpace(url)
+		if url == "" || keep[url] {
+			continue
+		}
+		keep[url] = true
+		if att, ok := byURL[url]; ok {
+			if att.SortOrder != i {
+				if err := tx.Model(&att).Update("sort_order", i).Error; err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		att, ok := attachmentFromURL(tx.Statement.Context, url)
+		if !ok {
+			continue
+		}
+		att.OwnerType = ownerType
+		att.OwnerID = ownerID
+		att.SortOrder = i
+		att.Uploader = uploader
+		if err := tx.Create(&att).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	var removed []models.Attachment
+	for _, att := range existing {
+		if keep[att.URL] {
+			continue
+		}
+		if err := tx.Unscoped().Delete(&att).Error; err != nil {
+			return nil, err
+		}
+		removed = append(removed, att)
+	}
+	return removed, nil
+}
+
+// deleteOwnerAttachments 永久删除对象的全部附件记录，返回被删除的附件
+func deleteOwnerAttachments(tx *gorm.DB, ownerType string, ownerID uint) ([]models.Attachment, error) {
+	var atts []models.Attachment
+	if err := tx.Where("owner_type = ? AND owner_id = ?", ownerType, ownerID).Find(&atts).Error; err != nil {
+		return nil, err
+	}
+	if len(atts) == 0 {
+		return nil, nil
+	}
+	return atts, tx.Unscoped().Where("owner_type = ? AND owner_id = ?", ownerType, ownerID).Delete(&models.Attachment{}).Error
+}
+
+// attachmentOwnerModel 附件所属对象对应的模型
+func attachmentOwnerModel(ownerType string) interface{} {
+	switch ownerType {
+	case models.AttachmentOwnerOrder:
+		return &models.Order{}
+	case models.AttachmentOwnerProduct:
+		return &models.Product{}
+	case models.AttachmentOwnerAfterSale:
+		return &models.AfterSaleTicket{}
+	case models.AttachmentOwnerDelivery:
+		return &models.DeliveryStop{}
+	}
+	return nil
+}
+
+// attachmentOwnerExists 附件所属对象是否存在（含已软删除）
+func attachmentOwnerExists(ownerType string, ownerID interface{}) bool {
+	model := attachmentOwnerModel(ownerType)
+	if model == nil {
+		return false
+	}
+	var count int64
+	database.DB.Unscoped().Model(model).Where("id = ?", ownerID).Count(&count)
+	return count > 0
+}
+
+// GetAttachments 获取订单、产品或售后工单的附件列表
+func GetAttachments(ownerType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		attachments := make([]models.Attachment, 0)
+		orderedAttachments(database.DB).
+			Where("owner_type = ? AND owner_id = ?", ownerType, c.Param("id")).
+			Find(&attachments)
+		c.JSON(http.StatusOK, gin.H{"data": attachments})
+	}
+}
+
+// UploadAttachment 为订单、产品或售后工单上传附件（multipart: file, caption）
+func UploadAttachment(ownerType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ownerID, _ := strconv.Atoi(c.Param("id"))
+		if ownerID <= 0 || !attachmentOwnerExists(ownerType, ownerID) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "附件所属对象不存在"})
+			return
+		}
+
+		limitUploadBody(c)
+		file, err := c.FormFile("file")
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				respondUploadError(c, errUploadTooLarge)
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+			return
+		}
+		saved, err := saveUploadedFile(c, file)
+		if err != nil {
+			respondUploadError(c, err)
+			return
+		}
+
+		var count int64
+		database.DB.Model(&models.Attachment{}).Where("owner_type = ? AND owner_id = ?", ownerType, ownerID).Count(&count)
+
+		att := models.Attachment{
+			OwnerType:  ownerType,
+			OwnerID:    uint(ownerID),
+			FileName:   file.Filename,
+			Path:       saved.Filename,
+			URL:        saved.URL(),
+			MimeType:   saved.MimeType,
+			Size:       saved.Size,
+			Thumbnails: saved.ThumbnailsJSON(),
+			Caption:    c.PostForm("caption"),
+			SortOrder:  int(count),
+			Uploader:   c.GetString("username"),
+		}
+		if err := database.DB.Create(&att).Error; err != nil {
+			removeAttachmentFiles([]models.Attachment{att})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, att)
+	}
+}
+
+// UpdateAttachment 修改附件说明和排序
+func UpdateAttachment(c *gin.Context) {
+	var att models.Attachment
+	if err := database.DB.First(&att, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "附件不存在"})
+		return
+	}
+
+	var input struct {
+		Caption   string `json:"caption"`
+		SortOrder int    `json:"sort_order"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	att.Caption = input.Caption
+	att.SortOrder = input.SortOrder
+	database.DB.Save(&att)
+	c.JSON(http.StatusOK, att)
+}
+
+// DeleteAttachment 删除附件及其文件
+func DeleteAttachment(c *gin.Context) {
+	var att models.Attachment
+	if err := database.DB.First(&att, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "附件不存在"})
+		return
+	}
+
+	if err := database.DB.Unscoped().Delete(&att).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	removeAttachmentFiles([]models.Attachment{att})
+	c.JSON(http.StatusOK, gin.H{"message": "附件已删除"})
+}
+
+// referencedUploads 仍被引用的上传文件名：附件表、产品主图、签收凭证
+func referencedUploads() map[string]bool {
+	refs := make(map[string]bool)
+
+	var paths []string
+	database.DB.Model(&models.Attachment{}).Pluck("path", &paths)
+	for _, p := range paths {
+		refs[p] = true
+	}
+
+	var images []string
+	database.DB.Unscoped().Model(&models.Product{}).Where("image <> ''").Pluck("image", &images)
+	for _, url := range images {
+		if key, ok := uploadKey(url); ok {
+			refs[key] = true
+		}
+	}
+
+	var stops []models.DeliveryStop
+	database.DB.Unscoped().Select("signature_url", "photos").Find(&stops)
+	for _, stop := range stops {
+		var photos []string
+		json.Unmarshal([]byte(stop.Photos), &photos)
+		for _, url := range append(photos, stop.SignatureURL) {
+			if key, ok := uploadKey(url); ok {
+				refs[key] = true
+			}
+		}
+	}
+	return refs
+}
+
+// CleanupOrphanAttachments 清理孤儿附件：所属对象已永久删除的附件记录，以及无任何引用的上传文件（仅管理员）
+// dry_run=true 时只返回待清理列表
+func CleanupOrphanAttachments(c *gin.Context) {
+	dryRun := c.Query("dry_run") == "true"
+
+	// 1. 所属对象已不存在的附件记录
+	var atts []models.Attachment
+	database.DB.Find(&atts)
+	orphanRecords := make([]models.Attachment, 0)
+	for _, att := range atts {
+		if !attachmentOwnerExists(att.OwnerType, att.OwnerID) {
+			orphanRecords = append(orphanRecords, att)
+		}
+	}
+	if !dryRun {
+		for i := range orphanRecords {
+			database.DB.Unscoped().Delete(&orphanRecords[i])
+		}
+		removeAttachmentFiles(orphanRecords)
+	}
+
+	// 2. 上传目录中没有任何引用的文件
+	refs := referencedUploads()
+	orphanFiles := make([]string, 0)
+	var freed int64
+	cutoff := time.Now().Add(-orphanFileGrace)
+	ctx := c.Request.Context()
+	err := storage.Current.List(ctx, "", func(obj storage.Object) error {
+		// 缩略图随原文件一起删除
+		if strings.HasPrefix(obj.Key, thumbDir+"/") || refs[obj.Key] || obj.ModTime.After(cutoff) {
+			return nil
+		}
+		orphanFiles = append(orphanFiles, obj.Key)
+		freed += obj.Size
+		if !dryRun {
+			if err := removeUploadFile(ctx, obj.Key); err != nil {
+				log.Printf("Failed to remove orphan file %s: %v\n", obj.Key, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"dry_run":        dryRun,
+		"orphan_records": orphanRecords,
+		"orphan_files":   orphanFiles,
+		"freed_bytes":    freed,
+	})
+}
@@ -0,0 +1,768 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+	"trace-server/database"
+	"trace-server/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	attendanceMaxSpan  = 20 * time.Hour // 上班超过该时长仍未打下班卡视为漏打
+	attendanceDebounce = time.Minute    // 自动打卡时忽略连续重复扫码
+)
+
+// 打卡动作，不指定时按当前状态自动判断
+const (
+	punchIn     = "in"
+	punchOut    = "out"
+	punchBreak  = "break"
+	punchResume = "resume"
+)
+
+// ---------- 打卡 ----------
+
+// PunchAttendance 工位打卡：按工牌或已登记的扫码枪识别工人，补录打卡走后台考勤接口
+func PunchAttendance(c *gin.Context) {
+	var input struct {
+		BadgeCode   string `json:"badge_code"`
+		ScannerCode string `json:"scanner_code"`
+		Action      string `json:"action"` // in, out, break, resume，为空时自动判断
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.BadgeCode == "" && input.ScannerCode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "未提供工人身份信息"})
+		return
+	}
+	worker, ok := stationWorker(input.BadgeCode, input.ScannerCode)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "工人不存在"})
+		return
+	}
+	source := models.AttendanceBadge
+	if input.BadgeCode == "" {
+		source = models.AttendanceScanner
+		touchScanner(input.ScannerCode)
+	}
+
+	respondPunch(c, worker, input.Action, source)
+}
+
+// respondPunch 打卡并返回结果，工位扫工牌和打卡接口共用
+func respondPunch(c *gin.Context, worker models.Worker, action, source string) {
+	attendance, msg, err := punchAttendance(worker, action, source)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":    msg,
+		"worker":     worker,
+		"attendance": attendance,
+	})
+}
+
+// punchAttendance 记录一次打卡
+func punchAttendance(worker models.Worker, action, source string) (*models.Attendance, string, error) {
+	now := time.Now()
+	open := openAttendance(worker.ID, now)
+
+	if action == "" {
+		switch {
+		case open == nil:
+			action = punchIn
+		case open.BreakStartAt != nil:
+			action = punchResume
+		default:
+			action = punchOut
+		}
+		if open != nil && now.Sub(open.UpdatedAt) < attendanceDebounce {
+			return open, "请勿重复打卡", nil
+		}
+	}
+
+	switch action {
+	case punchIn:
+		if open != nil {
+			return nil, "", errors.New("已上班打卡，请先下班打卡")
+		}
+		a := models.Attendance{
+			WorkerID: worker.ID,
+			WorkDate: now.Format("2006-01-02"),
+			ClockIn:  now,
+			Source:   source,
+		}
+		if shift := workerShift(&worker); shift != nil {
+			a.ShiftID = &shift.ID
+		}
+		if err := database.DB.Create(&a).Error; err != nil {
+			return nil, "", err
+		}
+		return &a, fmt.Sprintf("%s 上班打卡 %s", worker.Name, now.Format("15:04")), nil
+
+	case punchOut:
+		if open == nil {
+			return nil, "", errors.New("没有上班打卡记录")
+		}
+		endBreak(open, now)
+		open.ClockOut = &now
+		if err := database.DB.Omit("Worker", "Shift").Save(open).Error; err != nil {
+			return nil, "", err
+		}
+		stats := calcAttendance(open, loadShift(open.ShiftID), now)
+		return open, fmt.Sprintf("%s 下班打卡 %s，工时 %s 小时", worker.Name, now.Format("15:04"), formatNumber(minutesToHours(stats.WorkedMinutes))), nil
+
+	case punchBreak:
+		if open == nil {
+			return nil, "", errors.New("没有上班打卡记录")
+		}
+		if open.BreakStartAt != nil {
+			return nil, "", errors.New("已在休息中")
+		}
+		open.BreakStartAt = &now
+		if err := database.DB.Omit("Worker", "Shift").Save(open).Error; err != nil {
+			return nil, "", err
+		}
+		return open, fmt.Sprintf("%s 开始休息 %s", worker.Name, now.Format("15:04")), nil
+
+	case punchResume:
+		if open == nil || open.BreakStartAt == nil {
+			return nil, "", errors.New("未在休息中")
+		}
+		endBreak(open, now)
+		if err := database.DB.Omit("Worker", "Shift").Save(open).Error; err != nil {
+			return nil, "", err
+		}
+		return open, fmt.Sprintf("%s 结束休息 %s", worker.Name, now.Format("15:04")), nil
+	}
+	return nil, "", errors.New("无效的打卡动作: " + action)
+}
+
+// openAttendance 工人当前未下班的出勤，超过最长时长的视为漏打下班卡，不再延续
+func openAttendance(workerID uint, now time.Time) *models.Attendance {
+	var a models.Attendance
+	err := database.DB.Where("worker_id = ? AND clock_out IS NULL AND clock_in > ?", workerID, now.Add(-attendanceMaxSpan)).
+		Order("clock_in desc").First(&a).Error
+	if err != nil {
+		return nil
+	}
+	return &a
+}
+
+// endBreak 结束正在进行的休息并累计分钟
+func endBreak(a *models.Attendance, now time.Time) {
+	if a.BreakStartAt == nil {
+		return
+	}
+	a.BreakMinutes += int(now.Sub(*a.BreakStartAt).Minutes())
+	a.BreakStartAt = nil
+}
+
+// workerShift 工人的班次，未指定时使用默认班次
+func workerShift(worker *models.Worker) *models.Shift {
+	if worker.ShiftID != nil {
+		if shift := loadShift(worker.ShiftID); shift != nil {
+			return shift
+		}
+	}
+	var shift models.Shift
+	if err := database.DB.Where("is_default = ?", true).First(&shift).Error; err != nil {
+		return nil
+	}
+	return &shift
+}
+
+func loadShift(id *uint) *models.Shift {
+	if id == nil {
+		return nil
+	}
+	var shift models.Shift
+	if err := database.DB.First(&shift, *id).Error; err != nil {
+		return nil
+	}
+	return &shift
+}
+
+// ---------- 工时计算 ----------
+
+// attendanceStats 一次出勤的工时和迟到早退（分钟）
+type attendanceStats struct {
+	WorkedMinutes int
+	BreakMinutes  int // 临时休息 + 与班次固定休息重叠的部分
+	LateMinutes   int
+	EarlyMinutes  int
+	MissingOut    bool // 漏打下班卡，不计工时
+	Working       bool // 仍在上班
+}
+
+// calcAttendance 计算工时：上下班间隔减去临时休息和班次固定休息
+func calcAttendance(a *models.Attendance, shift *models.Shift, now time.Time) attendanceStats {
+	var s attendanceStats
+	end := now
+	switch {
+	case a.ClockOut != nil:
+		end = *a.ClockOut
+	case now.Sub(a.ClockIn) < attendanceMaxSpan:
+		s.Working = true
+	default:
+		s.MissingOut = true
+	}
+
+	breaks := time.Duration(a.BreakMinutes) * time.Minute
+	if a.BreakStartAt != nil && !s.MissingOut {
+		breaks += end.Sub(*a.BreakStartAt)
+	}
+
+	if shift != nil {
+		day, _ := time.ParseInLocation("2006-01-02", a.WorkDate, time.Local)
+		start, okStart := shiftClock(day, shift.StartTime)
+		finish, okFinish := shiftClock(day, shift.EndTime)
+		if okStart && okFinish && !finish.After(start) {
+			finish = finish.AddDate(0, 0, 1)
+		}
+		if okStart {
+			grace := time.Duration(shift.LateGrace) * time.Minute
+			if a.ClockIn.After(start.Add(grace)) {
+				s.LateMinutes = int(a.ClockIn.Sub(start).Minutes())
+			}
+		}
+		if okFinish && a.ClockOut != nil && a.ClockOut.Before(finish) {
+			s.EarlyMinutes = int(finish.Sub(*a.ClockOut).Minutes())
+		}
+
+		// 固定休息按与出勤时段的重叠部分扣除
+		bs, okBS := shiftClock(day, shift.BreakStart)
+		be, okBE := shiftClock(day, shift.BreakEnd)
+		if okBS && okBE && !s.MissingOut {
+			if okStart && bs.Before(start) {
+				bs, be = bs.AddDate(0, 0, 1), be.AddDate(0, 0, 1)
+			}
+			if !be.After(bs) {
+				be = be.AddDate(0, 0, 1)
+			}
+			breaks += overlap(a.ClockIn, end, bs, be)
+		}
+	}
+
+	s.BreakMinutes = int(breaks.Minutes())
+	if !s.MissingOut {
+		if worked := end.Sub(a.ClockIn) - breaks; worked > 0 {
+			s.WorkedMinutes = int(worked.Minutes())
+		}
+	}
+	return s
+}
+
+// shiftClock 某日的 "08:00" 时刻
+func shiftClock(day time.Time, hhmm string) (time.Time, bool) {
+	t, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), 0, 0, time.Local), true
+}
+
+func overlap(aStart, aEnd, bStart, bEnd time.Time) time.Duration {
+	if bStart.After(aStart) {
+		aStart = bStart
+	}
+	if bEnd.Before(aEnd) {
+		aEnd = bEnd
+	}
+	if aEnd.After(aStart) {
+		return aEnd.Sub(aStart)
+	}
+	return 0
+}
+
+func minutesToHours(minutes int) float64 {
+	return math.Round(float64(minutes)/60*100) / 100
+}
+
+// perHour 每小时产量
+func perHour(count int64, minutes int) float64 {
+	if minutes <= 0 {
+		return 0
+	}
+	return math.Round(float64(count)/(float64(minutes)/60)*100) / 100
+}
+
+// workerOutput 时间段内每个工人的扫码次数和件数
+type workerOutput struct {
+	WorkerID uint
+	Scans    int64
+	Pieces   int64
+}
+
+func workerOutputs(start, end time.Time) map[uint]workerOutput {
+	var rows []workerOutput
+	database.DB.Model(&models.Process{}).
+		Joins(processPiecesJoin).
+		Select("processes.worker_id, count(*) as scans, coalesce(sum(oq.qty), 0) as pieces").
+		Where("processes.created_at >= ? AND processes.created_at < ?", start, end).
+		Group("processes.worker_id").
+		Scan(&rows)
+	outputs := make(map[uint]workerOutput, len(rows))
+	for _, r := range rows {
+		outputs[r.WorkerID] = r
+	}
+	return outputs
+}
+
+// ---------- 报表 ----------
+
+// GetDailyAttendance 每日考勤：每个工人的上下班时间、工时、迟到早退和每小时产量
+func GetDailyAttendance(c *gin.Context) {
+	date := c.DefaultQuery("date", time.Now().Format("2006-01-02"))
+	day, err := time.ParseInLocation("2006-01-02", date, time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "日期格式应为 YYYY-MM-DD"})
+		return
+	}
+
+	var workers []models.Worker
+	query := database.DB.Order("station asc, id asc")
+	if station := c.Query("station"); station != "" {
+		query = query.Where("station = ?", station)
+	}
+	query.Find(&workers)
+
+	var attendances []models.Attendance
+	database.DB.Preload("Shift").Where("work_date = ?", date).Order("clock_in asc").Find(&attendances)
+	byWorker := map[uint][]models.Attendance{}
+	for _, a := range attendances {
+		byWorker[a.WorkerID] = append(byWorker[a.WorkerID], a)
+	}
+	outputs := workerOutputs(day, day.AddDate(0, 0, 1))
+
+	type dailyRow struct {
+		WorkerID      uint       `json:"worker_id"`
+		WorkerName    string     `json:"worker_name"`
+		Station       string     `json:"station"`
+		Shift         string     `json:"shift"`
+		ClockIn       *time.Time `json:"clock_in"`
+		ClockOut      *time.Time `json:"clock_out"`
+		BreakMinutes  int        `json:"break_minutes"`
+		WorkedHours   float64    `json:"worked_hours"`
+		LateMinutes   int        `json:"late_minutes"`
+		EarlyMinutes  int        `json:"early_minutes"`
+		Status        string     `json:"status"`
+		Scans         int64      `json:"scans"`
+		Pieces        int64      `json:"pieces"`
+		PiecesPerHour float64    `json:"pieces_per_hour"`
+	}
+	now := time.Now()
+	rows := make([]dailyRow, 0, len(workers))
+	summary := gin.H{}
+	counts := map[string]int{}
+	for _, w := range workers {
+		row := dailyRow{WorkerID: w.ID, WorkerName: w.Name, Station: w.Station}
+		sessions := byWorker[w.ID]
+		worked := 0
+		missingOut, working := false, false
+		for i := range sessions {
+			a := &sessions[i]
+			stats := calcAttendance(a, a.Shift, now)
+			if i == 0 {
+				row.ClockIn = &a.ClockIn
+				row.LateMinutes = stats.LateMinutes
+				if a.Shift != nil {
+					row.Shift = a.Shift.Name
+				}
+			}
+			if i == len(sessions)-1 {
+				row.ClockOut = a.ClockOut
+				row.EarlyMinutes = stats.EarlyMinutes
+			}
+			worked += stats.WorkedMinutes
+			row.BreakMinutes += stats.BreakMinutes
+			missingOut = missingOut || stats.MissingOut
+			working = working || stats.Working
+		}
+		row.WorkedHours = minutesToHours(worked)
+		row.Scans = outputs[w.ID].Scans
+		row.Pieces = outputs[w.ID].Pieces
+		row.PiecesPerHour = perHour(row.Pieces, worked)
+
+		switch {
+		case len(sessions) == 0:
+			row.Status = "缺勤"
+		case working:
+			row.Status = "上班中"
+		case missingOut:
+			row.Status = "漏打下班卡"
+		case row.LateMinutes > 0 && row.EarlyMinutes > 0:
+			row.Status = "迟到、早退"
+		case row.LateMinutes > 0:
+			row.Status = "迟到"
+		case row.EarlyMinutes > 0:
+			row.Status = "早退"
+		default:
+			row.Status = "正常"
+		}
+		counts[row.Status]++
+		rows = append(rows, row)
+	}
+	for status, n := range counts {
+		summary[status] = n
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"date":    date,
+		"data":    rows,
+		"summary": summary,
+	})
+}
+
+// GetAttendanceReport 考勤汇总：时间段内每个工人的出勤天数、工时、迟到早退次数和每小时产量
+func GetAttendanceReport(c *gin.Context) {
+	startDate := c.DefaultQuery("start_date", time.Now().AddDate(0, 0, -6).Format("2006-01-02"))
+	endDate := c.DefaultQuery("end_date", time.Now().Format("2006-01-02"))
+	start, err1 := time.ParseInLocation("2006-01-02", startDate, time.Local)
+	end, err2 := time.ParseInLocation("2006-01-02", endDate, time.Local)
+	if err1 != nil || err2 != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "日期格式应为 YYYY-MM-DD"})
+		return
+	}
+
+	query := database.DB.Preload("Shift").Where("work_date >= ? AND work_date <= ?", startDate, endDate)
+	if workerID := c.Query("worker_id"); workerID != "" {
+		query = query.Where("worker_id = ?", workerID)
+	}
+	var attendances []models.Attendance
+	query.Order("clock_in asc").Find(&attendances)
+
+	type reportRow struct {
+		WorkerID      uint    `json:"worker_id"`
+		WorkerName    string  `json:"worker_name"`
+		Station       string  `json:"station"`
+		Days          int     `json:"days"`
+		WorkedHours   float64 `json:"worked_hours"`
+		LateTimes     int     `json:"late_times"`
+		EarlyTimes    int     `json:"early_times"`
+		MissingOut    int     `json:"missing_out"`
+		Scans         int64   `json:"scans"`
+		Pieces        int64   `json:"pieces"`
+		ScansPerHour  float64 `json:"scans_per_hour"`
+		PiecesPerHour float64 `json:"pieces_per_hour"`
+		workedMinutes int
+		days          map[string]bool
+	}
+	now := time.Now()
+	rowsByWorker := map[uint]*reportRow{}
+	var order []uint
+	for i := range attendances {
+		a := &attendances[i]
+		row, ok := rowsByWorker[a.WorkerID]
+		if !ok {
+			row = &reportRow{WorkerID: a.WorkerID, days: map[string]bool{}}
+			rowsByWorker[a.WorkerID] = row
+			order = append(order, a.WorkerID)
+		}
+		stats := calcAttendance(a, a.Shift, now)
+		row.days[a.WorkDate] = true
+		row.workedMinutes += stats.WorkedMinutes
+		if stats.LateMinutes > 0 {
+			row.LateTimes++
+		}
+		if stats.EarlyMinutes > 0 {
+			row.EarlyTimes++
+		}
+		if stats.MissingOut {
+			row.MissingOut++
+		}
+	}
+
+	outputs := workerOutputs(start, end.AddDate(0, 0, 1))
+	workers := map[uint]models.Worker{}
+	if len(order) > 0 {
+		var list []models.Worker
+		database.DB.Unscoped().Where("id IN ?", order).Find(&list)
+		for _, w := range list {
+			workers[w.ID] = w
+		}
+	}
+	rows := make([]*reportRow, 0, len(order))
+	for _, id := range order {
+		row := rowsByWorker[id]
+		row.WorkerName = workers[id].Name
+		row.Station = workers[id].Station
+		row.Days = len(row.days)
+		row.WorkedHours = minutesToHours(row.workedMinutes)
+		row.Scans = outputs[id].Scans
+		row.Pieces = outputs[id].Pieces
+		row.ScansPerHour = perHour(row.Scans, row.workedMinutes)
+		row.PiecesPerHour = perHour(row.Pieces, row.workedMinutes)
+		rows = append(rows, row)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": rows,
+		"date_range": gin.H{
+			"start": startDate,
+			"end":   endDate,
+		},
+	})
+}
+
+// ---------- 出勤记录维护 ----------
+
+// GetAttendances 出勤记录列表（按日期、工人筛选）
+func GetAttendances(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	offset := (page - 1) * pageSize
+
+	query := database.DB.Model(&models.Attendance{})
+	if date := c.Query("date"); date != "" {
+		query = query.Where("work_date = ?", date)
+	}
+	if startDate := c.Query("start_date"); startDate != "" {
+		query = query.Where("work_date >= ?", startDate)
+	}
+	if endDate := c.Query("end_date"); endDate != "" {
+		query = query.Where("work_date <= ?", endDate)
+	}
+	if workerID := c.Query("worker_id"); workerID != "" {
+		query = query.Where("worker_id = ?", workerID)
+	}
+
+	var total int64
+	var attendances []models.Attendance
+	query.Count(&total)
+	query.Preload("Worker").Preload("Shift").Order("clock_in desc").Offset(offset).Limit(pageSize).Find(&attendances)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  attendances,
+		"total": total,
+		"page":  page,
+	})
+}
+
+// attendanceInput 后台补录、修改出勤，时间格式 2006-01-02 15:04
+type attendanceInput struct {
+	WorkerID     uint   `json:"worker_id"`
+	ShiftID      *uint  `json:"shift_id"`
+	ClockIn      string `json:"clock_in"`
+	ClockOut     string `json:"clock_out"`
+	BreakMinutes int    `json:"break_minutes"`
+	Remark       string `json:"remark"`
+}
+
+func (in *attendanceInput) apply(a *models.Attendance) error {
+	clockIn, err := time.ParseInLocation("2006-01-02 15:04", in.ClockIn, time.Local)
+	if err != nil {
+		return errors.New("上班时间格式应为 YYYY-MM-DD HH:MM")
+	}
+	a.ClockIn = clockIn
+	a.WorkDate = clockIn.Format("2006-01-02")
+	a.ClockOut = nil
+	if in.ClockOut != "" {
+		clockOut, err := time.ParseInLocation("2006-01-02 15:04", in.ClockOut, time.Local)
+		if err != nil {
+			return errors.New("下班时间格式应为 YYYY-MM-DD HH:MM")
+		}
+		if !clockOut.After(clockIn) {
+			return errors.New("下班时间必须晚于上班时间")
+		}
+		a.ClockOut = &clockOut
+	}
+	if in.BreakMinutes < 0 {
+		return errors.New("休息分钟不能为负数")
+	}
+	a.BreakMinutes = in.BreakMinutes
+	a.BreakStartAt = nil
+	a.Remark = in.Remark
+	if in.ShiftID != nil {
+		if loadShift(in.ShiftID) == nil {
+			return errors.New("班次不存在")
+		}
+		a.ShiftID = in.ShiftID
+	}
+	return nil
+}
+
+// CreateAttendance 补录出勤
+func CreateAttendance(c *gin.Context) {
+	var input attendanceInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var worker models.Worker
+	if err := database.DB.First(&worker, input.WorkerID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "工人不存在"})
+		return
+	}
+
+	a := models.Attendance{WorkerID: worker.ID, Source: models.AttendanceManual}
+	if shift := workerShift(&worker); shift != nil {
+		a.ShiftID = &shift.ID
+	}
+	if err := input.apply(&a); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if a.Remark == "" {
+		a.Remark = "补录：" + c.GetString("username")
+	}
+	if err := database.DB.Create(&a).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, a)
+}
+
+// UpdateAttendance 修改出勤（如补打下班卡）
+func UpdateAttendance(c *gin.Context) {
+	var a models.Attendance
+	if err := database.DB.First(&a, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "出勤记录不存在"})
+		return
+	}
+	var input attendanceInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := input.apply(&a); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := database.DB.Omit("Worker", "Shift").Save(&a).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, a)
+}
+
+// DeleteAttendance 删除出勤记录
+func DeleteAttendance(c *gin.Context) {
+	if err := database.DB.Delete(&models.Attendance{}, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "出勤记录已删除"})
+}
+
+// ---------- 班次 ----------
+
+// GetShifts 获取班次列表
+func GetShifts(c *gin.Context) {
+	var shifts []models.Shift
+	database.DB.Order("start_time asc").Find(&shifts)
+	c.JSON(http.StatusOK, shifts)
+}
+
+// CreateShift 新增班次
+func CreateShift(c *gin.Context) {
+	var shift models.Shift
+	if err := c.ShouldBindJSON(&shift); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	shift.ID = 0
+	if err := validateShift(&shift); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := saveShift(&shift); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, shift)
+}
+
+// UpdateShift 修改班次，已有出勤按新班次重新计算迟到早退
+func UpdateShift(c *gin.Context) {
+	var shift models.Shift
+	if err := database.DB.First(&shift, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "班次不存在"})
+		return
+	}
+	var input models.Shift
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateShift(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	shift.Name = input.Name
+	shift.StartTime = input.StartTime
+	shift.EndTime = input.EndTime
+	shift.BreakStart = input.BreakStart
+	shift.BreakEnd = input.BreakEnd
+	shift.LateGrace = input.LateGrace
+	shift.IsDefault = input.IsDefault
+	shift.Remark = input.Remark
+	if err := saveShift(&shift); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, shift)
+}
+
+// DeleteShift 删除班次
+func DeleteShift(c *gin.Context) {
+	var shift models.Shift
+	if err := database.DB.First(&shift, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "班次不存在"})
+		return
+	}
+	var count int64
+	database.DB.Model(&models.Worker{}).Where("shift_id = ?", shift.ID).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "该班次已分配给工人，无法删除"})
+		return
+	}
+	database.DB.Delete(&shift)
+	c.JSON(http.StatusOK, gin.H{"message": "班次已删除"})
+}
+
+func validateShift(shift *models.Shift) error {
+	if shift.Name == "" {
+		return errors.New("班次名称不能为空")
+	}
+	if _, err := time.Parse("15:04", shift.StartTime); err != nil {
+		return errors.New("上班时间格式应为 HH:MM")
+	}
+	if _, err := time.Parse("15:04", shift.EndTime); err != nil {
+		return errors.New("下班时间格式应为 HH:MM")
+	}
+	if shift.BreakStart != "" || shift.BreakEnd != "" {
+		_, err1 := time.Parse("15:04", shift.BreakStart)
+		_, err2 := time.Parse("15:04", shift.BreakEnd)
+		if err1 != nil || err2 != nil {
+			return errors.New("休息时间格式应为 HH:MM")
+		}
+	}
+	if shift.LateGrace < 0 {
+		return errors.New("迟到宽限不能为负数")
+	}
+	return nil
+}
+
+// saveShift 保存班次，默认班次只能有一个
+func saveShift(shift *models.Shift) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if shift.IsDefault {
+			if err := tx.Model(&models.Shift{}).Where("is_default = ? AND id <> ?", true, shift.ID).Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Save(shift).Error
+	})
+}
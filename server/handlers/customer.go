@@ -11,7 +11,7 @@ import (
 // GetCustomers 获取客户列表
 func GetCustomers(c *gin.Context) {
 	var customers []models.Customer
-	query := database.DB.Model(&models.Customer{})
+	query := database.DB.Model(&models.Customer{}).Preload("PriceList")
 
 	// Search
 	q := c.Query("q")
@@ -65,6 +65,7 @@ func UpdateCustomer(c *gin.Context) {
 	customer.Phone = input.Phone
 	customer.Address = input.Address
 	customer.Remark = input.Remark
+	customer.PriceListID = input.PriceListID
 
 	if err := database.DB.Save(&customer).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
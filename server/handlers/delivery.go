@@ -0,0 +1,744 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"trace-server/database"
+	"trace-server/middleware"
+	"trace-server/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// 地址中的区县/乡镇，如 "广东省深圳市南山区科技园" 提取 "南山区"
+var areaPattern = regexp.MustCompile(`^(?:[^省]{2,8}省)?(?:[^市]{2,8}市)?([^区县镇乡]{1,8}[区县镇乡])`)
+
+// deliveryArea 从送货地址提取配送片区
+func deliveryArea(address string) string {
+	address = strings.ReplaceAll(strings.TrimSpace(address), " ", "")
+	if m := areaPattern.FindStringSubmatch(address); m != nil {
+		return m[1]
+	}
+	return "未分区"
+}
+
+// activeDeliveryOrders 已排入配送批次（待配送或已送达）的订单
+func activeDeliveryOrders(tx *gorm.DB) *gorm.DB {
+	return tx.Model(&models.DeliveryStop{}).
+		Select("order_id").
+		Where("status IN ?", []string{models.DeliveryStopPending, models.DeliveryStopDelivered})
+}
+
+// pendingDeliveryOrders 待送货且尚未排车的订单
+func pendingDeliveryOrders(tx *gorm.DB) *gorm.DB {
+	return tx.Model(&models.Order{}).
+		Where("status = ?", "待送货").
+		Where("id NOT IN (?)", activeDeliveryOrders(tx))
+}
+
+// loadDriver 校验司机：必须可在送货工位上岗（默认工位或已分配送货工位），与扫码校验一致
+func loadDriver(tx *gorm.DB, driverID *uint) error {
+	if driverID == nil || *driverID == 0 {
+		return nil
+	}
+	var driver models.Worker
+	if err := tx.First(&driver, *driverID).Error; err != nil {
+		return errors.New("司机不存在")
+	}
+	deliveryStation, ok := stationByCode(stationCodeDelivery)
+	if !ok {
+		return errors.New("送货工位不存在")
+	}
+	if _, ok := workerSkill(&driver, deliveryStation); !ok {
+		return errors.New(driver.Name + " 不是送货工位的工人")
+	}
+	return nil
+}
+
+// parseDeliveryDate 解析配送日期，默认当天
+func parseDeliveryDate(s string) (time.Time, error) {
+	if s == "" {
+		now := time.Now()
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local), nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return t, errors.New("配送日期格式错误，应为 YYYY-MM-DD")
+	}
+	return t, nil
+}
+
+// addDeliveryStops 将订单加入批次，订单必须待送货且未排车
+func addDeliveryStops(tx *gorm.DB, batch *models.DeliveryBatch, orderIDs []uint) error {
+	if len(orderIDs) == 0 {
+		return errors.New("请选择要配送的订单")
+	}
+	var orders []models.Order
+	if err := pendingDeliveryOrders(tx).Where("id IN ?", orderIDs).Find(&orders).Error; err != nil {
+		return err
+	}
+	if len(orders) != len(orderIDs) {
+		return errors.New("部分订单不是待送货状态或已排入其他配送批次")
+	}
+	byID := make(map[uint]models.Order, len(orders))
+	for _, o := range orders {
+		byID[o.ID] = o
+	}
+
+	var seq int64
+	tx.Model(&models.DeliveryStop{}).Where("batch_id = ?", batch.ID).Count(&seq)
+	for _, id := range orderIDs {
+		seq++
+		stop := models.DeliveryStop{
+			BatchID: batch.ID,
+			OrderID: id,
+			Seq:     int(seq),
+			Address: byID[id].Address,
+			Status:  models.DeliveryStopPending,
+		}
+		if err := tx.Create(&stop).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createDeliveryBatch 生成批次号并创建批次
+func createDeliveryBatch(tx *gorm.DB, batch *models.DeliveryBatch, orderIDs []uint) error {
+	if err := loadDriver(tx, batch.DriverID); err != nil {
+		return err
+	}
+	batchNo, err := nextSequence(tx, models.SequenceDelivery)
+	if err != nil {
+		return err
+	}
+	batch.BatchNo = batchNo
+	batch.Status = models.DeliveryBatchPending
+	if err := tx.Create(batch).Error; err != nil {
+		return err
+	}
+	return addDeliveryStops(tx, batch, orderIDs)
+}
+
+// loadDeliveryBatch 加载批次及站点（按配送顺序）
+func loadDeliveryBatch(id interface{}) (models.DeliveryBatch, error) {
+	var batch models.DeliveryBatch
+	err := database.DB.
+		Preload("Driver").
+		Preload("Stops", func(db *gorm.DB) *gorm.DB { return db.Order("seq asc, id asc") }).
+		Preload("Stops.Order").
+		Preload("Stops.Attachments", orderedAttachments).
+		First(&batch, id).Error
+	return batch, err
+}
+
+// GetPendingDeliveries 待送货订单按片区分组，用于排车
+func GetPendingDeliveries(c *gin.Context) {
+	var orders []models.Order
+	pendingDeliveryOrders(database.DB).Order("deadline asc, id asc").Find(&orders)
+
+	groups := make(map[string][]models.Order)
+	for _, o := range orders {
+		area := deliveryArea(o.Address)
+		groups[area] = append(groups[area], o)
+	}
+
+	result := make([]gin.H, 0, len(groups))
+	for area, list := range groups {
+		result = append(result, gin.H{"area": area, "count": len(list), "orders": list})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i]["area"].(string) < result[j]["area"].(string) })
+
+	c.JSON(http.StatusOK, gin.H{"data": result, "total": len(orders)})
+}
+
+// GetDeliveryBatches 配送批次列表
+func GetDeliveryBatches(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	offset := (page - 1) * pageSize
+
+	var batches []models.DeliveryBatch
+	var total int64
+	query := database.DB.Model(&models.DeliveryBatch{}).Preload("Driver").Preload("Stops")
+
+	if date := c.Query("date"); date != "" {
+		day, err := parseDeliveryDate(date)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		query = query.Where("delivery_date >= ? AND delivery_date < ?", day, day.AddDate(0, 0, 1))
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if driverID := c.Query("driver_id"); driverID != "" {
+		query = query.Where("driver_id = ?", driverID)
+	}
+	if area := c.Query("area"); area != "" {
+		query = query.Where("area = ?", area)
+	}
+
+	query.Count(&total)
+	query.Order("delivery_date desc, id desc").Offset(offset).Limit(pageSize).Find(&batches)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  batches,
+		"total": total,
+		"page":  page,
+	})
+}
+
+// GetDeliveryBatch 配送批次详情
+func GetDeliveryBatch(c *gin.Context) {
+	batch, err := loadDeliveryBatch(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "配送批次不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, batch)
+}
+
+// CreateDeliveryBatch 手动创建配送批次
+func CreateDeliveryBatch(c *gin.Context) {
+	var input struct {
+		DeliveryDate string `json:"delivery_date"` // YYYY-MM-DD，默认当天
+		Area         string `json:"area"`
+		DriverID     *uint  `json:"driver_id"`
+		Vehicle      string `json:"vehicle"`
+		Remark       string `json:"remark"`
+		OrderIDs     []uint `json:"order_ids"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	day, err := parseDeliveryDate(input.DeliveryDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	batch := models.DeliveryBatch{
+		DeliveryDate: day,
+		Area:         input.Area,
+		DriverID:     input.DriverID,
+		Vehicle:      input.Vehicle,
+		Remark:       input.Remark,
+	}
+	if batch.Area == "" && len(input.OrderIDs) > 0 {
+		var first models.Order
+		database.DB.First(&first, input.OrderIDs[0])
+		batch.Area = deliveryArea(first.Address)
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		return createDeliveryBatch(tx, &batch, input.OrderIDs)
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	batch, _ = loadDeliveryBatch(batch.ID)
+	c.JSON(http.StatusOK, batch)
+}
+
+// AutoCreateDeliveryBatches 将待送货订单按片区自动分批，每个片区一个批次
+func AutoCreateDeliveryBatches(c *gin.Context) {
+	var input struct {
+		DeliveryDate string   `json:"delivery_date"`
+		Areas        []string `json:"areas"` // 为空表示全部片区
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	day, err := parseDeliveryDate(input.DeliveryDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	wanted := make(map[string]bool, len(input.Areas))
+	for _, a := range input.Areas {
+		wanted[a] = true
+	}
+
+	var orders []models.Order
+	pendingDeliveryOrders(database.DB).Order("deadline asc, id asc").Find(&orders)
+	groups := make(map[string][]uint)
+	var areas []string
+	for _, o := range orders {
+		area := deliveryArea(o.Address)
+		if len(wanted) > 0 && !wanted[area] {
+			continue
+		}
+		if _, ok := groups[area]; !ok {
+			areas = append(areas, area)
+		}
+		groups[area] = append(groups[area], o.ID)
+	}
+	if len(areas) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "没有待排车的订单"})
+		return
+	}
+	sort.Strings(areas)
+
+	batchIDs := make([]uint, 0, len(areas))
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		for _, area := range areas {
+			batch := models.DeliveryBatch{DeliveryDate: day, Area: area}
+			if err := createDeliveryBatch(tx, &batch, groups[area]); err != nil {
+				return err
+			}
+			batchIDs = append(batchIDs, batch.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var batches []models.DeliveryBatch
+	database.DB.Preload("Stops").Where("id IN ?", batchIDs).Order("id asc").Find(&batches)
+	c.JSON(http.StatusOK, gin.H{"data": batches})
+}
+
+// UpdateDeliveryBatch 修改批次：日期、片区、司机、车辆、备注及站点顺序
+func UpdateDeliveryBatch(c *gin.Context) {
+	var batch models.DeliveryBatch
+	if err := database.DB.First(&batch, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "配送批次不存在"})
+		return
+	}
+	if batch.Status == models.DeliveryBatchCompleted {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "配送批次已完成，不能修改"})
+		return
+	}
+
+	var input struct {
+		DeliveryDate string `json:"delivery_date"`
+		Area         string `json:"area"`
+		DriverID     *uint  `json:"driver_id"`
+		Vehicle      string `json:"vehicle"`
+		Remark       string `json:"remark"`
+		StopIDs      []uint `json:"stop_ids"` // 按配送顺序排列的站点ID，可选
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.DeliveryDate != "" {
+		day, err := parseDeliveryDate(input.DeliveryDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		batch.DeliveryDate = day
+	}
+	if input.Area != "" {
+		batch.Area = input.Area
+	}
+	if batch.Status == models.DeliveryBatchOnRoute {
+		if input.DriverID != nil && (batch.DriverID == nil || *input.DriverID != *batch.DriverID) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "配送中的批次不能更换司机"})
+			return
+		}
+	} else {
+		batch.DriverID = input.DriverID
+	}
+	batch.Vehicle = input.Vehicle
+	batch.Remark = input.Remark
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := loadDriver(tx, batch.DriverID); err != nil {
+			return err
+		}
+		for i, stopID := range input.StopIDs {
+			result := tx.Model(&models.DeliveryStop{}).
+				Where("id = ? AND batch_id = ?", stopID, batch.ID).
+				Update("seq", i+1)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errors.New("站点不属于该配送批次")
+			}
+		}
+		return tx.Omit("Driver", "Stops").Save(&batch).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	batch, _ = loadDeliveryBatch(batch.ID)
+	c.JSON(http.StatusOK, batch)
+}
+
+// AddDeliveryStops 向待出车的批次追加订单
+func AddDeliveryStops(c *gin.Context) {
+	var batch models.DeliveryBatch
+	if err := database.DB.First(&batch, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "配送批次不存在"})
+		return
+	}
+	if batch.Status != models.DeliveryBatchPending {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "只有待出车的批次可以追加订单"})
+		return
+	}
+
+	var input struct {
+		OrderIDs []uint `json:"order_ids"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		return addDeliveryStops(tx, &batch, input.OrderIDs)
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	batch, _ = loadDeliveryBatch(batch.ID)
+	c.JSON(http.StatusOK, batch)
+}
+
+// RemoveDeliveryStop 从待出车的批次移除订单
+func RemoveDeliveryStop(c *gin.Context) {
+	var stop models.DeliveryStop
+	if err := database.DB.First(&stop, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "配送站点不存在"})
+		return
+	}
+	var batch models.DeliveryBatch
+	database.DB.First(&batch, stop.BatchID)
+	if batch.Status != models.DeliveryBatchPending {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "批次已出车，不能移除订单"})
+		return
+	}
+
+	database.DB.Delete(&stop)
+	c.JSON(http.StatusOK, gin.H{"message": "已移出配送批次"})
+}
+
+// DepartDeliveryBatch 司机出车，批次进入配送中
+func DepartDeliveryBatch(c *gin.Context) {
+	var batch models.DeliveryBatch
+	if err := database.DB.Preload("Stops").First(&batch, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "配送批次不存在"})
+		return
+	}
+	if batch.Status != models.DeliveryBatchPending {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "批次当前状态为 " + batch.Status + "，不能出车"})
+		return
+	}
+	if batch.DriverID == nil || *batch.DriverID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请先指派司机"})
+		return
+	}
+	if len(batch.Stops) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "批次中没有订单"})
+		return
+	}
+
+	now := time.Now()
+	database.DB.Model(&batch).Updates(map[string]interface{}{
+		"status":      models.DeliveryBatchOnRoute,
+		"departed_at": now,
+	})
+
+	batch, _ = loadDeliveryBatch(batch.ID)
+	c.JSON(http.StatusOK, batch)
+}
+
+// DeleteDeliveryBatch 删除未出车的批次，订单回到待排车
+func DeleteDeliveryBatch(c *gin.Context) {
+	var batch models.DeliveryBatch
+	if err := database.DB.First(&batch, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "配送批次不存在"})
+		return
+	}
+	if batch.Status != models.DeliveryBatchPending {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "批次已出车，不能删除"})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("batch_id = ?", batch.ID).Delete(&models.DeliveryStop{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&batch).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "配送批次已删除"})
+}
+
+// deliveryStopInput 站点签收/未送达登记
+type deliveryStopInput struct {
+	WorkerID     uint     `json:"-"`      // 司机端取自司机令牌，须为批次司机
+	Operator     string   `json:"-"`      // 登记人，记为签收凭证的上传人
+	Status       string   `json:"status"` // 已送达, 未送达
+	ReceiverName string   `json:"receiver_name"`
+	SignatureURL string   `json:"signature_url"`
+	Photos       []string `json:"photos"`
+	FailReason   string   `json:"fail_reason"`
+}
+
+// completeDeliveryStop 登记站点结果；送达时订单流转到待收款，全部站点结束后批次完成
+func completeDeliveryStop(stop *models.DeliveryStop, input *deliveryStopInput, driverOnly bool) error {
+	var batch models.DeliveryBatch
+	if err := database.DB.First(&batch, stop.BatchID).Error; err != nil {
+		return errors.New("配送批次不存在")
+	}
+	if driverOnly && (batch.DriverID == nil || *batch.DriverID != input.WorkerID) {
+		return errors.New("该订单不在您的配送批次中")
+	}
+	if batch.Status != models.DeliveryBatchOnRoute {
+		return errors.New("批次当前状态为 " + batch.Status + "，不能登记送达")
+	}
+	if stop.Status != models.DeliveryStopPending {
+		return errors.New("该站点已登记为 " + stop.Status)
+	}
+
+	// 签名和照片须先通过上传接口上传，签名排在附件首位
+	input.SignatureURL = strings.TrimSpace(input.SignatureURL)
+	proofs := make([]string, 0, len(input.Photos)+1)
+	if input.SignatureURL != "" {
+		proofs = append(proofs, input.SignatureURL)
+	}
+	for _, p := range input.Photos {
+		if p = strings.TrimSpace(p); p != "" {
+			proofs = append(proofs, p)
+		}
+	}
+	for _, url := range proofs {
+		if _, ok := uploadKey(url); !ok {
+			return errors.New("签名和照片须通过上传接口上传")
+		}
+	}
+	switch input.Status {
+	case models.DeliveryStopDelivered:
+		if len(proofs) == 0 {
+			return errors.New("送达需上传客户签名或送达照片")
+		}
+	case models.DeliveryStopFailed:
+		if input.FailReason == "" {
+			return errors.New("请填写未送达原因")
+		}
+	default:
+		return errors.New("无效的配送状态: " + input.Status)
+	}
+
+	now := time.Now()
+	stop.Status = input.Status
+	stop.ReceiverName = input.ReceiverName
+	stop.SignatureURL = input.SignatureURL
+	stop.FailReason = input.FailReason
+	if input.Status == models.DeliveryStopDelivered {
+		stop.DeliveredAt = &now
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Order", "Attachments").Save(stop).Error; err != nil {
+			return err
+		}
+		if _, err := syncAttachments(tx, models.AttachmentOwnerDelivery, stop.ID, proofs, input.Operator); err != nil {
+			return err
+		}
+		if input.SignatureURL != "" {
+			if err := tx.Model(&models.Attachment{}).
+				Where("owner_type = ? AND owner_id = ? AND url = ?", models.AttachmentOwnerDelivery, stop.ID, input.SignatureURL).
+				Update("caption", "客户签名").Error; err != nil {
+				return err
+			}
+		}
+
+		if input.Status == models.DeliveryStopDelivered {
+			// 与送货工位扫码相同：待送货 -> 待收款
+			result := tx.Model(&models.Order{}).
+				Where("id = ? AND status = ?", stop.OrderID, "待送货").
+				Updates(map[string]interface{}{"status": "待收款", "status_changed_at": now})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				station, ok := stationByCode(stationCodeDelivery)
+				if !ok {
+					station.Name = "送货"
+				}
+				process := models.Process{
+					OrderID:     stop.OrderID,
+					Station:     station.Name,
+					StationID:   station.ID,
+					Status:      "Completed",
+					WorkerID:    *batch.DriverID,
+					CompletedAt: now,
+				}
+				if err := tx.Create(&process).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		var open int64
+		tx.Model(&models.DeliveryStop{}).
+			Where("batch_id = ? AND status = ?", batch.ID, models.DeliveryStopPending).
+			Count(&open)
+		if open == 0 {
+			return tx.Model(&batch).Updates(map[string]interface{}{
+				"status":       models.DeliveryBatchCompleted,
+				"completed_at": now,
+			}).Error
+		}
+		return nil
+	})
+}
+
+// UpdateDeliveryStop 后台登记站点送达/未送达
+func UpdateDeliveryStop(c *gin.Context) {
+	var stop models.DeliveryStop
+	if err := database.DB.First(&stop, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "配送站点不存在"})
+		return
+	}
+
+	var input deliveryStopInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	input.Operator = c.GetString("username")
+
+	if err := completeDeliveryStop(&stop, &input, false); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	orderedAttachments(database.DB).
+		Where("owner_type = ? AND owner_id = ?", models.AttachmentOwnerDelivery, stop.ID).
+		Find(&stop.Attachments)
+	c.JSON(http.StatusOK, stop)
+}
+
+// DriverUpdateDeliveryStop 司机端登记签收（签名、照片先通过上传接口获取URL）
+func DriverUpdateDeliveryStop(c *gin.Context) {
+	var stop models.DeliveryStop
+	if err := database.DB.First(&stop, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "配送站点不存在"})
+		return
+	}
+
+	var input deliveryStopInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.WorkerID = c.GetUint("worker_id")
+	input.Operator = c.GetString("username")
+
+	if err := completeDeliveryStop(&stop, &input, true); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	orderedAttachments(database.DB).
+		Where("owner_type = ? AND owner_id = ?", models.AttachmentOwnerDelivery, stop.ID).
+		Find(&stop.Attachments)
+	c.JSON(http.StatusOK, stop)
+}
+
+// GetDriverDeliveries 司机当天（或指定日期）的配送任务，司机取自司机令牌
+func GetDriverDeliveries(c *gin.Context) {
+	day, err := parseDeliveryDate(c.Query("date"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var batches []models.DeliveryBatch
+	database.DB.
+		Preload("Stops", func(db *gorm.DB) *gorm.DB { return db.Order("seq asc, id asc") }).
+		Preload("Stops.Order").
+		Preload("Stops.Attachments", orderedAttachments).
+		Where("driver_id = ? AND delivery_date >= ? AND delivery_date < ?", c.GetUint("worker_id"), day, day.AddDate(0, 0, 1)).
+		Order("id asc").
+		Find(&batches)
+
+	c.JSON(http.StatusOK, gin.H{"data": batches})
+}
+
+// 司机令牌有效期
+const driverTokenTTL = 30 * 24 * time.Hour
+
+// IssueDriverToken 为司机签发司机端令牌，司机端凭令牌查看配送任务、上传签收凭证
+func IssueDriverToken(c *gin.Context) {
+	var worker models.Worker
+	if err := database.DB.First(&worker, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "工人不存在"})
+		return
+	}
+
+	expiresAt := time.Now().Add(driverTokenTTL)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"worker_id": worker.ID,
+		"username":  worker.Name,
+		"role":      middleware.RoleDriver,
+		"exp":       expiresAt.Unix(),
+	})
+	tokenString, err := token.SignedString(middleware.SecretKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成令牌失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"token":      tokenString,
+		"worker_id":  worker.ID,
+		"expires_at": expiresAt,
+	})
+}
+
+// RequireDriverWorker 司机令牌对应的工人须仍然存在，删除工人后令牌随即失效
+func RequireDriverWorker(c *gin.Context) {
+	var worker models.Worker
+	if err := database.DB.First(&worker, c.GetUint("worker_id")).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "司机不存在或已停用"})
+		return
+	}
+	c.Next()
+}
+
+// GetOrderDeliveries 订单的配送记录及签收凭证
+func GetOrderDeliveries(c *gin.Context) {
+	var stops []models.DeliveryStop
+	database.DB.Where("order_id = ?", c.Param("id")).Order("id asc").Find(&stops)
+
+	result := make([]gin.H, 0, len(stops))
+	for _, stop := range stops {
+		var batch models.DeliveryBatch
+		database.DB.Preload("Driver").First(&batch, stop.BatchID)
+		result = append(result, gin.H{
+			"stop":  stop,
+			"batch": batch,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"data": result})
+}
@@ -0,0 +1,640 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"trace-server/database"
+	"trace-server/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+)
+
+// 导出格式
+const (
+	exportXLSX = "xlsx"
+	exportCSV  = "csv"
+)
+
+// exportBatch 每批从数据库读取的行数，导出时不把全部数据读入内存
+const exportBatch = 500
+
+// 导出列的数据类型，决定 Excel 数字格式和 CSV 文本格式
+type exportKind int
+
+const (
+	exportText exportKind = iota
+	exportInt
+	exportNumber
+	exportMoney
+	exportDate
+	exportDateTime
+)
+
+type exportColumn struct {
+	Title string
+	Width float64
+	Kind  exportKind
+}
+
+// exporter 以流的方式输出表格：xlsx 可包含多个工作表，csv 只输出其中一个（由 sheet 参数选择，默认第一个）
+type exporter struct {
+	format string
+	cols   []exportColumn
+
+	file   *excelize.File
+	stream *excelize.StreamWriter
+	styles map[exportKind]int
+	header int
+	row    int
+
+	csv      *csv.Writer
+	csvSheet string
+	skip     bool // 当前工作表不在 csv 中输出
+}
+
+// newExporter 按 format 参数（xlsx 或 csv）创建导出，并写好下载响应头；name 为不含扩展名的文件名
+func newExporter(c *gin.Context, name string) (*exporter, error) {
+	e := &exporter{format: c.DefaultQuery("format", exportXLSX)}
+	filename := fmt.Sprintf("%s_%s.%s", name, time.Now().Format("20060102"), e.format)
+
+	switch e.format {
+	case exportXLSX:
+		e.file = excelize.NewFile()
+		if err := e.initStyles(); err != nil {
+			return nil, err
+		}
+		c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	case exportCSV:
+		e.csvSheet = c.Query("sheet")
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+	default:
+		return nil, errors.New("导出格式只支持 xlsx 或 csv")
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename*=UTF-8''%s", url.PathEscape(filename)))
+	if e.format == exportCSV {
+		// 带 BOM，Excel 打开 UTF-8 中文不乱码
+		c.Writer.WriteString("\xef\xbb\xbf")
+		e.csv = csv.NewWriter(c.Writer)
+	}
+	return e, nil
+}
+
+func (e *exporter) initStyles() error {
+	border := []excelize.Border{
+		{Type: "left", Color: "D9D9D9", Style: 1},
+		{Type: "right", Color: "D9D9D9", Style: 1},
+		{Type: "top", Color: "D9D9D9", Style: 1},
+		{Type: "bottom", Color: "D9D9D9", Style: 1},
+	}
+	header, err := e.file.NewStyle(&excelize.Style{
+		Font:      &excelize.Font{Bold: true},
+		Fill:      excelize.Fill{Type: "pattern", Color: []string{"EDEDED"}, Pattern: 1},
+		Alignment: &excelize.Alignment{Horizontal: "center", Vertical: "center"},
+		Border:    border,
+	})
+	if err != nil {
+		return err
+	}
+	e.header = header
+
+	dateFmt := "yyyy-mm-dd"
+	dateTimeFmt := "yyyy-mm-dd hh:mm"
+	formats := map[exportKind]*excelize.Style{
+		exportText:     {},
+		exportInt:      {NumFmt: 1}, // 0
+		exportNumber:   {NumFmt: 0}, // 常规，小数按实际位数显示
+		exportMoney:    {NumFmt: 4}, // #,##0.00
+		exportDate:     {CustomNumFmt: &dateFmt},
+		exportDateTime: {CustomNumFmt: &dateTimeFmt},
+	}
+	e.styles = make(map[exportKind]int, len(formats))
+	for kind, style := range formats {
+		style.Border = border
+		id, err := e.file.NewStyle(style)
+		if err != nil {
+			return err
+		}
+		e.styles[kind] = id
+	}
+	return nil
+}
+
+// sheet 开始一个新工作表并写入表头；key 供 csv 的 sheet 参数选择
+func (e *exporter) sheet(key, title string, cols []exportColumn) error {
+	e.cols = cols
+	e.row = 1
+
+	if e.format == exportCSV {
+		if e.csvSheet == "" {
+			e.csvSheet = key
+		}
+		e.skip = key != e.csvSheet
+		if e.skip {
+			return nil
+		}
+		titles := make([]string, len(cols))
+		for i, col := range cols {
+			titles[i] = col.Title
+		}
+		return e.csv.Write(titles)
+	}
+
+	if e.stream == nil {
+		if err := e.file.SetSheetName("Sheet1", title); err != nil {
+			return err
+		}
+	} else {
+		if err := e.stream.Flush(); err != nil {
+			return err
+		}
+		if _, err := e.file.NewSheet(title); err != nil {
+			return err
+		}
+	}
+	sw, err := e.file.NewStreamWriter(title)
+	if err != nil {
+		return err
+	}
+	e.stream = sw
+	for i, col := range cols {
+		width := col.Width
+		if width == 0 {
+			width = 12
+		}
+		if err := sw.SetColWidth(i+1, i+1, width); err != nil {
+			return err
+		}
+	}
+	// 冻结表头
+	if err := sw.SetPanes(&excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"}); err != nil {
+		return err
+	}
+	cells := make([]interface{}, len(cols))
+	for i, col := range cols {
+		cells[i] = excelize.Cell{StyleID: e.header, Value: col.Title}
+	}
+	return sw.SetRow("A1", cells, excelize.RowOpts{Height: 20})
+}
+
+// write 写入一行，值与列一一对应；nil、空时间表示空单元格
+func (e *exporter) write(values ...interface{}) error {
+	if e.skip {
+		return nil
+	}
+	e.row++
+	if e.format == exportCSV {
+		record := make([]string, len(e.cols))
+		for i, col := range e.cols {
+			if i < len(values) {
+				record[i] = exportString(col.Kind, values[i])
+			}
+		}
+		return e.csv.Write(record)
+	}
+
+	cells := make([]interface{}, len(e.cols))
+	for i, col := range e.cols {
+		var v interface{}
+		if i < len(values) {
+			v = exportValue(values[i])
+		}
+		// Excel 时间不带时区，按本地时间的钟面值写入
+		if t, ok := v.(time.Time); ok {
+			t = t.Local()
+			v = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+		}
+		cells[i] = excelize.Cell{StyleID: e.styles[col.Kind], Value: v}
+	}
+	cell, _ := excelize.CoordinatesToCellName(1, e.row)
+	return e.stream.SetRow(cell, cells)
+}
+
+// close 结束导出并输出文件
+func (e *exporter) close(c *gin.Context) error {
+	if e.format == exportCSV {
+		e.csv.Flush()
+		return e.csv.Error()
+	}
+	defer e.file.Close()
+	if err := e.stream.Flush(); err != nil {
+		return err
+	}
+	return e.file.Write(c.Writer)
+}
+
+// exportValue 统一空值：空时间和 nil 指针输出空单元格
+func exportValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case time.Time:
+		if t.IsZero() {
+			return nil
+		}
+	case *time.Time:
+		if t == nil || t.IsZero() {
+			return nil
+		}
+		return *t
+	}
+	return v
+}
+
+// csvSafe 以 = + - @ 制表符或回车开头的文本前加单引号，防止表格软件当作公式执行
+func csvSafe(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// exportString 按列类型格式化为 csv 文本
+func exportString(kind exportKind, v interface{}) string {
+	v = exportValue(v)
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return csvSafe(t)
+	case time.Time:
+		t = t.Local()
+		if kind == exportDate {
+			return t.Format("2006-01-02")
+		}
+		return t.Format("2006-01-02 15:04")
+	case float64:
+		if kind == exportMoney {
+			return strconv.FormatFloat(t, 'f', 2, 64)
+		}
+		return formatNumber(t)
+	default:
+		return fmt.Sprint(t)
+	}
+}
+
+// exportFailed 导出出错；已开始输出时无法再返回错误信息，只记录日志
+func exportFailed(c *gin.Context, err error) {
+	if c.Writer.Written() {
+		log.Printf("Export failed: %v\n", err)
+		return
+	}
+	c.Writer.Header().Del("Content-Disposition")
+	c.Writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// ExportOrders 导出订单（筛选、排序参数与订单列表相同），每行一条明细。
+// 订单金额等整单字段只写在该单第一行，求和时不会重复计算。
+func ExportOrders(c *gin.Context) {
+	query, err := applyOrderFilters(database.DB.Model(&models.Order{}), c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sorts, err := parseOrderSort(c.Query("sort"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	e, err := newExporter(c, "订单")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = e.sheet("orders", "订单明细", []exportColumn{
+		{Title: "订单号", Width: 16},
+		{Title: "下单时间", Width: 17, Kind: exportDateTime},
+		{Title: "状态", Width: 9},
+		{Title: "客户", Width: 12},
+		{Title: "电话", Width: 14},
+		{Title: "地址", Width: 30},
+		{Title: "交货日期", Width: 12, Kind: exportDate},
+		{Title: "订单金额", Kind: exportMoney},
+		{Title: "已收", Kind: exportMoney},
+		{Title: "未收", Kind: exportMoney},
+		{Title: "订单备注", Width: 24},
+		{Title: "产品", Width: 12},
+		{Title: "长", Width: 8, Kind: exportNumber},
+		{Title: "宽", Width: 8, Kind: exportNumber},
+		{Title: "高", Width: 8, Kind: exportNumber},
+		{Title: "数量", Width: 8, Kind: exportInt},
+		{Title: "单位", Width: 6},
+		{Title: "单价", Kind: exportMoney},
+		{Title: "优惠", Kind: exportMoney},
+		{Title: "金额", Kind: exportMoney},
+		{Title: "属性", Width: 30},
+	})
+	if err != nil {
+		exportFailed(c, err)
+		return
+	}
+
+	batches := applyOrderSort(query, sorts).
+		Preload("OrderProducts").
+		Preload("OrderProducts.Product").
+		Session(&gorm.Session{})
+	for offset := 0; ; offset += exportBatch {
+		var orders []models.Order
+		if err := batches.Offset(offset).Limit(exportBatch).Find(&orders).Error; err != nil {
+			exportFailed(c, err)
+			return
+		}
+		for i := range orders {
+			if err := writeOrderRows(e, &orders[i]); err != nil {
+				exportFailed(c, err)
+				return
+			}
+		}
+		if len(orders) < exportBatch {
+			break
+		}
+	}
+	if err := e.close(c); err != nil {
+		exportFailed(c, err)
+	}
+}
+
+func writeOrderRows(e *exporter, o *models.Order) error {
+	head := []interface{}{o.OrderNo, o.CreatedAt, o.Status, o.CustomerName, o.Phone, o.Address, o.Deadline,
+		o.Amount, o.PaidAmount, orderBalance(o), o.Remark}
+	if len(o.OrderProducts) == 0 {
+		return e.write(head...)
+	}
+	for i, op := range o.OrderProducts {
+		row := append([]interface{}{}, head...)
+		if i > 0 {
+			row[7], row[8], row[9] = nil, nil, nil
+		}
+		row = append(row, orderLineName(op), op.Length, op.Width, op.Height, op.Quantity, orderLineUnit(op),
+			op.UnitPrice, op.Discount, op.TotalPrice, strings.Join(orderLineAttrs(op.ExtraAttrs), "；"))
+		if err := e.write(row...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExportWorkerStats 导出工人工作量（日期范围、工人参数与工作量统计相同）。
+// xlsx 含汇总、每日、扫码明细三个工作表；csv 用 sheet=summary|daily|detail 选择。
+// 件数为扫码订单的明细数量合计。
+func ExportWorkerStats(c *gin.Context) {
+	_, _, start, end := workerStatsRange(c)
+	workerID := c.Query("worker_id")
+	e, err := newExporter(c, "工人工作量")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	scoped := func() *gorm.DB {
+		q := database.DB.Model(&models.Process{}).
+			Joins("left join workers on workers.id = processes.worker_id").
+			Joins(processPiecesJoin).
+			Joins(processStationJoin).
+			Where("processes.created_at >= ? AND processes.created_at < ?", start, end)
+		if workerID != "" {
+			q = q.Where("processes.worker_id = ?", workerID)
+		}
+		return q
+	}
+
+	// 1. 汇总
+	var totals []struct {
+		WorkerName string
+		Station    string
+		Count      int64
+		Pieces     int64
+	}
+	scoped().
+		Select("workers.name as worker_name, " + processStationName + " as station, count(*) as count, coalesce(sum(oq.qty), 0) as pieces").
+		Group("processes.worker_id, workers.name, " + processStationName).
+		Order("workers.name, station").
+		Scan(&totals)
+	err = e.sheet("summary", "汇总", []exportColumn{
+		{Title: "工人", Width: 12},
+		{Title: "工位", Width: 12},
+		{Title: "扫码次数", Kind: exportInt},
+		{Title: "件数", Kind: exportInt},
+	})
+	for _, t := range totals {
+		if err != nil {
+			break
+		}
+		err = e.write(t.WorkerName, t.Station, t.Count, t.Pieces)
+	}
+	if err != nil {
+		exportFailed(c, err)
+		return
+	}
+
+	// 2. 每日
+	var daily []struct {
+		Day        string
+		WorkerName string
+		Station    string
+		Count      int64
+		Pieces     int64
+	}
+	scoped().
+		Select("date(processes.created_at) as day, workers.name as worker_name, " + processStationName + " as station, count(*) as count, coalesce(sum(oq.qty), 0) as pieces").
+		Group("date(processes.created_at), processes.worker_id, workers.name, " + processStationName).
+		Order("day, workers.name, station").
+		Scan(&daily)
+	err = e.sheet("daily", "每日", []exportColumn{
+		{Title: "日期", Width: 12},
+		{Title: "工人", Width: 12},
+		{Title: "工位", Width: 12},
+		{Title: "扫码次数", Kind: exportInt},
+		{Title: "件数", Kind: exportInt},
+	})
+	for _, d := range daily {
+		if err != nil {
+			break
+		}
+		err = e.write(exportDay(d.Day), d.WorkerName, d.Station, d.Count, d.Pieces)
+	}
+	if err != nil {
+		exportFailed(c, err)
+		return
+	}
+
+	// 3. 扫码明细
+	err = e.sheet("detail", "扫码明细", []exportColumn{
+		{Title: "时间", Width: 17, Kind: exportDateTime},
+		{Title: "工人", Width: 12},
+		{Title: "工位", Width: 12},
+		{Title: "订单号", Width: 16},
+		{Title: "客户", Width: 12},
+		{Title: "产品", Width: 30},
+		{Title: "件数", Kind: exportInt},
+	})
+	if err != nil {
+		exportFailed(c, err)
+		return
+	}
+	if !e.skip {
+		batches := scoped().
+			Joins("left join orders on orders.id = processes.order_id").
+			Select("processes.created_at, workers.name as worker_name, processes.station, processes.order_id, orders.order_no, orders.customer_name, coalesce(oq.qty, 0) as pieces").
+			Order("processes.created_at, processes.id").
+			Session(&gorm.Session{})
+		for offset := 0; ; offset += exportBatch {
+			var rows []struct {
+				CreatedAt    time.Time
+				WorkerName   string
+				Station      string
+				OrderID      uint
+				OrderNo      string
+				CustomerName string
+				Pieces       int64
+			}
+			if err := batches.Offset(offset).Limit(exportBatch).Scan(&rows).Error; err != nil {
+				exportFailed(c, err)
+				return
+			}
+			orderIDs := make([]uint, 0, len(rows))
+			for _, r := range rows {
+				orderIDs = append(orderIDs, r.OrderID)
+			}
+			products := orderProductNames(orderIDs)
+			for _, r := range rows {
+				if err := e.write(r.CreatedAt, r.WorkerName, r.Station, r.OrderNo, r.CustomerName, products[r.OrderID], r.Pieces); err != nil {
+					exportFailed(c, err)
+					return
+				}
+			}
+			if len(rows) < exportBatch {
+				break
+			}
+		}
+	}
+	if err := e.close(c); err != nil {
+		exportFailed(c, err)
+	}
+}
+
+// orderProductNames 订单的产品摘要，如 "榻榻米垫×2, 回弹棉×1"
+func orderProductNames(orderIDs []uint) map[uint]string {
+	names := make(map[uint]string)
+	if len(orderIDs) == 0 {
+		return names
+	}
+	var items []models.OrderProduct
+	database.DB.Preload("Product").Where("order_id IN ?", orderIDs).Order("id").Find(&items)
+	for _, op := range items {
+		if names[op.OrderID] != "" {
+			names[op.OrderID] += ", "
+		}
+		names[op.OrderID] += fmt.Sprintf("%s×%d", orderLineName(op), op.Quantity)
+	}
+	return names
+}
+
+// exportDay 分组日期统一为 2006-01-02（MySQL 返回带时间的值）
+func exportDay(s string) string {
+	if len(s) > 10 {
+		return s[:10]
+	}
+	return s
+}
+
+// ExportCustomers 导出客户列表（q 参数与客户列表相同），附订单数和应收汇总
+func ExportCustomers(c *gin.Context) {
+	query := database.DB.Model(&models.Customer{}).Preload("PriceList")
+	if q := c.Query("q"); q != "" {
+		wildcard := "%" + q + "%"
+		query = query.Where("name LIKE ? OR phone LIKE ?", wildcard, wildcard)
+	}
+	e, err := newExporter(c, "客户")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = e.sheet("customers", "客户", []exportColumn{
+		{Title: "客户", Width: 12},
+		{Title: "电话", Width: 14},
+		{Title: "地址", Width: 30},
+		{Title: "价目表", Width: 12},
+		{Title: "订单数", Width: 8, Kind: exportInt},
+		{Title: "订单金额", Kind: exportMoney},
+		{Title: "已收", Kind: exportMoney},
+		{Title: "未收", Kind: exportMoney},
+		{Title: "最近下单", Width: 12, Kind: exportDate},
+		{Title: "备注", Width: 24},
+		{Title: "登记时间", Width: 12, Kind: exportDate},
+	})
+	if err != nil {
+		exportFailed(c, err)
+		return
+	}
+
+	batches := query.Order("id asc").Session(&gorm.Session{})
+	for offset := 0; ; offset += exportBatch {
+		var customers []models.Customer
+		if err := batches.Offset(offset).Limit(exportBatch).Find(&customers).Error; err != nil {
+			exportFailed(c, err)
+			return
+		}
+		ids := make([]uint, len(customers))
+		for i, cust := range customers {
+			ids[i] = cust.ID
+		}
+		var sums []struct {
+			CustomerID uint
+			Orders     int64
+			Amount     float64
+			Paid       float64
+		}
+		var lastOrders []models.Order
+		if len(ids) > 0 {
+			database.DB.Model(&models.Order{}).
+				Select("customer_id, count(*) as orders, sum(amount) as amount, sum(paid_amount) as paid").
+				Where("customer_id IN ?", ids).
+				Group("customer_id").
+				Scan(&sums)
+			latest := database.DB.Model(&models.Order{}).Select("max(id)").Where("customer_id IN ?", ids).Group("customer_id")
+			database.DB.Select("customer_id, created_at").Where("id IN (?)", latest).Find(&lastOrders)
+		}
+		sumByCustomer := make(map[uint]int, len(sums))
+		for i, s := range sums {
+			sumByCustomer[s.CustomerID] = i
+		}
+		lastByCustomer := make(map[uint]time.Time, len(lastOrders))
+		for _, o := range lastOrders {
+			lastByCustomer[o.CustomerID] = o.CreatedAt
+		}
+
+		for _, cust := range customers {
+			var orders int64
+			var amount, paid float64
+			if i, ok := sumByCustomer[cust.ID]; ok {
+				orders, amount, paid = sums[i].Orders, roundMoney(sums[i].Amount), roundMoney(sums[i].Paid)
+			}
+			priceList := ""
+			if cust.PriceList != nil {
+				priceList = cust.PriceList.Name
+			}
+			err := e.write(cust.Name, cust.Phone, cust.Address, priceList, orders, amount, paid, roundMoney(amount-paid),
+				lastByCustomer[cust.ID], cust.Remark, cust.CreatedAt)
+			if err != nil {
+				exportFailed(c, err)
+				return
+			}
+		}
+		if len(customers) < exportBatch {
+			break
+		}
+	}
+	if err := e.close(c); err != nil {
+		exportFailed(c, err)
+	}
+}
@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+	"trace-server/database"
+	"trace-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// durationStats 一组时长（小时）的分布
+type durationStats struct {
+	Count int     `json:"count"`
+	Avg   float64 `json:"avg"`
+	P50   float64 `json:"p50"`
+	P75   float64 `json:"p75"`
+	P90   float64 `json:"p90"`
+	Max   float64 `json:"max"`
+}
+
+func summarizeHours(hours []float64) durationStats {
+	s := durationStats{Count: len(hours)}
+	if len(hours) == 0 {
+		return s
+	}
+	sort.Float64s(hours)
+	sum := 0.0
+	for _, h := range hours {
+		sum += h
+	}
+	round := func(v float64) float64 { return math.Round(v*10) / 10 }
+	s.Avg = round(sum / float64(len(hours)))
+	s.P50 = round(percentile(hours, 50))
+	s.P75 = round(percentile(hours, 75))
+	s.P90 = round(percentile(hours, 90))
+	s.Max = round(hours[len(hours)-1])
+	return s
+}
+
+// percentile 已排序数据的百分位数（线性插值）
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(rank-float64(lo))
+}
+
+// leadTimePeriod 趋势分组：day 按天，week 按周（周一开始），month 按月
+func leadTimePeriod(t time.Time, group string) string {
+	switch group {
+	case "week":
+		offset := (int(t.Weekday()) + 6) % 7
+		return t.AddDate(0, 0, -offset).Format("2006-01-02")
+	case "month":
+		return t.Format("2006-01")
+	}
+	return t.Format("2006-01-02")
+}
+
+// leadTimeMaxDays 生产周期分析的最大日期跨度（天）
+const leadTimeMaxDays = 366
+
+// processTime 工序完成时间，旧记录没有完成时间时取创建时间
+func processTime(p models.Process) time.Time {
+	if p.CompletedAt.IsZero() {
+		return p.CreatedAt
+	}
+	return p.CompletedAt
+}
+
+// GetLeadTimeStats 生产周期分析：时间段内完成的订单从下单到已完成的总周期、各工位停留时间，
+// 按产品和按时间段的分布（小时）。完成时间为订单进入已完成状态的时间
+func GetLeadTimeStats(c *gin.Context) {
+	startDate := c.DefaultQuery("start_date", time.Now().AddDate(0, 0, -29).Format("2006-01-02"))
+	endDate := c.DefaultQuery("end_date", time.Now().Format("2006-01-02"))
+	start, err1 := time.ParseInLocation("2006-01-02", startDate, time.Local)
+	end, err2 := time.ParseInLocation("2006-01-02", endDate, time.Local)
+	if err1 != nil || err2 != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "日期格式应为 YYYY-MM-DD"})
+		return
+	}
+	if end.Before(start) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "结束日期不能早于开始日期"})
+		return
+	}
+	end = end.AddDate(0, 0, 1)
+	if end.After(start.AddDate(0, 0, leadTimeMaxDays)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("日期范围不能超过 %d 天", leadTimeMaxDays)})
+		return
+	}
+	group := c.DefaultQuery("group", "day")
+	if group != "day" && group != "week" && group != "month" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group 应为 day、week 或 month"})
+		return
+	}
+
+	// 时间段内进入已完成状态的订单
+	query := database.DB.Model(&models.Order{}).
+		Where("status = ? AND status_changed_at >= ? AND status_changed_at < ?", "已完成", start, end)
+	if productID := c.Query("product_id"); productID != "" {
+		query = query.Where("id IN (?)", database.DB.Model(&models.OrderProduct{}).Select("order_id").Where("product_id = ?", productID))
+	}
+	var orders []models.Order
+	query.Select("id, created_at, status_changed_at").Find(&orders)
+
+	ids := make([]uint, 0, len(orders))
+	for _, o := range orders {
+		ids = append(ids, o.ID)
+	}
+	processes := map[uint][]models.Process{}
+	orderProducts := map[uint][]uint{}
+	for i := 0; i < len(ids); i += exportBatch {
+		batch := ids[i:min(i+exportBatch, len(ids))]
+		var list []models.Process
+		database.DB.Select("order_id, station, station_id, completed_at, created_at").Where("order_id IN ?", batch).Order("id asc").Find(&list)
+		for _, p := range list {
+			processes[p.OrderID] = append(processes[p.OrderID], p)
+		}
+		var ops []models.OrderProduct
+		database.DB.Select("order_id, product_id").Where("order_id IN ?", batch).Find(&ops)
+		for _, op := range ops {
+			orderProducts[op.OrderID] = append(orderProducts[op.OrderID], op.ProductID)
+		}
+	}
+
+	// 工位按 station_id 归组，工位改名后仍是同一工位；旧记录没有 station_id 时按名称、别名匹配
+	stations := loadStationIndex(database.DB)
+	stationKey := func(p models.Process) string {
+		for i := range stations {
+			if stations[i].ID == p.StationID {
+				return stations[i].Name
+			}
+		}
+		return stations.canonical(p.Station)
+	}
+
+	var leadHours []float64
+	stageHours := map[string][]float64{}
+	productHours := map[uint][]float64{}
+	periodHours := map[string][]float64{}
+	for _, o := range orders {
+		if o.StatusChangedAt == nil {
+			continue
+		}
+		completedAt := *o.StatusChangedAt
+
+		// 工位停留时间：上一道工序完成（或下单）到本工位扫码完成
+		prev := o.CreatedAt
+		for _, p := range processes[o.ID] {
+			done := processTime(p)
+			name := stationKey(p)
+			stageHours[name] = append(stageHours[name], done.Sub(prev).Hours())
+			prev = done
+		}
+
+		lead := completedAt.Sub(o.CreatedAt).Hours()
+		leadHours = append(leadHours, lead)
+		period := leadTimePeriod(completedAt, group)
+		periodHours[period] = append(periodHours[period], lead)
+		seen := map[uint]bool{}
+		for _, pid := range orderProducts[o.ID] {
+			if !seen[pid] {
+				seen[pid] = true
+				productHours[pid] = append(productHours[pid], lead)
+			}
+		}
+	}
+
+	// 按工位顺序输出，工位表之外的旧工位名排在最后
+	type stageRow struct {
+		Station string `json:"station"`
+		durationStats
+	}
+	stages := make([]stageRow, 0, len(stageHours))
+	for _, s := range stations {
+		if hours, ok := stageHours[s.Name]; ok {
+			stages = append(stages, stageRow{Station: s.Name, durationStats: summarizeHours(hours)})
+			delete(stageHours, s.Name)
+		}
+	}
+	rest := make([]string, 0, len(stageHours))
+	for name := range stageHours {
+		rest = append(rest, name)
+	}
+	sort.Strings(rest)
+	for _, name := range rest {
+		stages = append(stages, stageRow{Station: name, durationStats: summarizeHours(stageHours[name])})
+	}
+
+	type productRow struct {
+		ProductID   uint   `json:"product_id"`
+		ProductName string `json:"product_name"`
+		durationStats
+	}
+	productIDs := make([]uint, 0, len(productHours))
+	for id := range productHours {
+		productIDs = append(productIDs, id)
+	}
+	var productList []models.Product
+	if len(productIDs) > 0 {
+		database.DB.Unscoped().Where("id IN ?", productIDs).Find(&productList)
+	}
+	names := map[uint]string{}
+	for _, p := range productList {
+		names[p.ID] = p.Name
+	}
+	products := make([]productRow, 0, len(productIDs))
+	for _, id := range productIDs {
+		products = append(products, productRow{ProductID: id, ProductName: names[id], durationStats: summarizeHours(productHours[id])})
+	}
+	sort.Slice(products, func(i, j int) bool {
+		if products[i].Count != products[j].Count {
+			return products[i].Count > products[j].Count
+		}
+		return products[i].ProductID < products[j].ProductID
+	})
+
+	// 趋势：每个时间段一行，没有完成订单的时间段也列出
+	type trendRow struct {
+		Period string `json:"period"`
+		durationStats
+	}
+	trend := make([]trendRow, 0)
+	for d, last := start, ""; d.Before(end); d = d.AddDate(0, 0, 1) {
+		period := leadTimePeriod(d, group)
+		if period == last {
+			continue
+		}
+		last = period
+		trend = append(trend, trendRow{Period: period, durationStats: summarizeHours(periodHours[period])})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"lead_time": summarizeHours(leadHours),
+		"stages":    stages,
+		"products":  products,
+		"trend":     trend,
+		"group":     group,
+		"date_range": gin.H{
+			"start": startDate,
+			"end":   endDate,
+		},
+	})
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	cases := []struct {
+		sorted []float64
+		p      float64
+		want   float64
+	}{
+		{[]float64{5}, 50, 5},
+		{[]float64{5}, 90, 5},
+		{[]float64{1, 2}, 0, 1},
+		{[]float64{1, 2}, 100, 2},
+		{[]float64{1, 2}, 50, 1.5},
+		{[]float64{1, 2, 3, 4}, 50, 2.5},
+		{[]float64{1, 2, 3, 4, 5}, 50, 3},
+		{[]float64{1, 2, 3, 4, 5}, 75, 4},
+		{[]float64{10, 20, 30, 40}, 90, 37},
+		{[]float64{0, 0, 0, 100}, 90, 70},
+	}
+	for _, tc := range cases {
+		if got := percentile(tc.sorted, tc.p); math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("percentile(%v, %v) = %v; want %v", tc.sorted, tc.p, got, tc.want)
+		}
+	}
+}
+
+func TestSummarizeHours(t *testing.T) {
+	if s := summarizeHours(nil); s != (durationStats{}) {
+		t.Errorf("summarizeHours(nil) = %+v", s)
+	}
+	s := summarizeHours([]float64{4, 1, 3, 2})
+	want := durationStats{Count: 4, Avg: 2.5, P50: 2.5, P75: 3.3, P90: 3.7, Max: 4}
+	if s != want {
+		t.Errorf("summarizeHours = %+v; want %+v", s, want)
+	}
+}
+
+func TestLeadTimePeriod(t *testing.T) {
+	day := func(s string) time.Time {
+		d, err := time.ParseInLocation("2006-01-02 15:04", s, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	cases := []struct {
+		at    string
+		group string
+		want  string
+	}{
+		{"2024-03-06 10:00", "day", "2024-03-06"},
+		{"2024-03-06 10:00", "", "2024-03-06"},
+		{"2024-03-06 10:00", "unknown", "2024-03-06"},
+		// 按周以周一开始
+		{"2024-03-04 00:00", "week", "2024-03-04"}, // 周一
+		{"2024-03-06 10:00", "week", "2024-03-04"}, // 周三
+		{"2024-03-10 23:59", "week", "2024-03-04"}, // 周日
+		{"2024-03-11 00:00", "week", "2024-03-11"},
+		{"2024-01-03 08:00", "week", "2024-01-01"},
+		{"2023-01-01 08:00", "week", "2022-12-26"}, // 跨年
+		{"2024-03-01 00:00", "week", "2024-02-26"}, // 跨月
+		{"2024-03-06 10:00", "month", "2024-03"},
+		{"2024-12-31 23:59", "month", "2024-12"},
+	}
+	for _, tc := range cases {
+		if got := leadTimePeriod(day(tc.at), tc.group); got != tc.want {
+			t.Errorf("leadTimePeriod(%s, %q) = %s; want %s", tc.at, tc.group, got, tc.want)
+		}
+	}
+}
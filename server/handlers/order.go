@@ -1,11 +1,13 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
-	"math/rand"
+	"math"
 	"net/http"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 	"trace-server/database"
 	"trace-server/models"
@@ -16,47 +18,26 @@ import (
 
 // CreateOrder 创建新订单
 func CreateOrder(c *gin.Context) {
-	type OrderItemInput struct {
-		ProductID  uint    `json:"product_id"`
-		Length     float64 `json:"length"`
-		Width      float64 `json:"width"`
-		Height     float64 `json:"height"`
-		Quantity   int     `json:"quantity"`
-		Unit       string  `json:"unit"`        // 计量单位
-		UnitPrice  float64 `json:"unit_price"`
-		ExtraAttrs string  `json:"extra_attrs"` // 额外属性值 JSON
-	}
-
 	var input struct {
 		models.Order
-		Items       []OrderItemInput `json:"items"`
-		DeadlineStr string           `json:"deadline_str"`
+		Items          []OrderItemInput `json:"items"`
+		DeadlineStr    string           `json:"deadline_str"`
+		AttachmentURLs []string         `json:"attachment_urls"` // 已上传的附件URL
 	}
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// 验证必填项
-	if input.CustomerName == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "客户姓名不能为空"})
-		return
-	}
-	if input.Phone == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "联系电话不能为空"})
-		return
-	}
-	if input.Amount <= 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "订单金额必须大于0"})
-		return
-	}
-	if len(input.Items) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "必须选择至少一个产品"})
-		return
-	}
-
+	// 拆单、合并、售后关联和生产记录只能由对应流程写入，不接受客户端提交
 	order := input.Order
-	order.Status = "待下料" // 初始状态
+	order.Model = gorm.Model{}
+	order.ParentID = nil
+	order.MergedIntoID = nil
+	order.AfterSaleID = nil
+	order.Children = nil
+	order.Processes = nil
+	order.Attachments = nil
 
 	if input.DeadlineStr != "" {
 		// Assuming format YYYY-MM-DD
@@ -66,66 +47,141 @@ func CreateOrder(c *gin.Context) {
 		}
 	}
 
-	// 关联产品 (使用 OrderProduct)
-	if len(input.Items) > 0 {
-		var orderProducts []models.OrderProduct
-		for _, item := range input.Items {
-			// Calculate total price for this line item
-			total := item.UnitPrice * float64(item.Quantity)
-			op := models.OrderProduct{
-				ProductID:  item.ProductID,
-				Length:     item.Length,
-				Width:      item.Width,
-				Height:     item.Height,
-				Quantity:   item.Quantity,
-				Unit:       item.Unit,
-				UnitPrice:  item.UnitPrice,
-				TotalPrice: total,
-				ExtraAttrs: item.ExtraAttrs,
-			}
-			orderProducts = append(orderProducts, op)
+	if err := prepareOrder(&order, input.Items); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 保存到数据库
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := createOrder(tx, &order); err != nil {
+			return err
 		}
-		order.OrderProducts = orderProducts
+		_, err := syncAttachments(tx, models.AttachmentOwnerOrder, order.ID, input.AttachmentURLs, c.GetString("username"))
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	// OrderNo generation logic...
-	now := time.Now()
-	timestamp := now.Format("20060102150405")
-	randomPart := rand.Intn(900000) + 100000 // 6位随机数
-	order.OrderNo = fmt.Sprintf("ORD-%s-%06d", timestamp, randomPart)
-
-	// Check if customer exists, if not create
-	var existingCustomer models.Customer
-	if err := database.DB.Where("phone = ?", order.Phone).First(&existingCustomer).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			newCustomer := models.Customer{
-				Name:  order.CustomerName,
-				Phone: order.Phone,
-			}
-			database.DB.Create(&newCustomer)
+	orderedAttachments(database.DB).
+		Where("owner_type = ? AND owner_id = ?", models.AttachmentOwnerOrder, order.ID).
+		Find(&order.Attachments)
+	c.JSON(http.StatusOK, order)
+}
+
+// prepareOrder 校验新订单并生成明细和金额（关联客户、按价目表取价、计算折扣）。
+// 手工创建、复制、模板下单、批量导入共用此逻辑。
+func prepareOrder(order *models.Order, items []OrderItemInput) error {
+	if err := validateOrderInput(order, items); err != nil {
+		return err
+	}
+
+	// 老客户按其价目表取价；新客户在保存订单时一并创建
+	var customer models.Customer
+	database.DB.Where("phone = ?", order.Phone).First(&customer)
+	return priceOrder(order, &customer, items)
+}
+
+// validateOrderInput 校验新订单必填项
+func validateOrderInput(order *models.Order, items []OrderItemInput) error {
+	if order.CustomerName == "" {
+		return errors.New("客户姓名不能为空")
+	}
+	if order.Phone == "" {
+		return errors.New("联系电话不能为空")
+	}
+	if len(items) == 0 {
+		return errors.New("必须选择至少一个产品")
+	}
+	return validateDiscount(order.DiscountType, order.DiscountValue)
+}
+
+// priceOrder 关联客户并计算明细和订单金额
+func priceOrder(order *models.Order, customer *models.Customer, items []OrderItemInput) error {
+	order.CustomerID = customer.ID
+
+	// 关联产品 (使用 OrderProduct)，未填单价的按客户价目表取价
+	orderProducts, subtotal, err := buildOrderProducts(items, resolvePriceListID(customer))
+	if err != nil {
+		return err
+	}
+	order.OrderProducts = orderProducts
+
+	// 明细无单价时沿用手工填写的订单金额
+	if subtotal <= 0 {
+		subtotal = order.Amount
+	}
+	applyOrderDiscount(order, subtotal)
+	if order.Amount <= 0 {
+		return errors.New("订单金额必须大于0")
+	}
+	return nil
+}
+
+// findOrCreateCustomer 按手机号查找客户，不存在则创建
+func findOrCreateCustomer(tx *gorm.DB, name, phone string) (models.Customer, error) {
+	var customer models.Customer
+	err := tx.Where("phone = ?", phone).First(&customer).Error
+	if err == gorm.ErrRecordNotFound {
+		customer = models.Customer{
+			Name:  name,
+			Phone: phone,
 		}
-	} else {
-		// Update name if different? Optional. Let's just create if missing for now.
+		err = tx.Create(&customer).Error
 	}
+	return customer, err
+}
 
-	// 保存到数据库
-	if err := database.DB.Create(&order).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+// setOrderStatus 修改订单状态并记录进入该状态的时间，在制品看板和生产周期按此计算
+func setOrderStatus(order *models.Order, status string) {
+	if order.Status == status && order.StatusChangedAt != nil {
 		return
 	}
+	now := time.Now()
+	order.Status = status
+	order.StatusChangedAt = &now
+}
+
+// createOrder 保存新订单并进入生产流程（初始状态、订单号、扫码标识），需在事务内调用。
+// 未关联客户时按手机号查找或创建客户，订单保存失败时一并回滚。
+func createOrder(tx *gorm.DB, order *models.Order) error {
+	order.StatusChangedAt = nil
+	setOrderStatus(order, "待下料") // 初始状态
+	order.PaidAmount = 0
+
+	if order.CustomerID == 0 {
+		customer, err := findOrCreateCustomer(tx, order.CustomerName, order.Phone)
+		if err != nil {
+			return err
+		}
+		order.CustomerID = customer.ID
+	}
+
+	// 订单号由编号规则在同一事务内生成，保证唯一且连续
+	orderNo, err := nextSequence(tx, models.SequenceOrder)
+	if err != nil {
+		return err
+	}
+	order.OrderNo = orderNo
+
+	if err := tx.Create(order).Error; err != nil {
+		return err
+	}
 
 	// 生成用于扫码的标识符（不含域名，方便跨网络测试）
 	order.QRCode = fmt.Sprintf("ORDER-%d", order.ID)
-	database.DB.Save(&order)
-
-	c.JSON(http.StatusOK, order)
+	return tx.Model(order).Update("qr_code", order.QRCode).Error
 }
 
 // GetOrders 获取订单列表（支持筛选和搜索）
 func GetOrders(c *gin.Context) {
-	status := c.DefaultQuery("status", "")
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	// 游标分页取 pageSize+1 条判断是否还有下一页，页大小须至少为1
+	page = max(page, 1)
+	pageSize = min(max(pageSize, 1), 100)
 	offset := (page - 1) * pageSize
 
 	var orders []models.Order
@@ -135,20 +191,64 @@ func GetOrders(c *gin.Context) {
 	query := database.DB.Model(&models.Order{}).
 		Preload("OrderProducts").
 		Preload("OrderProducts.Product").
-		Preload("OrderProducts.Product.Attributes")
-	if status != "" {
-		query = query.Where("status = ?", status)
+		Preload("OrderProducts.Product.Attributes").
+		Preload("Attachments", orderedAttachments)
+
+	// 筛选：状态(多选)、关键字、日期范围、产品、客户、金额、逾期、最近工位
+	query, err := applyOrderFilters(query, c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	// 搜索功能
-	q := c.Query("q")
-	if q != "" {
-		wildcard := "%" + q + "%"
-		query = query.Where("order_no LIKE ? OR customer_name LIKE ? OR phone LIKE ?", wildcard, wildcard, wildcard)
+	// 排序：sort=-created_at,amount
+	sorts, err := parseOrderSort(c.Query("sort"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 游标分页：传 cursor 参数（首页传空值）时按 keyset 翻页，不统计总数
+	if cursorStr, ok := c.GetQuery("cursor"); ok {
+		if len(sorts) > 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "游标分页只支持单个排序字段"})
+			return
+		}
+		if len(sorts) == 0 {
+			sorts = []orderSort{{Column: "id"}}
+		}
+		if sorts[0].Column == "deadline" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "交货日期可能为空，不支持游标分页"})
+			return
+		}
+		if cursorStr != "" {
+			cursor, err := decodeOrderCursor(cursorStr)
+			if err == nil {
+				query, err = applyOrderCursor(query, sorts[0], cursor)
+			}
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		applyOrderSort(query, sorts).Limit(pageSize + 1).Find(&orders)
+		nextCursor := ""
+		if len(orders) > pageSize {
+			orders = orders[:pageSize]
+			last := &orders[len(orders)-1]
+			nextCursor = encodeOrderCursor(orderSortValue(last, sorts[0].Column), last.ID)
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"data":        orders,
+			"next_cursor": nextCursor,
+			"has_more":    nextCursor != "",
+		})
+		return
 	}
 
 	query.Count(&total)
-	query.Offset(offset).Limit(pageSize).Find(&orders)
+	applyOrderSort(query, sorts).Offset(offset).Limit(pageSize).Find(&orders)
 
 	// 全局统计（不受筛选影响）
 	var globalTotal int64
@@ -184,9 +284,11 @@ func GetOrders(c *gin.Context) {
 func GetOrder(c *gin.Context) {
 	var order models.Order
 	if err := database.DB.
+		Preload("Children").
 		Preload("OrderProducts").
 		Preload("OrderProducts.Product").
 		Preload("OrderProducts.Product.Attributes").
+		Preload("Attachments", orderedAttachments).
 		First(&order, c.Param("id")).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
 		return
@@ -194,6 +296,21 @@ func GetOrder(c *gin.Context) {
 	c.JSON(http.StatusOK, order)
 }
 
+// GetOrderByNo 按订单号查询订单（电话沟通时按单号查找）
+func GetOrderByNo(c *gin.Context) {
+	var order models.Order
+	if err := database.DB.
+		Preload("OrderProducts").
+		Preload("OrderProducts.Product").
+		Preload("OrderProducts.Product.Attributes").
+		Where("order_no = ?", strings.TrimSpace(c.Param("orderNo"))).
+		First(&order).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, order)
+}
+
 // UpdateOrderStatus 更新订单状态 (仅状态)
 func UpdateOrderStatus(c *gin.Context) {
 	var order models.Order
@@ -210,8 +327,9 @@ func UpdateOrderStatus(c *gin.Context) {
 		return
 	}
 
-	order.Status = input.Status
+	setOrderStatus(&order, input.Status)
 	database.DB.Save(&order)
+	resolveRemakeTicket(&order)
 	c.JSON(http.StatusOK, order)
 }
 
@@ -219,9 +337,10 @@ func UpdateOrderStatus(c *gin.Context) {
 func ScanQRCode(c *gin.Context) {
 	// 工人扫描二维码
 	var input struct {
-		QRCode      string `json:"qr_code"`
-		WorkerID    uint   `json:"worker_id"`
-		ScannerCode string `json:"scanner_code"` // 新增：扫码枪代码前缀
+		QRCode        string `json:"qr_code"`
+		WorkerID      uint   `json:"worker_id"`
+		ScannerCode   string `json:"scanner_code"`   // 新增：扫码枪代码前缀
+		PaymentMethod string `json:"payment_method"` // 收款工位可选：cash, wechat, alipay, bank_transfer
 	}
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -242,44 +361,64 @@ func ScanQRCode(c *gin.Context) {
 			id, _ := strconv.Atoi(matches[1])
 			orderID = uint(id)
 		} else {
+			// 3. 工牌二维码：工位扫工牌打卡
+			var badgeWorker models.Worker
+			if input.QRCode != "" && database.DB.Where("badge_code = ?", input.QRCode).First(&badgeWorker).Error == nil {
+				touchScanner(input.ScannerCode)
+				respondPunch(c, badgeWorker, "", models.AttendanceBadge)
+				return
+			}
 			// 解析失败
 			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的二维码格式"})
 			return
 		}
 	}
 
-	// 查找订单
+	// 查找订单（已合并的订单扫旧码时转到合并后的订单）
 	var order models.Order
 	if err := database.DB.First(&order, orderID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
-		return
+		if order, err = resolveMergedOrder(orderID); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
+			return
+		}
 	}
 
 	// 查找工人
 	var worker models.Worker
-	// 优先使用 ScannerCode 查找
+	// 优先按扫码枪查找（设备指定的工人或工人的扫码枪代码）；工位公用扫码枪需同时提供 WorkerID
+	found := false
 	if input.ScannerCode != "" {
-		if err := database.DB.Where("scanner_code = ?", input.ScannerCode).First(&worker).Error; err != nil {
+		worker, found = scannerWorker(input.ScannerCode)
+	}
+	if !found {
+		switch {
+		case input.WorkerID > 0:
+			if err := database.DB.First(&worker, input.WorkerID).Error; err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "工人不存在"})
+				return
+			}
+		case input.ScannerCode != "":
 			c.JSON(http.StatusNotFound, gin.H{"error": "无效的扫码枪代码: " + input.ScannerCode})
 			return
-		}
-	} else if input.WorkerID > 0 {
-		// 兼容旧模式：使用 WorkerID
-		if err := database.DB.First(&worker, input.WorkerID).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "工人不存在"})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "未提供工人身份信息"})
 			return
 		}
-	} else {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "未提供工人身份信息"})
-		return
 	}
 
+	// 订单和工人都有效后才记为扫码枪在用，无效扫码不更新最后扫码时间、不关闭告警
+	touchScanner(input.ScannerCode)
+
+	// 工位以扫码枪绑定的工位为准，并检查工人是否可在该工位上岗
+	station, stationErr := scanStation(&worker, input.ScannerCode)
+
 	// Helper to log scan
 	logScan := func(success bool, msg string) {
 		log := models.ScanLog{
 			WorkerID:    worker.ID,
 			WorkerName:  worker.Name,
-			Station:     worker.Station,
+			Station:     station.Name,
+			StationID:   station.ID,
 			Content:     input.QRCode,
 			ScannerCode: input.ScannerCode,
 			IsSuccess:   success,
@@ -289,47 +428,70 @@ func ScanQRCode(c *gin.Context) {
 		database.DB.Create(&log)
 	}
 
-	// 根据工位更新状态
-	// 流程: 待下料 -> 待裁面 -> 待封面 -> 待送货 -> 待收款 -> 已完成
-	newStatus := order.Status
+	if stationErr != nil {
+		logScan(false, stationErr.Error())
+		c.JSON(http.StatusForbidden, gin.H{"error": stationErr.Error()})
+		return
+	}
 
-	switch worker.Station {
-	case "下料":
-		if order.Status == "待下料" {
-			newStatus = "待裁面"
-		}
-	case "裁面":
-		if order.Status == "待裁面" {
-			newStatus = "待封面"
-		}
-	case "封面":
-		if order.Status == "待封面" {
-			newStatus = "待送货"
-		}
-	case "送货", "运货":
-		if order.Status == "待送货" {
-			newStatus = "待收款"
-		}
-	case "收款":
-		if order.Status == "待收款" {
-			newStatus = "已完成"
-		}
+	// 根据工位编码按流程更新状态
+	newStatus := order.Status
+	if step, ok := workflowStepFor(station.Code); ok && order.Status == step.From {
+		newStatus = step.To
 	}
 
 	// 如果状态有变化，执行更新
 	if newStatus != order.Status {
-		order.Status = newStatus
-		database.DB.Save(&order)
+		prevStatus, prevChangedAt := order.Status, order.StatusChangedAt
+		setOrderStatus(&order, newStatus)
 
-		// 记录操作日志 (Process)
-		process := models.Process{
-			OrderID:     order.ID,
-			Station:     worker.Station,
-			Status:      "Completed",
-			WorkerID:    worker.ID,
-			CompletedAt: time.Now(),
+		// 状态、工序记录和收款在同一事务内保存
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Save(&order).Error; err != nil {
+				return err
+			}
+
+			// 记录操作日志 (Process)
+			process := models.Process{
+				OrderID:     order.ID,
+				Station:     station.Name,
+				StationID:   station.ID,
+				Status:      "Completed",
+				WorkerID:    worker.ID,
+				CompletedAt: time.Now(),
+			}
+			if err := tx.Create(&process).Error; err != nil {
+				return err
+			}
+
+			// 收款工位确认收款时登记剩余未收金额
+			if station.Code == stationCodePayment {
+				if balance := orderBalance(&order); balance > 0 {
+					method := input.PaymentMethod
+					if !validPaymentMethod(method) {
+						method = models.PayMethodOther
+					}
+					payment := models.Payment{
+						Type:     models.PaymentNormal,
+						Method:   method,
+						Amount:   balance,
+						Operator: worker.Name,
+						Remark:   "收款工位扫码确认",
+					}
+					return recordPayment(tx, &order, &payment)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			order.Status, order.StatusChangedAt = prevStatus, prevChangedAt
+			logScan(false, "保存失败: "+err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败: " + err.Error()})
+			return
 		}
-		database.DB.Create(&process)
+
+		// 售后重做单完成后结案
+		resolveRemakeTicket(&order)
 
 		logScan(true, fmt.Sprintf("订单 %s 状态更新为 %s", order.OrderNo, newStatus))
 
@@ -341,7 +503,7 @@ func ScanQRCode(c *gin.Context) {
 		})
 	} else {
 		// 状态无变化（可能是重复扫描或流程不对）
-		msg := fmt.Sprintf("状态未更新: 当前状态 %s, 工位 %s 不匹配或无需流转", order.Status, worker.Station)
+		msg := fmt.Sprintf("状态未更新: 当前状态 %s, 工位 %s 不匹配或无需流转", order.Status, station.Name)
 		logScan(false, msg)
 
 		c.JSON(http.StatusOK, gin.H{
@@ -359,9 +521,12 @@ func DeleteOrder(c *gin.Context) {
 		return
 	}
 
-	// 软删除
-	database.DB.Delete(&order)
-	c.JSON(http.StatusOK, gin.H{"message": "订单已删除"})
+	// 软删除：明细和工序记录使用同一删除时间，恢复时据此找回
+	if err := softDeleteOrder(database.DB, &order, time.Now()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "订单已删除，可在回收站恢复"})
 }
 
 // UpdateOrderDetails 更新订单详情 (管理员编辑)
@@ -372,27 +537,18 @@ func UpdateOrderDetails(c *gin.Context) {
 		return
 	}
 
-	type OrderItemInput struct {
-		ProductID  uint    `json:"product_id"`
-		Length     float64 `json:"length"`
-		Width      float64 `json:"width"`
-		Height     float64 `json:"height"`
-		Quantity   int     `json:"quantity"`
-		Unit       string  `json:"unit"`
-		UnitPrice  float64 `json:"unit_price"`
-		ExtraAttrs string  `json:"extra_attrs"` // 额外属性值 JSON
-	}
-
 	var input struct {
-		CustomerName string           `json:"customer_name"`
-		Phone        string           `json:"phone"`
-		Address      string           `json:"address"`
-		Amount       float64          `json:"amount"`
-		Specs        string           `json:"specs"`
-		Remark       string           `json:"remark"`
-		DeadlineStr  string           `json:"deadline_str"`
-		Attachments  string           `json:"attachments"` // 附件图片URL列表 (JSON数组)
-		Items        []OrderItemInput `json:"items"`
+		CustomerName   string           `json:"customer_name"`
+		Phone          string           `json:"phone"`
+		Address        string           `json:"address"`
+		Amount         float64          `json:"amount"`
+		Specs          string           `json:"specs"`
+		Remark         string           `json:"remark"`
+		DeadlineStr    string           `json:"deadline_str"`
+		AttachmentURLs []string         `json:"attachment_urls"` // 附件URL列表，不传则不修改
+		DiscountType   string           `json:"discount_type"`
+		DiscountValue  float64          `json:"discount_value"`
+		Items          []OrderItemInput `json:"items"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -404,6 +560,10 @@ func UpdateOrderDetails(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "客户姓名不能为空"})
 		return
 	}
+	if err := validateDiscount(input.DiscountType, input.DiscountValue); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	// 更新订单基本信息
 	order.CustomerName = input.CustomerName
@@ -412,7 +572,8 @@ func UpdateOrderDetails(c *gin.Context) {
 	order.Amount = input.Amount
 	order.Specs = input.Specs
 	order.Remark = input.Remark
-	order.Attachments = input.Attachments
+	order.DiscountType = input.DiscountType
+	order.DiscountValue = input.DiscountValue
 
 	if input.DeadlineStr != "" {
 		t, err := time.Parse("2006-01-02", input.DeadlineStr)
@@ -422,34 +583,62 @@ func UpdateOrderDetails(c *gin.Context) {
 	}
 
 	// 如果提供了产品明细，则更新
+	var subtotal float64
+	var orderProducts []models.OrderProduct
+	if len(input.Items) > 0 {
+		var customer *models.Customer
+		var cust models.Customer
+		if err := database.DB.Where("phone = ?", order.Phone).First(&cust).Error; err == nil {
+			customer = &cust
+			order.CustomerID = cust.ID
+		}
+
+		var err error
+		if orderProducts, subtotal, err = buildOrderProducts(input.Items, resolvePriceListID(customer)); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		applyOrderDiscount(&order, subtotal)
+	} else {
+		// 未修改明细时按现有明细合计，提交的金额须与之一致；无明细的旧订单沿用手工金额
+		database.DB.Model(&models.OrderProduct{}).Where("order_id = ?", order.ID).
+			Select("COALESCE(SUM(total_price), 0)").Scan(&subtotal)
+		priced := subtotal > 0
+		if !priced {
+			subtotal = input.Amount
+		}
+		applyOrderDiscount(&order, subtotal)
+		if priced && math.Abs(order.Amount-input.Amount) > 0.005 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("订单金额与明细合计 %.2f 不符，请修改明细或折扣", order.Amount)})
+			return
+		}
+	}
+	if order.Amount < order.PaidAmount-0.005 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("订单金额不能低于已收金额 %.2f", order.PaidAmount)})
+		return
+	}
+
 	if len(input.Items) > 0 {
 		// 删除旧的产品明细
 		database.DB.Where("order_id = ?", order.ID).Delete(&models.OrderProduct{})
 
 		// 创建新的产品明细
-		var totalAmount float64 = 0
-		for _, item := range input.Items {
-			op := models.OrderProduct{
-				OrderID:    order.ID,
-				ProductID:  item.ProductID,
-				Length:     item.Length,
-				Width:      item.Width,
-				Height:     item.Height,
-				Quantity:   item.Quantity,
-				Unit:       item.Unit,
-				UnitPrice:  item.UnitPrice,
-				TotalPrice: item.UnitPrice * float64(item.Quantity),
-				ExtraAttrs: item.ExtraAttrs,
-			}
-			database.DB.Create(&op)
-			totalAmount += op.TotalPrice
+		for i := range orderProducts {
+			orderProducts[i].OrderID = order.ID
+			database.DB.Create(&orderProducts[i])
 		}
-		order.Amount = totalAmount
 	}
 
 	database.DB.Save(&order)
 
+	removed, err := syncAttachments(database.DB, models.AttachmentOwnerOrder, order.ID, input.AttachmentURLs, c.GetString("username"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	removeAttachmentFiles(removed)
+
 	// 重新加载完整订单数据返回
-	database.DB.Preload("OrderProducts").Preload("OrderProducts.Product").First(&order, order.ID)
+	database.DB.Preload("OrderProducts").Preload("OrderProducts.Product").Preload("Attachments", orderedAttachments).First(&order, order.ID)
 	c.JSON(http.StatusOK, order)
 }
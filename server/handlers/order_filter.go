@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"trace-server/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 订单列表可排序的字段及类型（用于游标解析）
+var orderSortColumns = map[string]string{
+	"id":            "int",
+	"created_at":    "time",
+	"updated_at":    "time",
+	"deadline":      "time",
+	"amount":        "float",
+	"subtotal":      "float",
+	"paid_amount":   "float",
+	"order_no":      "string",
+	"customer_name": "string",
+	"phone":         "string",
+	"status":        "string",
+}
+
+// orderSort 排序字段
+type orderSort struct {
+	Column string
+	Desc   bool
+}
+
+// orderCursor 游标：上一页最后一条记录的排序字段值和ID
+type orderCursor struct {
+	Value string `json:"v"`
+	ID    uint   `json:"id"`
+}
+
+// queryList 读取可重复或逗号分隔的查询参数，如 status=待下料,待裁面 或 status=待下料&status=待裁面
+func queryList(c *gin.Context, key string) []string {
+	var list []string
+	for _, v := range c.QueryArray(key) {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				list = append(list, s)
+			}
+		}
+	}
+	return list
+}
+
+// parseDateRange 解析 YYYY-MM-DD 日期，结束日期包含当天
+func parseDateRange(from, to string) (*time.Time, *time.Time, error) {
+	var start, end *time.Time
+	if from != "" {
+		t, err := time.ParseInLocation("2006-01-02", from, time.Local)
+		if err != nil {
+			return nil, nil, errors.New("日期格式错误，应为 YYYY-MM-DD: " + from)
+		}
+		start = &t
+	}
+	if to != "" {
+		t, err := time.ParseInLocation("2006-01-02", to, time.Local)
+		if err != nil {
+			return nil, nil, errors.New("日期格式错误，应为 YYYY-MM-DD: " + to)
+		}
+		t = t.AddDate(0, 0, 1)
+		end = &t
+	}
+	return start, end, nil
+}
+
+// applyOrderFilters 订单列表筛选条件（列表、导出共用）
+func applyOrderFilters(query *gorm.DB, c *gin.Context) (*gorm.DB, error) {
+	// 状态，支持多选
+	if statuses := queryList(c, "status"); len(statuses) > 0 {
+		query = query.Where("orders.status IN ?", statuses)
+	}
+
+	// 关键字
+	if q := c.Query("q"); q != "" {
+		wildcard := "%" + q + "%"
+		query = query.Where("orders.order_no LIKE ? OR orders.customer_name LIKE ? OR orders.phone LIKE ?", wildcard, wildcard, wildcard)
+	}
+
+	// 下单日期、交货日期范围
+	start, end, err := parseDateRange(c.Query("created_from"), c.Query("created_to"))
+	if err != nil {
+		return nil, err
+	}
+	if start != nil {
+		query = query.Where("orders.created_at >= ?", *start)
+	}
+	if end != nil {
+		query = query.Where("orders.created_at < ?", *end)
+	}
+	start, end, err = parseDateRange(c.Query("deadline_from"), c.Query("deadline_to"))
+	if err != nil {
+		return nil, err
+	}
+	if start != nil {
+		query = query.Where("orders.deadline >= ?", *start)
+	}
+	if end != nil {
+		query = query.Where("orders.deadline < ?", *end)
+	}
+
+	// 客户
+	if customerID := c.Query("customer_id"); customerID != "" {
+		query = query.Where("orders.customer_id = ?", customerID)
+	}
+
+	// 含指定产品的订单，支持多选
+	if productIDs := queryList(c, "product_id"); len(productIDs) > 0 {
+		query = query.Where("EXISTS (SELECT 1 FROM order_products op WHERE op.order_id = orders.id AND op.deleted_at IS NULL AND op.product_id IN ?)", productIDs)
+	}
+
+	// 金额范围
+	if s := c.Query("amount_min"); s != "" {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, errors.New("最小金额格式错误")
+		}
+		query = query.Where("orders.amount >= ?", v)
+	}
+	if s := c.Query("amount_max"); s != "" {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, errors.New("最大金额格式错误")
+		}
+		query = query.Where("orders.amount <= ?", v)
+	}
+
+	// 逾期：已过交货日期仍未完成
+	if s := c.Query("overdue"); s != "" {
+		now := time.Now()
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+		if s == "true" || s == "1" {
+			query = query.Where("orders.deadline < ? AND orders.status <> ?", today, "已完成")
+		} else {
+			query = query.Where("orders.deadline IS NULL OR orders.deadline >= ? OR orders.status = ?", today, "已完成")
+		}
+	}
+
+	// 最近一次经过的工位（工位名、编码或别名均可，如送货与运货视为同一工位）
+	if stations := queryList(c, "last_station"); len(stations) > 0 {
+		stations = expandStationNames(stations)
+		query = query.Where(`(SELECT p.station FROM processes p
+			WHERE p.order_id = orders.id AND p.deleted_at IS NULL
+			ORDER BY p.completed_at DESC, p.id DESC LIMIT 1) IN ?`, stations)
+	}
+
+	return query, nil
+}
+
+// parseOrderSort 解析排序参数，如 sort=-created_at,amount（- 表示倒序），默认按ID正序
+func parseOrderSort(s string) ([]orderSort, error) {
+	var sorts []orderSort
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		desc := strings.HasPrefix(field, "-")
+		field = strings.TrimPrefix(field, "-")
+		if _, ok := orderSortColumns[field]; !ok {
+			return nil, errors.New("不支持的排序字段: " + field)
+		}
+		sorts = append(sorts, orderSort{Column: field, Desc: desc})
+	}
+	return sorts, nil
+}
+
+// applyOrderSort 应用排序，末尾追加ID保证顺序稳定
+func applyOrderSort(query *gorm.DB, sorts []orderSort) *gorm.DB {
+	for _, s := range sorts {
+		dir := " asc"
+		if s.Desc {
+			dir = " desc"
+		}
+		query = query.Order("orders." + s.Column + dir)
+		if s.Column == "id" {
+			return query
+		}
+	}
+	// ID 方向与首个排序字段一致，游标分页依赖这一点
+	if len(sorts) > 0 && sorts[0].Desc {
+		return query.Order("orders.id desc")
+	}
+	return query.Order("orders.id asc")
+}
+
+// orderSortValue 取订单排序字段的值，用于生成游标
+func orderSortValue(o *models.Order, column string) string {
+	switch column {
+	case "created_at":
+		return o.CreatedAt.Format(time.RFC3339Nano)
+	case "updated_at":
+		return o.UpdatedAt.Format(time.RFC3339Nano)
+	case "amount":
+		return strconv.FormatFloat(o.Amount, 'f', -1, 64)
+	case "subtotal":
+		return strconv.FormatFloat(o.Subtotal, 'f', -1, 64)
+	case "paid_amount":
+		return strconv.FormatFloat(o.PaidAmount, 'f', -1, 64)
+	case "order_no":
+		return o.OrderNo
+	case "customer_name":
+		return o.CustomerName
+	case "phone":
+		return o.Phone
+	case "status":
+		return o.Status
+	}
+	return strconv.FormatUint(uint64(o.ID), 10)
+}
+
+// encodeOrderCursor 生成下一页游标
+func encodeOrderCursor(value string, id uint) string {
+	data, _ := json.Marshal(orderCursor{Value: value, ID: id})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeOrderCursor 解析游标
+func decodeOrderCursor(s string) (*orderCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("无效的分页游标")
+	}
+	var cursor orderCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, errors.New("无效的分页游标")
+	}
+	return &cursor, nil
+}
+
+// cursorValue 将游标中的字符串值还原为对应类型
+func cursorValue(kind, value string) (interface{}, error) {
+	switch kind {
+	case "int":
+		return strconv.ParseUint(value, 10, 64)
+	case "float":
+		return strconv.ParseFloat(value, 64)
+	case "time":
+		return time.Parse(time.RFC3339Nano, value)
+	}
+	return value, nil
+}
+
+// applyOrderCursor 游标分页条件（keyset），只支持单个非空排序字段
+func applyOrderCursor(query *gorm.DB, sort orderSort, cursor *orderCursor) (*gorm.DB, error) {
+	op := ">"
+	if sort.Desc {
+		op = "<"
+	}
+	if sort.Column == "id" {
+		return query.Where("orders.id "+op+" ?", cursor.ID), nil
+	}
+	value, err := cursorValue(orderSortColumns[sort.Column], cursor.Value)
+	if err != nil {
+		return nil, errors.New("无效的分页游标")
+	}
+	col := "orders." + sort.Column
+	return query.Where("("+col+" "+op+" ?) OR ("+col+" = ? AND orders.id "+op+" ?)", value, value, cursor.ID), nil
+}
@@ -0,0 +1,600 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"trace-server/database"
+	"trace-server/models"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"gorm.io/gorm"
+)
+
+// ImportResult 批量导入订单的结果，预览（dry run）时不写入数据库
+type ImportResult struct {
+	DryRun  bool           `json:"dry_run"`
+	Orders  []*ImportOrder `json:"orders"`
+	Total   int            `json:"total"`   // 解析到的订单数
+	Valid   int            `json:"valid"`   // 校验通过的订单数
+	Created int            `json:"created"` // 实际创建的订单数
+	Failed  int            `json:"failed"`  // 校验或保存失败的订单数
+	Amount  float64        `json:"amount"`  // 校验通过的订单金额合计
+}
+
+// ImportOrder 从表格中解析出的一张订单
+type ImportOrder struct {
+	Sheet        string       `json:"sheet"`
+	Row          int          `json:"row"` // 订单起始行（从 1 开始）
+	Date         string       `json:"date"`
+	CustomerName string       `json:"customer_name"`
+	Phone        string       `json:"phone"`
+	Address      string       `json:"address"`
+	Remark       string       `json:"remark"`
+	Items        []ImportItem `json:"items"`
+	Amount       float64      `json:"amount"`
+	NewCustomer  bool         `json:"new_customer"` // 按手机号未找到客户，导入时新建
+	Errors       []string     `json:"errors"`
+	Warnings     []string     `json:"warnings"`
+	OrderID      uint         `json:"order_id,omitempty"`
+	OrderNo      string       `json:"order_no,omitempty"`
+
+	category string // 工作表名中的产品类别
+}
+
+// ImportItem 订单中的一行明细
+type ImportItem struct {
+	Row         int     `json:"row"`
+	Name        string  `json:"name"` // 表格中的品名
+	ProductID   uint    `json:"product_id"`
+	ProductName string  `json:"product_name"`
+	Length      float64 `json:"length"`
+	Width       float64 `json:"width"`
+	Height      float64 `json:"height"`
+	Quantity    float64 `json:"quantity"` // 表格中的数量，小数表示平米数
+	Unit        string  `json:"unit"`
+	UnitPrice   float64 `json:"unit_price"`
+	Amount      float64 `json:"amount"`
+	Remark      string  `json:"remark"`
+}
+
+// ImportOrders 导入订单（POST /import/orders，表单字段 file，dry_run=true 时只预览）
+func ImportOrders(c *gin.Context) {
+	limitUploadBody(c)
+	fh, err := c.FormFile("file")
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			respondUploadError(c, errUploadTooLarge)
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请上传 xlsx 或 csv 文件"})
+		return
+	}
+	file, err := fh.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	dryRun, _ := strconv.ParseBool(c.DefaultPostForm("dry_run", c.Query("dry_run")))
+	result, err := ImportOrdersFrom(file, fh.Filename, dryRun)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// ImportOrdersFrom 解析销货清单（.xlsx 或 .csv）并按手工下单的规则创建客户、订单和明细。
+// 有错误的订单整单跳过，不影响其他订单。
+func ImportOrdersFrom(r io.Reader, filename string, dryRun bool) (*ImportResult, error) {
+	var orders []*ImportOrder
+	var err error
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".xlsx", ".xlsm":
+		orders, err = parseOrderWorkbook(r)
+	case ".csv":
+		orders, err = parseOrderCSV(r)
+	default:
+		return nil, errors.New("仅支持 xlsx 或 csv 文件")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, errors.New("未找到订单，请检查表格格式")
+	}
+
+	var products []models.Product
+	database.DB.Order("sort_order asc, id asc").Find(&products)
+
+	result := &ImportResult{DryRun: dryRun, Orders: orders, Total: len(orders)}
+	for _, o := range orders {
+		order, items := o.build(products)
+		if len(o.Errors) == 0 {
+			o.check(&order, items)
+		}
+		if len(o.Errors) > 0 {
+			result.Failed++
+			continue
+		}
+		result.Valid++
+		result.Amount = roundMoney(result.Amount + o.Amount)
+		if dryRun {
+			continue
+		}
+
+		if err := prepareOrder(&order, items); err != nil {
+			o.Errors = append(o.Errors, err.Error())
+			result.Failed++
+			continue
+		}
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			return createOrder(tx, &order)
+		})
+		if err != nil {
+			o.Errors = append(o.Errors, "保存失败："+err.Error())
+			result.Failed++
+			continue
+		}
+		o.OrderID = order.ID
+		o.OrderNo = order.OrderNo
+		result.Created++
+	}
+	return result, nil
+}
+
+// build 匹配产品并转换为下单参数，问题记录到 Errors
+func (o *ImportOrder) build(products []models.Product) (models.Order, []OrderItemInput) {
+	remark := o.Remark
+	if o.Date != "" {
+		remark = strings.TrimSpace("原单日期：" + o.Date + " " + remark)
+	}
+	order := models.Order{
+		CustomerName: o.CustomerName,
+		Phone:        o.Phone,
+		Address:      o.Address,
+		Remark:       remark,
+	}
+
+	var items []OrderItemInput
+	for i := range o.Items {
+		it := &o.Items[i]
+		product := matchImportProduct(products, it.Name, o.category)
+		if product == nil {
+			name := it.Name
+			if name == "" {
+				name = o.category
+			}
+			o.Errors = append(o.Errors, fmt.Sprintf("第 %d 行：未找到产品「%s」", it.Row, name))
+			continue
+		}
+		it.ProductID = product.ID
+		it.ProductName = product.Name
+		items = append(items, it.input(product.Name))
+	}
+	if len(o.Items) == 0 {
+		o.Errors = append(o.Errors, "没有产品明细")
+	}
+	return order, items
+}
+
+// check 校验订单并计算金额，只读数据库
+func (o *ImportOrder) check(order *models.Order, items []OrderItemInput) {
+	if err := validateOrderInput(order, items); err != nil {
+		o.Errors = append(o.Errors, err.Error())
+		return
+	}
+
+	var customer models.Customer
+	if err := database.DB.Where("phone = ?", order.Phone).First(&customer).Error; err != nil {
+		o.NewCustomer = true
+	} else if customer.Name != order.CustomerName {
+		o.Warnings = append(o.Warnings, fmt.Sprintf("手机号已登记为客户「%s」", customer.Name))
+	}
+
+	preview := *order
+	if err := priceOrder(&preview, &customer, items); err != nil {
+		o.Errors = append(o.Errors, err.Error())
+		return
+	}
+	o.Amount = preview.Amount
+
+	// 重复导入同一份表格时提示，不拦截
+	if customer.ID != 0 {
+		var existing models.Order
+		err := database.DB.Where("customer_id = ? AND amount = ? AND remark = ?", customer.ID, preview.Amount, order.Remark).
+			First(&existing).Error
+		if err == nil {
+			o.Warnings = append(o.Warnings, fmt.Sprintf("可能已导入过（订单 %s）", existing.OrderNo))
+		}
+	}
+}
+
+// input 转换为下单明细。数量为小数时表示平米数，按 1 件计、金额取表格金额，面积和平米单价记入额外属性。
+func (it *ImportItem) input(productName string) OrderItemInput {
+	var attrs [][2]string
+	if it.Name != "" && it.Name != productName {
+		attrs = append(attrs, [2]string{"品名", it.Name})
+	}
+
+	qty := it.Quantity
+	if qty <= 0 {
+		qty = 1
+	}
+	amount := it.Amount
+	if amount <= 0 && it.UnitPrice > 0 {
+		amount = roundMoney(qty * it.UnitPrice)
+	}
+
+	input := OrderItemInput{
+		ProductID: it.ProductID,
+		Length:    it.Length,
+		Width:     it.Width,
+		Height:    it.Height,
+		Unit:      it.Unit,
+	}
+	if qty == math.Trunc(qty) && (amount <= 0 || roundMoney(roundMoney(amount/qty)*qty) == amount) {
+		input.Quantity = int(qty)
+		input.UnitPrice = it.UnitPrice
+		if amount > 0 {
+			input.UnitPrice = roundMoney(amount / qty)
+		}
+	} else {
+		input.Quantity = 1
+		input.UnitPrice = amount
+		if qty != math.Trunc(qty) {
+			attrs = append(attrs, [2]string{"面积", formatNumber(qty) + "平米"})
+			if it.UnitPrice > 0 {
+				attrs = append(attrs, [2]string{"单价", formatNumber(it.UnitPrice) + "元/平米"})
+			}
+		} else {
+			attrs = append(attrs, [2]string{"数量", formatNumber(qty)})
+		}
+	}
+	if it.Remark != "" {
+		attrs = append(attrs, [2]string{"备注", it.Remark})
+	}
+	input.ExtraAttrs = importAttrsJSON(attrs)
+	return input
+}
+
+// importAttrsJSON 按给定顺序生成额外属性 JSON
+func importAttrsJSON(attrs [][2]string) string {
+	if len(attrs) == 0 {
+		return ""
+	}
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, kv := range attrs {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, _ := json.Marshal(kv[0])
+		v, _ := json.Marshal(kv[1])
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// matchImportProduct 按品名匹配产品，匹配不到再按工作表类别匹配；名称最长的优先
+func matchImportProduct(products []models.Product, name, category string) *models.Product {
+	for _, text := range []string{name, category} {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		var best *models.Product
+		for i := range products {
+			p := &products[i]
+			if p.Name == "" {
+				continue
+			}
+			if strings.Contains(text, p.Name) || (utf8.RuneCountInString(text) >= 2 && strings.Contains(p.Name, text)) {
+				if best == nil || len(p.Name) > len(best.Name) {
+					best = p
+				}
+			}
+		}
+		if best != nil {
+			return best
+		}
+	}
+	return nil
+}
+
+// parseOrderWorkbook 解析销货清单工作簿：优先读取名称含“详单”的工作表，每张“销货清单”为一个订单
+func parseOrderWorkbook(r io.Reader) ([]*ImportOrder, error) {
+	f, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取 Excel 文件：%v", err)
+	}
+	defer f.Close()
+
+	sheets := f.GetSheetList()
+	var detail []string
+	for _, s := range sheets {
+		if strings.Contains(s, "详单") {
+			detail = append(detail, s)
+		}
+	}
+	if len(detail) > 0 {
+		sheets = detail
+	}
+
+	var orders []*ImportOrder
+	for _, sheet := range sheets {
+		rows, err := f.GetRows(sheet)
+		if err != nil {
+			return nil, fmt.Errorf("无法读取工作表 %s：%v", sheet, err)
+		}
+		var starts []int
+		for i, row := range rows {
+			if strings.Contains(sheetCell(row, 0), "销货清单") {
+				starts = append(starts, i)
+			}
+		}
+		if len(starts) == 0 {
+			starts = []int{0}
+		}
+		for i, start := range starts {
+			end := len(rows)
+			if i+1 < len(starts) {
+				end = starts[i+1]
+			}
+			if o := parseSalesSlip(rows[start:end], start, sheet); o != nil {
+				orders = append(orders, o)
+			}
+		}
+	}
+	return orders, nil
+}
+
+// 销货清单明细列，表头缺少对应名称时使用默认位置
+type slipColumns struct {
+	name, length, width, height, qty, price, amount, remark int
+}
+
+var defaultSlipColumns = slipColumns{name: 0, length: 1, width: 2, height: 3, qty: 5, price: 6, amount: 7, remark: 8}
+
+// parseSalesSlip 解析一张销货清单；offset 为该清单在工作表中的起始行下标
+func parseSalesSlip(rows [][]string, offset int, sheet string) *ImportOrder {
+	o := &ImportOrder{Sheet: sheet, Row: offset + 1, category: strings.TrimSpace(strings.ReplaceAll(sheet, "详单", ""))}
+
+	headerEnd := len(rows)
+	if headerEnd > 10 {
+		headerEnd = 10
+	}
+	dataStart := -1
+	cols := defaultSlipColumns
+	for i := 0; i < headerEnd; i++ {
+		row := rows[i]
+		for j := range row {
+			label := strings.TrimSpace(row[j])
+			value := strings.TrimSpace(sheetCell(row, j+1))
+			switch {
+			case label == "日期":
+				o.Date = value
+			case label == "客户" || label == "客户名称":
+				o.CustomerName = value
+			case label == "电话":
+				o.Phone = value
+			case label == "地址":
+				o.Address = value
+			case strings.HasPrefix(label, "备注：") || strings.HasPrefix(label, "备注:"):
+				o.Remark = value
+			}
+		}
+		line := strings.Join(row, "")
+		if dataStart < 0 && strings.Contains(line, "品名") && (strings.Contains(line, "长") || strings.Contains(line, "宽")) {
+			dataStart = i + 1
+			cols = slipHeaderColumns(row)
+		}
+	}
+	o.Date = importDate(o.Date)
+	if dataStart < 0 {
+		dataStart = len(rows)
+	}
+
+	for i := dataStart; i < len(rows); i++ {
+		row := rows[i]
+		if strings.Contains(sheetCell(row, 0), "大写") || strings.Contains(sheetCell(row, 0), "合计") {
+			break
+		}
+		it := ImportItem{
+			Row:       offset + i + 1,
+			Name:      strings.TrimSpace(sheetCell(row, cols.name)),
+			Length:    importNumber(sheetCell(row, cols.length)),
+			Width:     importNumber(sheetCell(row, cols.width)),
+			Height:    importNumber(sheetCell(row, cols.height)),
+			Quantity:  importNumber(sheetCell(row, cols.qty)),
+			UnitPrice: importNumber(sheetCell(row, cols.price)),
+			Amount:    importNumber(sheetCell(row, cols.amount)),
+			Remark:    strings.TrimSpace(sheetCell(row, cols.remark)),
+		}
+		// 高度一般小于 100，更大的数通常是填错列
+		if it.Height >= 100 {
+			it.Height = 0
+		}
+		if it.Length <= 0 && it.Width <= 0 && (it.Name == "" || it.Amount <= 0) {
+			continue
+		}
+		if it.Quantity > 0 && it.Quantity != math.Trunc(it.Quantity) {
+			it.Unit = "平米"
+		} else {
+			it.Unit = "块"
+		}
+		o.Items = append(o.Items, it)
+	}
+
+	// 空白清单（模板）直接忽略
+	if o.CustomerName == "" && len(o.Items) == 0 {
+		return nil
+	}
+	return o
+}
+
+// slipHeaderColumns 按表头文字定位明细列
+func slipHeaderColumns(header []string) slipColumns {
+	cols := defaultSlipColumns
+	for j, h := range header {
+		h = strings.TrimSpace(h)
+		switch {
+		case strings.Contains(h, "品名"):
+			cols.name = j
+		case h == "长":
+			cols.length = j
+		case h == "宽":
+			cols.width = j
+		case h == "高" || h == "厚":
+			cols.height = j
+		case strings.Contains(h, "数量") || strings.Contains(h, "平米") || strings.Contains(h, "面积"):
+			cols.qty = j
+		case strings.Contains(h, "单价"):
+			cols.price = j
+		case strings.Contains(h, "金额"):
+			cols.amount = j
+		case strings.Contains(h, "备注"):
+			cols.remark = j
+		}
+	}
+	return cols
+}
+
+// parseOrderCSV 解析每行一条明细的 CSV：单号（或同一客户、电话、日期的连续行）相同的明细合并为一个订单。
+// 表头：单号,日期,客户,电话,地址,备注,品名,长,宽,高,数量,单位,单价,金额,明细备注
+func parseOrderCSV(r io.Reader) ([]*ImportOrder, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	// Excel 另存的 CSV 多为 GBK 编码
+	if !utf8.Valid(data) {
+		if data, err = simplifiedchinese.GBK.NewDecoder().Bytes(data); err != nil {
+			return nil, errors.New("无法识别 CSV 文件编码")
+		}
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("无法读取 CSV 文件：%v", err)
+	}
+	if len(records) < 2 {
+		return nil, nil
+	}
+
+	col := map[string]int{}
+	for j, h := range records[0] {
+		h = strings.TrimSpace(h)
+		if h == "客户名称" {
+			h = "客户"
+		}
+		col[h] = j
+	}
+	if _, ok := col["客户"]; !ok {
+		return nil, errors.New("CSV 缺少表头“客户”")
+	}
+	get := func(row []string, name string) string {
+		if j, ok := col[name]; ok {
+			return strings.TrimSpace(sheetCell(row, j))
+		}
+		return ""
+	}
+
+	var orders []*ImportOrder
+	var current *ImportOrder
+	var currentKey string
+	for i, row := range records[1:] {
+		if strings.TrimSpace(strings.Join(row, "")) == "" {
+			continue
+		}
+		key := get(row, "单号")
+		if key == "" {
+			key = get(row, "客户") + "|" + get(row, "电话") + "|" + get(row, "日期")
+		}
+		if current == nil || key != currentKey {
+			current = &ImportOrder{
+				Sheet:        "CSV",
+				Row:          i + 2,
+				Date:         importDate(get(row, "日期")),
+				CustomerName: get(row, "客户"),
+				Phone:        get(row, "电话"),
+				Address:      get(row, "地址"),
+				Remark:       get(row, "备注"),
+			}
+			currentKey = key
+			orders = append(orders, current)
+		}
+		current.Items = append(current.Items, ImportItem{
+			Row:       i + 2,
+			Name:      get(row, "品名"),
+			Length:    importNumber(get(row, "长")),
+			Width:     importNumber(get(row, "宽")),
+			Height:    importNumber(get(row, "高")),
+			Quantity:  importNumber(get(row, "数量")),
+			Unit:      get(row, "单位"),
+			UnitPrice: importNumber(get(row, "单价")),
+			Amount:    importNumber(get(row, "金额")),
+			Remark:    get(row, "明细备注"),
+		})
+	}
+	return orders, nil
+}
+
+func sheetCell(row []string, j int) string {
+	if j < 0 || j >= len(row) {
+		return ""
+	}
+	return row[j]
+}
+
+// importNumber 解析表格中的数字，无法解析或非正数时返回 0
+func importNumber(s string) float64 {
+	s = strings.NewReplacer(",", "", "¥", "", "￥", "", " ", "").Replace(s)
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v <= 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0
+	}
+	return v
+}
+
+// importDate 统一日期格式为 2006-01-02，无法识别时原样保留
+func importDate(s string) string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return ""
+	}
+	layouts := []string{"2006-01-02", "2006/1/2", "2006-1-2", "2006.1.2", "2006年1月2日", "1/2/06", "01-02-06", "2006-01-02 15:04:05"}
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t.Format("2006-01-02")
+		}
+	}
+	// 未设置日期格式的单元格为 Excel 序列号
+	if v, err := strconv.ParseFloat(s, 64); err == nil && v > 20000 && v < 80000 {
+		if t, err := excelize.ExcelDateToTime(v, false); err == nil {
+			return t.Format("2006-01-02")
+		}
+	}
+	return s
+}
@@ -0,0 +1,747 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"trace-server/config"
+	"trace-server/database"
+	"trace-server/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pdf/fpdf"
+	"github.com/skip2/go-qrcode"
+)
+
+// 未配置时的默认抬头、注意事项和联系方式，与前端打印模板一致
+const (
+	defaultPDFCompany = "旭日盛唐全国运营中心（青岛榻榻米垫工厂）"
+	defaultPDFContact = "联系人：周茂建    电话：13645421333（微信/支付宝）同号    0532-86711234"
+)
+
+var defaultPDFNotes = []string{
+	"1. 产品计价单位按每平米计算，后期增加花色，请以实际报价为准。",
+	"2. 常规订单5-7天发货，电加热榻榻米垫工期为10-15天。",
+	"3. 下单最好提供完整的图片及型号信息，保证订单准确性。",
+	"4. 榻榻米默认规格为两长边包边，短边不包，若需四边包边，加收10元/平方米材料人工费。",
+}
+
+// 未配置 pdf.font_path 时依次查找的中文字体（需为 TTF，不支持 TTC/OTF）
+var defaultPDFFontPaths = []string{
+	"./fonts/simhei.ttf",
+	"/usr/share/fonts/truetype/simhei.ttf",
+	"C:/Windows/Fonts/simhei.ttf",
+}
+
+const (
+	pdfFont        = "cjk"
+	invoiceMinRows = 8 // 销货清单至少显示的行数，不足补空行
+)
+
+var errPDFFont = errors.New("未找到中文字体，请在配置文件 pdf.font_path 中指定 TTF 字体")
+
+// 字体文件较大，读取一次后缓存
+var pdfFontCache struct {
+	sync.Mutex
+	path string
+	data []byte
+}
+
+// loadPDFFont 读取中文字体
+func loadPDFFont() ([]byte, error) {
+	paths := defaultPDFFontPaths
+	if p := config.Current.PDF.FontPath; p != "" {
+		paths = []string{p}
+	}
+
+	pdfFontCache.Lock()
+	defer pdfFontCache.Unlock()
+	for _, p := range paths {
+		if p == pdfFontCache.path && pdfFontCache.data != nil {
+			return pdfFontCache.data, nil
+		}
+		if data, err := os.ReadFile(p); err == nil {
+			pdfFontCache.path, pdfFontCache.data = p, data
+			return data, nil
+		}
+	}
+	return nil, errPDFFont
+}
+
+func pdfCompany() string {
+	if s := config.Current.PDF.CompanyName; s != "" {
+		return s
+	}
+	return defaultPDFCompany
+}
+
+func pdfContact() string {
+	if s := config.Current.PDF.Contact; s != "" {
+		return s
+	}
+	return defaultPDFContact
+}
+
+func pdfNotes() []string {
+	if notes := config.Current.PDF.Notes; len(notes) > 0 {
+		return notes
+	}
+	return defaultPDFNotes
+}
+
+// newPDF 创建 PDF 并注册中文字体
+func newPDF(orientation string, size fpdf.SizeType) (*fpdf.Fpdf, error) {
+	font, err := loadPDFFont()
+	if err != nil {
+		return nil, err
+	}
+	pdf := fpdf.NewCustom(&fpdf.InitType{OrientationStr: orientation, UnitStr: "mm", Size: size})
+	pdf.AddUTF8FontFromBytes(pdfFont, "", font)
+	pdf.SetFont(pdfFont, "", 10)
+	pdf.SetAutoPageBreak(false, 0)
+	return pdf, pdf.Error()
+}
+
+// writePDF 输出 PDF 响应
+func writePDF(c *gin.Context, pdf *fpdf.Fpdf, filename string) {
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	disposition := "inline"
+	if c.Query("download") == "true" {
+		disposition = "attachment"
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("%s; filename*=UTF-8''%s", disposition, url.PathEscape(filename)))
+	c.Data(http.StatusOK, "application/pdf", buf.Bytes())
+}
+
+// respondPDFError PDF 生成失败
+func respondPDFError(c *gin.Context, err error) {
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// drawQRCode 在指定位置绘制二维码
+func drawQRCode(pdf *fpdf.Fpdf, content string, x, y, size float64) {
+	if content == "" {
+		content = "INVALID"
+	}
+	png, err := qrcode.Encode(content, qrcode.Medium, 256)
+	if err != nil {
+		pdf.SetError(err)
+		return
+	}
+	name := "qr-" + content
+	pdf.RegisterImageOptionsReader(name, fpdf.ImageOptions{ImageType: "PNG"}, bytes.NewReader(png))
+	pdf.ImageOptions(name, x, y, size, size, false, fpdf.ImageOptions{ImageType: "PNG"}, 0, "")
+}
+
+// chineseAmount 金额转中文大写，如 1234.5 -> 壹仟贰佰叁拾肆元伍角
+func chineseAmount(num float64) string {
+	digits := []string{"零", "壹", "贰", "叁", "肆", "伍", "陆", "柒", "捌", "玖"}
+	units := []string{"", "拾", "佰", "仟"}
+	bigUnits := []string{"", "万", "亿", "万亿"}
+
+	prefix := ""
+	if num < 0 {
+		prefix, num = "负", -num
+	}
+	cents := int64(math.Round(num * 100))
+	if cents == 0 {
+		return "零元整"
+	}
+	intPart, decPart := cents/100, cents%100
+
+	var b strings.Builder
+	b.WriteString(prefix)
+	// 整数部分：每 4 位一组，组内有数字时才写万、亿
+	if intPart > 0 {
+		s := strconv.FormatInt(intPart, 10)
+		zeroFlag, groupHasDigit := false, false
+		for i, ch := range s {
+			digit := int(ch - '0')
+			pos := len(s) - 1 - i
+			unitPos, bigUnitPos := pos%4, pos/4
+			if digit == 0 {
+				zeroFlag = true
+			} else {
+				if zeroFlag {
+					b.WriteString("零")
+					zeroFlag = false
+				}
+				b.WriteString(digits[digit] + units[unitPos])
+				groupHasDigit = true
+			}
+			if unitPos == 0 {
+				if groupHasDigit && bigUnitPos > 0 && bigUnitPos < len(bigUnits) {
+					b.WriteString(bigUnits[bigUnitPos])
+				}
+				groupHasDigit = false
+			}
+		}
+		b.WriteString("元")
+	}
+
+	// 小数部分
+	if decPart > 0 {
+		jiao, fen := decPart/10, decPart%10
+		if jiao > 0 {
+			b.WriteString(digits[jiao] + "角")
+		} else if intPart > 0 {
+			b.WriteString("零")
+		}
+		if fen > 0 {
+			b.WriteString(digits[fen] + "分")
+		}
+	} else {
+		b.WriteString("整")
+	}
+	return b.String()
+}
+
+// formatNumber 数字去掉多余的小数位，如 200、1.5
+func formatNumber(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// orderLineSize 规格文本：长×宽×高
+func orderLineSize(op models.OrderProduct) string {
+	if op.Length == 0 && op.Width == 0 && op.Height == 0 {
+		return "-"
+	}
+	return formatNumber(op.Length) + "×" + formatNumber(op.Width) + "×" + formatNumber(op.Height)
+}
+
+// orderLineAttrs 按原顺序解析额外属性，返回 "颜色: 红色" 形式的列表
+func orderLineAttrs(extraAttrs string) []string {
+	if extraAttrs == "" {
+		return nil
+	}
+	dec := json.NewDecoder(strings.NewReader(extraAttrs))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil
+	}
+	var attrs []string
+	for dec.More() {
+		keyTok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		var value interface{}
+		if err := dec.Decode(&value); err != nil {
+			break
+		}
+		if value == nil || value == "" || value == false {
+			continue
+		}
+		attrs = append(attrs, fmt.Sprintf("%v: %v", keyTok, value))
+	}
+	return attrs
+}
+
+func orderLineName(op models.OrderProduct) string {
+	if op.Product != nil && op.Product.Name != "" {
+		return op.Product.Name
+	}
+	return "-"
+}
+
+func orderLineUnit(op models.OrderProduct) string {
+	if op.Unit != "" {
+		return op.Unit
+	}
+	return "块"
+}
+
+// loadPrintOrder 加载打印所需的订单数据
+func loadPrintOrder(id interface{}) (models.Order, error) {
+	var order models.Order
+	err := database.DB.
+		Preload("OrderProducts").
+		Preload("OrderProducts.Product").
+		First(&order, id).Error
+	return order, err
+}
+
+// pdfTable 带表头的表格，自动换页并重绘表头
+type pdfTable struct {
+	pdf     *fpdf.Fpdf
+	headers []string
+	widths  []float64
+	aligns  []string
+	bottom  float64 // 表格可用的最低位置，超过则换页
+	onPage  func()  // 换页后绘制页眉
+}
+
+const pdfLineHeight = 5.0
+
+func (t *pdfTable) x0() float64 {
+	l, _, _, _ := t.pdf.GetMargins()
+	return l
+}
+
+// cell 绘制带边框的单元格，多行文字垂直居中
+func (t *pdfTable) cell(x, y, w, h float64, lines []string, align string) {
+	t.pdf.Rect(x, y, w, h, "D")
+	if len(lines) == 0 {
+		return
+	}
+	top := y + (h-float64(len(lines))*pdfLineHeight)/2
+	for i, line := range lines {
+		t.pdf.SetXY(x+1, top+float64(i)*pdfLineHeight)
+		t.pdf.CellFormat(w-2, pdfLineHeight, line, "", 0, align, false, 0, "")
+	}
+}
+
+// wrap 按列宽拆分文字
+func (t *pdfTable) wrap(text string, w float64) []string {
+	if text == "" {
+		return nil
+	}
+	var lines []string
+	for _, part := range strings.Split(text, "\n") {
+		lines = append(lines, t.pdf.SplitText(part, w-2)...)
+	}
+	return lines
+}
+
+func (t *pdfTable) header() {
+	y := t.pdf.GetY()
+	x := t.x0()
+	t.pdf.SetFillColor(240, 240, 240)
+	for i, h := range t.headers {
+		t.pdf.Rect(x, y, t.widths[i], 8, "FD")
+		t.pdf.SetXY(x, y)
+		t.pdf.CellFormat(t.widths[i], 8, h, "", 0, "CM", false, 0, "")
+		x += t.widths[i]
+	}
+	t.pdf.SetY(y + 8)
+}
+
+// tableRow 表格行；mergeKey 相同的连续行合并最后一列（规格）
+type tableRow struct {
+	cells    []string
+	mergeKey string
+}
+
+// rows 绘制表格行。mergeLast 为 true 时最后一列按 mergeKey 合并单元格
+func (t *pdfTable) rows(rows []tableRow, mergeLast bool) {
+	last := len(t.widths) - 1
+	cols := len(t.widths)
+	if mergeLast {
+		cols = last
+	}
+	lastX := t.x0()
+	for _, w := range t.widths[:last] {
+		lastX += w
+	}
+
+	var groupKey, groupText string
+	var groupY, groupH float64
+	flush := func() {
+		if groupH > 0 {
+			t.cell(lastX, groupY, t.widths[last], groupH, t.wrap(groupText, t.widths[last]), "CM")
+		}
+		groupH = 0
+	}
+
+	t.header()
+	for _, row := range rows {
+		wrapped := make([][]string, len(t.widths))
+		lines := 1
+		for i := range t.widths {
+			wrapped[i] = t.wrap(row.cells[i], t.widths[i])
+			if len(wrapped[i]) > lines {
+				lines = len(wrapped[i])
+			}
+		}
+		h := math.Max(8, float64(lines)*pdfLineHeight+3)
+
+		y := t.pdf.GetY()
+		if y+h > t.bottom {
+			if mergeLast {
+				flush()
+			}
+			t.pdf.AddPage()
+			if t.onPage != nil {
+				t.onPage()
+			}
+			t.header()
+			y = t.pdf.GetY()
+		}
+
+		x := t.x0()
+		for i := 0; i < cols; i++ {
+			t.cell(x, y, t.widths[i], h, wrapped[i], t.aligns[i])
+			x += t.widths[i]
+		}
+		if mergeLast {
+			if groupH == 0 || row.mergeKey == "" || row.mergeKey != groupKey {
+				flush()
+				groupKey, groupText, groupY = row.mergeKey, row.cells[last], y
+			}
+			groupH += h
+		}
+		t.pdf.SetY(y + h)
+	}
+	if mergeLast {
+		// 合并单元格绘制后光标在其内部，恢复到表格底部
+		y := t.pdf.GetY()
+		flush()
+		t.pdf.SetY(y)
+	}
+}
+
+// pdfHeaderLine 左右两端对齐的一行文字
+func pdfHeaderLine(pdf *fpdf.Fpdf, left, right string) {
+	l, _, r, _ := pdf.GetMargins()
+	w, _ := pdf.GetPageSize()
+	y := pdf.GetY()
+	pdf.SetX(l)
+	pdf.CellFormat(w-l-r, 6, left, "", 0, "L", false, 0, "")
+	pdf.SetXY(l, y)
+	pdf.CellFormat(w-l-r, 6, right, "", 1, "R", false, 0, "")
+}
+
+// pdfRule 画一条横线
+func pdfRule(pdf *fpdf.Fpdf, width float64) {
+	l, _, r, _ := pdf.GetMargins()
+	w, _ := pdf.GetPageSize()
+	y := pdf.GetY()
+	pdf.SetLineWidth(width)
+	pdf.Line(l, y, w-r, y)
+	pdf.SetLineWidth(0.2)
+}
+
+// renderInvoice 销货清单（A4）：明细、折扣、金额大小写、备注和注意事项
+func renderInvoice(order models.Order) (*fpdf.Fpdf, error) {
+	pdf, err := newPDF("P", fpdf.SizeType{Wd: 210, Ht: 297})
+	if err != nil {
+		return nil, err
+	}
+	pdf.SetMargins(10, 10, 10)
+	pdf.AddPage()
+	pageW, pageH := pdf.GetPageSize()
+
+	drawQRCode(pdf, order.QRCode, pageW-10-22, 8, 22)
+
+	pdf.SetFont(pdfFont, "", 20)
+	pdf.SetTextColor(204, 0, 0)
+	pdf.SetY(10)
+	pdf.CellFormat(0, 10, "销货清单", "", 1, "C", false, 0, "")
+	pdf.SetTextColor(0, 0, 0)
+	pdf.SetFont(pdfFont, "", 11)
+	pdf.CellFormat(0, 6, pdfCompany(), "", 1, "C", false, 0, "")
+	pdf.Ln(6)
+
+	pdf.SetFont(pdfFont, "", 10)
+	orderNo := order.OrderNo
+	if orderNo == "" {
+		orderNo = strconv.Itoa(int(order.ID))
+	}
+	pdfHeaderLine(pdf, "日期："+order.CreatedAt.Format("2006-01-02")+"    客户："+order.CustomerName, "订单号："+orderNo)
+	pdfRule(pdf, 0.3)
+	pdfHeaderLine(pdf, "地址："+orDash(order.Address), "电话："+orDash(order.Phone))
+	pdf.Ln(2)
+
+	table := &pdfTable{
+		pdf:     pdf,
+		headers: []string{"序号", "品名", "属性", "数量", "单位", "单价", "金额", "规格(长×宽×高)"},
+		widths:  []float64{10, 30, 47, 14, 12, 20, 22, 35},
+		aligns:  []string{"CM", "LM", "LM", "CM", "CM", "RM", "RM", "CM"},
+		bottom:  pageH - 10,
+	}
+	var rows []tableRow
+	var lineDiscount float64
+	for i, op := range order.OrderProducts {
+		name, size := orderLineName(op), orderLineSize(op)
+		rows = append(rows, tableRow{
+			cells: []string{
+				strconv.Itoa(i + 1), name, orDash(strings.Join(orderLineAttrs(op.ExtraAttrs), "\n")),
+				strconv.Itoa(op.Quantity), orderLineUnit(op),
+				fmt.Sprintf("%.2f", op.UnitPrice), fmt.Sprintf("%.2f", op.TotalPrice), size,
+			},
+			mergeKey: name + "__" + size,
+		})
+		lineDiscount += op.Discount
+	}
+	for len(rows) < invoiceMinRows {
+		rows = append(rows, tableRow{cells: make([]string, len(table.widths))})
+	}
+	table.rows(rows, true)
+	pdf.Ln(2)
+
+	// 合计区、备注和注意事项放不下时换页
+	if pdf.GetY()+70 > pageH-10 {
+		pdf.AddPage()
+	}
+	if lineDiscount > 0 || order.Discount > 0 {
+		left, right := "", ""
+		if lineDiscount > 0 {
+			left = fmt.Sprintf("明细优惠：¥ %.2f", lineDiscount)
+		}
+		if order.Discount > 0 {
+			percent := ""
+			if order.DiscountType == "percent" {
+				percent = "(" + formatNumber(order.DiscountValue) + "%)"
+			}
+			right = fmt.Sprintf("整单优惠%s：-¥ %.2f　合计：¥ %.2f", percent, order.Discount, order.Subtotal)
+		}
+		pdfHeaderLine(pdf, left, right)
+	}
+	pdfRule(pdf, 0.5)
+	pdf.Ln(1)
+	pdf.SetFont(pdfFont, "", 11)
+	pdfHeaderLine(pdf, "大写："+chineseAmount(order.Amount), fmt.Sprintf("小写：¥ %.2f", order.Amount))
+	pdf.Ln(2)
+
+	pdf.SetFont(pdfFont, "", 10)
+	pdf.MultiCell(0, 6, "备注："+order.Remark, "1", "L", false)
+	pdf.Ln(3)
+
+	pdf.SetFont(pdfFont, "", 8)
+	pdf.SetFillColor(249, 249, 249)
+	pdf.MultiCell(0, 4.5, strings.Join(pdfNotes(), "\n"), "", "L", true)
+	pdf.Ln(3)
+	pdfRule(pdf, 0.2)
+	pdf.Ln(1)
+	pdf.SetFont(pdfFont, "", 9)
+	pdf.CellFormat(0, 6, pdfContact(), "", 1, "L", false, 0, "")
+
+	return pdf, pdf.Error()
+}
+
+// renderDeliveryNote 送货单（A4）：不含单价，显示应收金额和签收栏
+func renderDeliveryNote(order models.Order) (*fpdf.Fpdf, error) {
+	pdf, err := newPDF("P", fpdf.SizeType{Wd: 210, Ht: 297})
+	if err != nil {
+		return nil, err
+	}
+	pdf.SetMargins(10, 10, 10)
+	pdf.AddPage()
+	pageW, pageH := pdf.GetPageSize()
+
+	drawQRCode(pdf, order.QRCode, pageW-10-22, 8, 22)
+
+	pdf.SetFont(pdfFont, "", 20)
+	pdf.SetY(10)
+	pdf.CellFormat(0, 10, "送货单", "", 1, "C", false, 0, "")
+	pdf.SetFont(pdfFont, "", 11)
+	pdf.CellFormat(0, 6, pdfCompany(), "", 1, "C", false, 0, "")
+	pdf.Ln(6)
+
+	pdf.SetFont(pdfFont, "", 10)
+	pdfHeaderLine(pdf, "客户："+order.CustomerName+"    电话："+orDash(order.Phone), "订单号："+order.OrderNo)
+	pdfRule(pdf, 0.3)
+	pdfHeaderLine(pdf, "送货地址："+orDash(order.Address), "下单日期："+order.CreatedAt.Format("2006-01-02"))
+	pdf.Ln(2)
+
+	table := &pdfTable{
+		pdf:     pdf,
+		headers: []string{"序号", "品名", "属性", "规格(长×宽×高)", "数量", "单位"},
+		widths:  []float64{12, 38, 70, 40, 15, 15},
+		aligns:  []string{"CM", "LM", "LM", "CM", "CM", "CM"},
+		bottom:  pageH - 10,
+	}
+	var rows []tableRow
+	total := 0
+	for i, op := range order.OrderProducts {
+		rows = append(rows, tableRow{cells: []string{
+			strconv.Itoa(i + 1), orderLineName(op), orDash(strings.Join(orderLineAttrs(op.ExtraAttrs), "\n")),
+			orderLineSize(op), strconv.Itoa(op.Quantity), orderLineUnit(op),
+		}})
+		total += op.Quantity
+	}
+	table.rows(rows, false)
+	pdf.Ln(2)
+
+	if pdf.GetY()+50 > pageH-10 {
+		pdf.AddPage()
+	}
+	pdfHeaderLine(pdf, fmt.Sprintf("共 %d 项，合计 %d 件", len(order.OrderProducts), total),
+		fmt.Sprintf("订单金额：¥ %.2f    已收：¥ %.2f    待收：¥ %.2f", order.Amount, order.PaidAmount, orderBalance(&order)))
+	if balance := orderBalance(&order); balance > 0 {
+		pdfHeaderLine(pdf, "", "待收大写："+chineseAmount(balance))
+	}
+	pdf.Ln(2)
+	pdf.MultiCell(0, 6, "备注："+order.Remark, "1", "L", false)
+	pdf.Ln(10)
+
+	pdf.SetFont(pdfFont, "", 11)
+	pdfHeaderLine(pdf, "送货人：______________        收货人签字：______________", "签收日期：______年____月____日")
+	pdf.Ln(4)
+	pdf.SetFont(pdfFont, "", 8)
+	pdf.CellFormat(0, 5, "请当面验收，签字即视为货物数量、规格无误。", "", 1, "L", false, 0, "")
+	pdf.SetFont(pdfFont, "", 9)
+	pdf.CellFormat(0, 6, pdfContact(), "", 1, "L", false, 0, "")
+
+	return pdf, pdf.Error()
+}
+
+// 生产标签尺寸 (mm)
+const (
+	labelWidth  = 80
+	labelHeight = 120
+)
+
+// addOrderLabel 添加一页生产标签；lines 为标签上列出的明细
+func addOrderLabel(pdf *fpdf.Fpdf, order models.Order, lines []models.OrderProduct, caption string) {
+	pdf.AddPage()
+	pdf.SetFont(pdfFont, "", 14)
+	pdf.SetY(5)
+	pdf.CellFormat(0, 8, "订单标签", "", 1, "C", false, 0, "")
+	pdfRule(pdf, 0.5)
+	pdf.Ln(2)
+
+	pdf.SetFont(pdfFont, "", 10)
+	info := [][2]string{
+		{"客户", order.CustomerName},
+		{"电话", orDash(order.Phone)},
+		{"地址", order.Address},
+		{"日期", order.CreatedAt.Format("2006-01-02")},
+	}
+	if order.Deadline != nil {
+		info = append(info, [2]string{"交期", order.Deadline.Format("2006-01-02")})
+	}
+	for _, row := range info {
+		if row[1] == "" {
+			continue
+		}
+		pdf.CellFormat(10, 5, row[0], "", 0, "L", false, 0, "")
+		pdf.MultiCell(0, 5, row[1], "", "L", false)
+	}
+
+	if len(lines) > 0 {
+		pdf.Ln(1)
+		pdf.SetFont(pdfFont, "", 9)
+		pdf.SetFillColor(240, 240, 240)
+		var text []string
+		for _, op := range lines {
+			line := fmt.Sprintf("%s  %s  ×%d", orderLineName(op), orderLineSize(op), op.Quantity)
+			if attrs := orderLineAttrs(op.ExtraAttrs); len(attrs) > 0 {
+				line += "\n  " + strings.Join(attrs, "；")
+			}
+			text = append(text, line)
+		}
+		pdf.MultiCell(0, 4.5, strings.Join(text, "\n"), "", "L", true)
+	}
+
+	// 二维码放在底部，内容过多时缩小
+	qrSize := 40.0
+	if space := labelHeight - 18 - pdf.GetY(); space < qrSize {
+		qrSize = math.Max(space, 20)
+	}
+	qrY := labelHeight - 16 - qrSize
+	drawQRCode(pdf, order.QRCode, (labelWidth-qrSize)/2, qrY, qrSize)
+	pdf.SetFont(pdfFont, "", 9)
+	pdf.SetY(qrY + qrSize + 1)
+	pdf.CellFormat(0, 4, order.OrderNo, "", 1, "C", false, 0, "")
+	pdf.SetFont(pdfFont, "", 7)
+	hint := "扫描二维码查看/更新订单状态"
+	if caption != "" {
+		hint = caption + "    " + hint
+	}
+	pdf.CellFormat(0, 4, hint, "", 1, "C", false, 0, "")
+}
+
+// renderLabels 生产标签（80mm 宽）；perLine 为 true 时每条明细一张
+func renderLabels(orders []models.Order, perLine bool) (*fpdf.Fpdf, error) {
+	pdf, err := newPDF("P", fpdf.SizeType{Wd: labelWidth, Ht: labelHeight})
+	if err != nil {
+		return nil, err
+	}
+	pdf.SetMargins(4, 4, 4)
+	for _, order := range orders {
+		if !perLine || len(order.OrderProducts) == 0 {
+			addOrderLabel(pdf, order, order.OrderProducts, "")
+			continue
+		}
+		for i, op := range order.OrderProducts {
+			addOrderLabel(pdf, order, []models.OrderProduct{op}, fmt.Sprintf("第 %d/%d 项", i+1, len(order.OrderProducts)))
+		}
+	}
+	return pdf, pdf.Error()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// GetOrderInvoicePDF 销货清单 PDF
+func GetOrderInvoicePDF(c *gin.Context) {
+	order, err := loadPrintOrder(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
+		return
+	}
+	pdf, err := renderInvoice(order)
+	if err != nil {
+		respondPDFError(c, err)
+		return
+	}
+	writePDF(c, pdf, "销货清单-"+order.OrderNo+".pdf")
+}
+
+// GetOrderDeliveryNotePDF 送货单 PDF
+func GetOrderDeliveryNotePDF(c *gin.Context) {
+	order, err := loadPrintOrder(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
+		return
+	}
+	pdf, err := renderDeliveryNote(order)
+	if err != nil {
+		respondPDFError(c, err)
+		return
+	}
+	writePDF(c, pdf, "送货单-"+order.OrderNo+".pdf")
+}
+
+// GetOrderLabelPDF 订单生产标签 PDF（per_line=true 时每条明细一张）
+func GetOrderLabelPDF(c *gin.Context) {
+	order, err := loadPrintOrder(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
+		return
+	}
+	pdf, err := renderLabels([]models.Order{order}, c.Query("per_line") == "true")
+	if err != nil {
+		respondPDFError(c, err)
+		return
+	}
+	writePDF(c, pdf, "标签-"+order.OrderNo+".pdf")
+}
+
+// GetOrderLabelsPDF 批量打印生产标签（ids=1,2,3）
+func GetOrderLabelsPDF(c *gin.Context) {
+	ids := queryList(c, "ids")
+	if len(ids) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请选择订单"})
+		return
+	}
+	var orders []models.Order
+	database.DB.Preload("OrderProducts").Preload("OrderProducts.Product").
+		Where("id IN ?", ids).Order("id asc").Find(&orders)
+	if len(orders) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
+		return
+	}
+	pdf, err := renderLabels(orders, c.Query("per_line") == "true")
+	if err != nil {
+		respondPDFError(c, err)
+		return
+	}
+	writePDF(c, pdf, "标签.pdf")
+}
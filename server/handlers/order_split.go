@@ -0,0 +1,366 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"trace-server/database"
+	"trace-server/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// priceLine 按单价、数量和行折扣重新计算明细金额
+func priceLine(op *models.OrderProduct) {
+	gross := roundMoney(op.UnitPrice * float64(op.Quantity))
+	op.Discount = calcDiscount(gross, op.DiscountType, op.DiscountValue)
+	op.TotalPrice = roundMoney(gross - op.Discount)
+}
+
+// sumLines 明细合计
+func sumLines(ops []models.OrderProduct) float64 {
+	var total float64
+	for _, op := range ops {
+		total += op.TotalPrice
+	}
+	return roundMoney(total)
+}
+
+// sumQuantity 明细数量合计
+func sumQuantity(ops []models.OrderProduct) int {
+	total := 0
+	for _, op := range ops {
+		total += op.Quantity
+	}
+	return total
+}
+
+// transferPaid 将原订单超出应收的已收金额转到另一订单（退款 + 收款成对记录）
+func transferPaid(tx *gorm.DB, from, to *models.Order, remark string) error {
+	excess := roundMoney(from.PaidAmount - from.Amount)
+	if excess <= 0 {
+		return nil
+	}
+	out := models.Payment{Type: models.PaymentRefund, Method: models.PayMethodOther, Amount: excess, Remark: remark + "转出至 " + to.OrderNo}
+	if err := recordPayment(tx, from, &out); err != nil {
+		return err
+	}
+	in := models.Payment{Type: models.PaymentNormal, Method: models.PayMethodOther, Amount: excess, Remark: remark + "转入自 " + from.OrderNo}
+	return recordPayment(tx, to, &in)
+}
+
+// SplitOrder 拆单：将部分明细（或部分数量）移入新的子订单，子订单拥有独立的订单号、二维码和状态
+func SplitOrder(c *gin.Context) {
+	var parent models.Order
+	if err := database.DB.Preload("OrderProducts").First(&parent, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
+		return
+	}
+
+	var input struct {
+		Lines []struct {
+			OrderProductID uint `json:"order_product_id"`
+			Quantity       int  `json:"quantity"` // 等于明细数量时整行移出
+		} `json:"lines"`
+		DeadlineStr string `json:"deadline_str"`
+		Remark      string `json:"remark"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if parent.Status == "已完成" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "订单已完成，不能拆分"})
+		return
+	}
+	if len(input.Lines) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请选择要拆出的产品明细"})
+		return
+	}
+
+	moveQty := make(map[uint]int)
+	for _, line := range input.Lines {
+		if line.Quantity <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("明细 %d 拆出数量必须大于0", line.OrderProductID)})
+			return
+		}
+		moveQty[line.OrderProductID] = line.Quantity
+	}
+
+	originalSubtotal := sumLines(parent.OrderProducts)
+	var remaining, moved, split []models.OrderProduct // split 为部分拆出的新明细
+	var movedIDs []uint
+	for _, op := range parent.OrderProducts {
+		qty, ok := moveQty[op.ID]
+		if !ok {
+			remaining = append(remaining, op)
+			continue
+		}
+		delete(moveQty, op.ID)
+
+		if qty > op.Quantity {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("明细 %d 拆出数量必须在 1-%d 之间", op.ID, op.Quantity)})
+			return
+		}
+		if qty == op.Quantity {
+			movedIDs = append(movedIDs, op.ID)
+			moved = append(moved, op)
+			continue
+		}
+
+		part := op
+		part.ID = 0
+		part.OrderID = 0
+		part.CreatedAt, part.UpdatedAt = time.Time{}, time.Time{}
+		part.Quantity = qty
+		if op.DiscountType == models.DiscountFixed {
+			// 固定金额的行折扣按数量比例拆分
+			part.DiscountValue = roundMoney(op.DiscountValue * float64(qty) / float64(op.Quantity))
+			op.DiscountValue = roundMoney(op.DiscountValue - part.DiscountValue)
+		}
+		op.Quantity -= qty
+		priceLine(&op)
+		priceLine(&part)
+		remaining = append(remaining, op)
+		split = append(split, part)
+		moved = append(moved, part)
+	}
+	if len(moveQty) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "明细不属于该订单"})
+		return
+	}
+	if len(remaining) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能拆出全部明细，原订单至少保留一项"})
+		return
+	}
+
+	child := models.Order{
+		ParentID:      &parent.ID,
+		CustomerID:    parent.CustomerID,
+		CustomerName:  parent.CustomerName,
+		Phone:         parent.Phone,
+		Address:       parent.Address,
+		Specs:         parent.Specs,
+		Remark:        parent.Remark,
+		Deadline:      parent.Deadline,
+		DiscountType:  parent.DiscountType,
+		DiscountValue: parent.DiscountValue,
+		OrderProducts: split,
+	}
+	if input.Remark != "" {
+		child.Remark = input.Remark
+	}
+	if d := parseDeadline(input.DeadlineStr); d != nil {
+		child.Deadline = d
+	}
+
+	// 金额核算：明细有单价时按明细重算，明细无单价（手工填写订单金额）时按数量比例分摊原订单小计；
+	// 整单固定折扣按金额比例分摊，保证拆分前后总额一致
+	childSubtotal, parentSubtotal := sumLines(moved), sumLines(remaining)
+	if originalSubtotal <= 0 {
+		originalSubtotal = parent.Subtotal
+		if originalSubtotal <= 0 {
+			originalSubtotal = parent.Amount
+		}
+		childSubtotal = roundMoney(originalSubtotal * float64(sumQuantity(moved)) / float64(max(sumQuantity(parent.OrderProducts), 1)))
+		parentSubtotal = roundMoney(originalSubtotal - childSubtotal)
+	}
+	if parent.DiscountType == models.DiscountFixed && originalSubtotal > 0 {
+		child.DiscountValue = roundMoney(parent.Discount * childSubtotal / originalSubtotal)
+		parent.DiscountValue = roundMoney(parent.Discount - child.DiscountValue)
+	}
+	applyOrderDiscount(&child, childSubtotal)
+	applyOrderDiscount(&parent, parentSubtotal)
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := createOrder(tx, &child); err != nil {
+			return err
+		}
+		// 子订单与原订单处于同一生产环节，等待时间从原订单进入该环节时算起
+		child.Status, child.StatusChangedAt = parent.Status, parent.StatusChangedAt
+		err := tx.Model(&child).Updates(map[string]interface{}{"status": child.Status, "status_changed_at": child.StatusChangedAt}).Error
+		if err != nil {
+			return err
+		}
+
+		if len(movedIDs) > 0 {
+			if err := tx.Model(&models.OrderProduct{}).Where("id IN ?", movedIDs).Update("order_id", child.ID).Error; err != nil {
+				return err
+			}
+		}
+		for i := range remaining {
+			if err := tx.Save(&remaining[i]).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Omit(clause.Associations).Save(&parent).Error; err != nil {
+			return err
+		}
+		return transferPaid(tx, &parent, &child, "拆单")
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	database.DB.Preload("OrderProducts").Preload("OrderProducts.Product").First(&parent, parent.ID)
+	database.DB.Preload("OrderProducts").Preload("OrderProducts.Product").First(&child, child.ID)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "已拆出子订单 " + child.OrderNo,
+		"parent":  parent,
+		"child":   child,
+	})
+}
+
+// MergeOrders 合并同一客户、同一生产环节的多个订单，明细、收款、生产记录和附件并入目标订单，其余订单删除
+func MergeOrders(c *gin.Context) {
+	var input struct {
+		OrderIDs []uint `json:"order_ids"`
+		TargetID uint   `json:"target_id"` // 默认为最早的订单
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var orders []models.Order
+	database.DB.Where("id IN ?", input.OrderIDs).Order("id asc").Find(&orders)
+	if len(orders) < 2 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "至少选择两个订单进行合并"})
+		return
+	}
+	if len(orders) != len(input.OrderIDs) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "部分订单不存在"})
+		return
+	}
+
+	target := &orders[0]
+	if input.TargetID != 0 {
+		target = nil
+		for i := range orders {
+			if orders[i].ID == input.TargetID {
+				target = &orders[i]
+			}
+		}
+		if target == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "目标订单必须在合并列表中"})
+			return
+		}
+	}
+
+	for _, o := range orders {
+		if o.Phone != target.Phone {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "只能合并同一客户的订单"})
+			return
+		}
+		if o.Status != target.Status {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("订单 %s 状态为 %s，与目标订单 %s 不一致", o.OrderNo, o.Status, target.Status)})
+			return
+		}
+	}
+
+	var subtotal, discount, amount float64
+	var sourceNos []string
+	for _, o := range orders {
+		subtotal += o.Subtotal
+		discount += o.Discount
+		amount += o.Amount
+		if o.ID != target.ID {
+			sourceNos = append(sourceNos, o.OrderNo)
+		}
+		if o.Deadline != nil && (target.Deadline == nil || o.Deadline.Before(*target.Deadline)) {
+			target.Deadline = o.Deadline
+		}
+	}
+	sort.Strings(sourceNos)
+
+	// 各单折扣汇总为固定金额，合并后总额等于各单之和
+	target.Subtotal = roundMoney(subtotal)
+	target.Discount = roundMoney(discount)
+	target.Amount = roundMoney(amount)
+	if target.Discount > 0 {
+		target.DiscountType = models.DiscountFixed
+		target.DiscountValue = target.Discount
+	}
+	note := "合并自 " + strings.Join(sourceNos, ", ")
+	if target.Remark != "" {
+		target.Remark += "；" + note
+	} else {
+		target.Remark = note
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		for i := range orders {
+			src := &orders[i]
+			if src.ID == target.ID {
+				continue
+			}
+			// 明细、收款、工序、扫码、配送和售后记录一并并入，保留生产历史；
+			// 与回收站使用同一张表清单，新增订单子表时两处同步生效
+			for _, model := range orderChildModels {
+				if err := tx.Unscoped().Model(model).Where("order_id = ?", src.ID).Update("order_id", target.ID).Error; err != nil {
+					return err
+				}
+			}
+			for _, ref := range orderRefs {
+				if err := tx.Unscoped().Model(ref.Model).Where(ref.Column+" = ?", src.ID).Update(ref.Column, target.ID).Error; err != nil {
+					return err
+				}
+			}
+			if err := tx.Model(&models.Attachment{}).
+				Where("owner_type = ? AND owner_id = ?", models.AttachmentOwnerOrder, src.ID).
+				Update("owner_id", target.ID).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(src).Update("merged_into_id", target.ID).Error; err != nil {
+				return err
+			}
+			if err := tx.Delete(src).Error; err != nil {
+				return err
+			}
+		}
+		// 目标订单原是被合并订单拆出的子订单时，合并后不能指向自己
+		for _, o := range orders {
+			if target.ParentID != nil && *target.ParentID == o.ID {
+				target.ParentID = nil
+			}
+		}
+		if err := tx.Omit(clause.Associations).Save(target).Error; err != nil {
+			return err
+		}
+		_, err := refreshOrderPaid(tx, target.ID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	database.DB.Preload("OrderProducts").Preload("OrderProducts.Product").First(target, target.ID)
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("已合并 %d 个订单到 %s", len(sourceNos), target.OrderNo),
+		"order":   target,
+	})
+}
+
+// resolveMergedOrder 订单已被合并时返回合并后的目标订单（旧二维码扫码时使用）
+func resolveMergedOrder(orderID uint) (models.Order, error) {
+	var order models.Order
+	for i := 0; i < 5; i++ {
+		var merged models.Order
+		if err := database.DB.Unscoped().Where("merged_into_id IS NOT NULL").First(&merged, orderID).Error; err != nil {
+			return order, errors.New("订单不存在")
+		}
+		if err := database.DB.First(&order, *merged.MergedIntoID).Error; err == nil {
+			return order, nil
+		}
+		orderID = *merged.MergedIntoID
+	}
+	return order, errors.New("订单不存在")
+}
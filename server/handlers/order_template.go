@@ -0,0 +1,404 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+	"trace-server/database"
+	"trace-server/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// itemInputsFromOrder 将已有订单明细转换为下单输入，reprice 为 true 时清空单价以按当前价目表重新取价
+func itemInputsFromOrder(orderProducts []models.OrderProduct, reprice bool) []OrderItemInput {
+	items := make([]OrderItemInput, 0, len(orderProducts))
+	for _, op := range orderProducts {
+		item := OrderItemInput{
+			ProductID:     op.ProductID,
+			Length:        op.Length,
+			Width:         op.Width,
+			Height:        op.Height,
+			Quantity:      op.Quantity,
+			Unit:          op.Unit,
+			UnitPrice:     op.UnitPrice,
+			DiscountType:  op.DiscountType,
+			DiscountValue: op.DiscountValue,
+			ExtraAttrs:    op.ExtraAttrs,
+		}
+		if reprice {
+			item.UnitPrice = 0
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// templateItemsFromInputs 将输入明细转换为模板明细
+func templateItemsFromInputs(inputs []OrderItemInput) []models.OrderTemplateItem {
+	items := make([]models.OrderTemplateItem, 0, len(inputs))
+	for _, in := range inputs {
+		items = append(items, models.OrderTemplateItem{
+			ProductID:     in.ProductID,
+			Length:        in.Length,
+			Width:         in.Width,
+			Height:        in.Height,
+			Quantity:      in.Quantity,
+			Unit:          in.Unit,
+			UnitPrice:     in.UnitPrice,
+			DiscountType:  in.DiscountType,
+			DiscountValue: in.DiscountValue,
+			ExtraAttrs:    in.ExtraAttrs,
+		})
+	}
+	return items
+}
+
+// validateTemplateItems 校验模板明细
+func validateTemplateItems(items []OrderItemInput) error {
+	if len(items) == 0 {
+		return errors.New("模板必须包含至少一个产品")
+	}
+	for _, item := range items {
+		if item.ProductID == 0 {
+			return errors.New("模板明细必须选择产品")
+		}
+		if err := validateDiscount(item.DiscountType, item.DiscountValue); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseDeadline 解析 YYYY-MM-DD 格式的交货日期，为空或格式错误时返回 nil
+func parseDeadline(s string) *time.Time {
+	if s == "" {
+		return nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// CloneOrder 复制订单：沿用原订单的客户、地址、备注和产品明细生成新订单
+func CloneOrder(c *gin.Context) {
+	var source models.Order
+	if err := database.DB.Preload("OrderProducts").First(&source, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
+		return
+	}
+
+	var input struct {
+		DeadlineStr string `json:"deadline_str"`
+		Reprice     bool   `json:"reprice"` // 按当前价目表重新取价
+	}
+	// 请求体可为空
+	c.ShouldBindJSON(&input)
+
+	// 明细无单价的旧订单按原订单金额
+	fallbackAmount := source.Subtotal
+	if fallbackAmount <= 0 {
+		fallbackAmount = source.Amount
+	}
+
+	order := models.Order{
+		CustomerName:  source.CustomerName,
+		Phone:         source.Phone,
+		Address:       source.Address,
+		Specs:         source.Specs,
+		Remark:        source.Remark,
+		DiscountType:  source.DiscountType,
+		DiscountValue: source.DiscountValue,
+		Amount:        fallbackAmount,
+		Deadline:      parseDeadline(input.DeadlineStr),
+	}
+	if err := prepareOrder(&order, itemInputsFromOrder(source.OrderProducts, input.Reprice)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		return createOrder(tx, &order)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// SaveOrderAsTemplate 将订单保存为客户模板
+func SaveOrderAsTemplate(c *gin.Context) {
+	var order models.Order
+	if err := database.DB.Preload("OrderProducts").First(&order, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
+		return
+	}
+
+	var input struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "模板名称不能为空"})
+		return
+	}
+	if len(order.OrderProducts) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "订单没有产品明细"})
+		return
+	}
+
+	customer, err := findOrCreateCustomer(database.DB, order.CustomerName, order.Phone)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	template := models.OrderTemplate{
+		CustomerID:    customer.ID,
+		Name:          input.Name,
+		Address:       order.Address,
+		Specs:         order.Specs,
+		Remark:        order.Remark,
+		DiscountType:  order.DiscountType,
+		DiscountValue: order.DiscountValue,
+		Items:         templateItemsFromInputs(itemInputsFromOrder(order.OrderProducts, false)),
+	}
+	if err := database.DB.Create(&template).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, template)
+}
+
+// GetCustomerTemplates 获取客户的订单模板
+func GetCustomerTemplates(c *gin.Context) {
+	templates := make([]models.OrderTemplate, 0)
+	database.DB.Preload("Items").Preload("Items.Product").
+		Where("customer_id = ?", c.Param("id")).
+		Order("id desc").
+		Find(&templates)
+	c.JSON(http.StatusOK, templates)
+}
+
+// GetOrderTemplate 获取模板详情
+func GetOrderTemplate(c *gin.Context) {
+	var template models.OrderTemplate
+	if err := database.DB.Preload("Items").Preload("Items.Product").Preload("Items.Product.Attributes").
+		First(&template, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "模板不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, template)
+}
+
+// orderTemplateInput 创建/编辑模板的输入
+type orderTemplateInput struct {
+	CustomerID    uint             `json:"customer_id"`
+	Name          string           `json:"name"`
+	Address       string           `json:"address"`
+	Specs         string           `json:"specs"`
+	Remark        string           `json:"remark"`
+	DiscountType  string           `json:"discount_type"`
+	DiscountValue float64          `json:"discount_value"`
+	Items         []OrderItemInput `json:"items"`
+}
+
+// CreateOrderTemplate 新建客户模板
+func CreateOrderTemplate(c *gin.Context) {
+	var input orderTemplateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "模板名称不能为空"})
+		return
+	}
+	var customer models.Customer
+	if err := database.DB.First(&customer, input.CustomerID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "客户不存在"})
+		return
+	}
+	if err := validateDiscount(input.DiscountType, input.DiscountValue); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateTemplateItems(input.Items); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	template := models.OrderTemplate{
+		CustomerID:    customer.ID,
+		Name:          input.Name,
+		Address:       input.Address,
+		Specs:         input.Specs,
+		Remark:        input.Remark,
+		DiscountType:  input.DiscountType,
+		DiscountValue: input.DiscountValue,
+		Items:         templateItemsFromInputs(input.Items),
+	}
+	if err := database.DB.Create(&template).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, template)
+}
+
+// UpdateOrderTemplate 编辑模板，提供明细时整体替换
+func UpdateOrderTemplate(c *gin.Context) {
+	var template models.OrderTemplate
+	if err := database.DB.First(&template, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "模板不存在"})
+		return
+	}
+
+	var input orderTemplateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "模板名称不能为空"})
+		return
+	}
+	if err := validateDiscount(input.DiscountType, input.DiscountValue); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	template.Name = input.Name
+	template.Address = input.Address
+	template.Specs = input.Specs
+	template.Remark = input.Remark
+	template.DiscountType = input.DiscountType
+	template.DiscountValue = input.DiscountValue
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if len(input.Items) > 0 {
+			if err := validateTemplateItems(input.Items); err != nil {
+				return err
+			}
+			if err := tx.Where("template_id = ?", template.ID).Delete(&models.OrderTemplateItem{}).Error; err != nil {
+				return err
+			}
+			template.Items = templateItemsFromInputs(input.Items)
+		}
+		return tx.Save(&template).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	database.DB.Preload("Items").Preload("Items.Product").First(&template, template.ID)
+	c.JSON(http.StatusOK, template)
+}
+
+// DeleteOrderTemplate 删除模板
+func DeleteOrderTemplate(c *gin.Context) {
+	var template models.OrderTemplate
+	if err := database.DB.First(&template, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "模板不存在"})
+		return
+	}
+
+	database.DB.Where("template_id = ?", template.ID).Delete(&models.OrderTemplateItem{})
+	database.DB.Delete(&template)
+	c.JSON(http.StatusOK, gin.H{"message": "模板已删除"})
+}
+
+// CreateOrderFromTemplate 按模板下单，可按模板明细ID调整数量（数量为 0 的行不下单）
+func CreateOrderFromTemplate(c *gin.Context) {
+	var template models.OrderTemplate
+	if err := database.DB.Preload("Items").First(&template, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "模板不存在"})
+		return
+	}
+
+	var customer models.Customer
+	if err := database.DB.First(&customer, template.CustomerID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "模板关联的客户不存在"})
+		return
+	}
+
+	var input struct {
+		Quantities  map[string]int `json:"quantities"` // key 为模板明细ID
+		DeadlineStr string         `json:"deadline_str"`
+		Remark      *string        `json:"remark"`  // 为空时沿用模板备注
+		Reprice     bool           `json:"reprice"` // 忽略模板单价，按当前价目表取价
+	}
+	// 请求体可为空
+	c.ShouldBindJSON(&input)
+
+	items := make([]OrderItemInput, 0, len(template.Items))
+	for _, ti := range template.Items {
+		quantity := ti.Quantity
+		if q, ok := input.Quantities[strconv.Itoa(int(ti.ID))]; ok {
+			quantity = q
+		}
+		if quantity <= 0 {
+			continue
+		}
+		item := OrderItemInput{
+			ProductID:     ti.ProductID,
+			Length:        ti.Length,
+			Width:         ti.Width,
+			Height:        ti.Height,
+			Quantity:      quantity,
+			Unit:          ti.Unit,
+			UnitPrice:     ti.UnitPrice,
+			DiscountType:  ti.DiscountType,
+			DiscountValue: ti.DiscountValue,
+			ExtraAttrs:    ti.ExtraAttrs,
+		}
+		if input.Reprice {
+			item.UnitPrice = 0
+		}
+		items = append(items, item)
+	}
+
+	order := models.Order{
+		CustomerName:  customer.Name,
+		Phone:         customer.Phone,
+		Address:       template.Address,
+		Specs:         template.Specs,
+		Remark:        template.Remark,
+		DiscountType:  template.DiscountType,
+		DiscountValue: template.DiscountValue,
+		Deadline:      parseDeadline(input.DeadlineStr),
+	}
+	if order.Address == "" {
+		order.Address = customer.Address
+	}
+	if input.Remark != nil {
+		order.Remark = *input.Remark
+	}
+
+	if err := prepareOrder(&order, items); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		return createOrder(tx, &order)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
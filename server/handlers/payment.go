@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+	"trace-server/database"
+	"trace-server/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// validPaymentType 校验收款类型
+func validPaymentType(t string) bool {
+	switch t {
+	case models.PaymentDeposit, models.PaymentNormal, models.PaymentRefund, models.PaymentAllowance:
+		return true
+	}
+	return false
+}
+
+// validPaymentMethod 校验收款方式
+func validPaymentMethod(m string) bool {
+	switch m {
+	case models.PayMethodCash, models.PayMethodWeChat, models.PayMethodAlipay, models.PayMethodBank, models.PayMethodOther:
+		return true
+	}
+	return false
+}
+
+// refreshOrderPaid 根据收款记录重新汇总订单已收金额
+func refreshOrderPaid(tx *gorm.DB, orderID uint) (float64, error) {
+	var paid float64
+	err := tx.Model(&models.Payment{}).
+		Where("order_id = ?", orderID).
+		Select("COALESCE(SUM(CASE WHEN type = ? THEN -amount ELSE amount END), 0)", models.PaymentRefund).
+		Scan(&paid).Error
+	if err != nil {
+		return 0, err
+	}
+	paid = roundMoney(paid)
+	return paid, tx.Model(&models.Order{}).Where("id = ?", orderID).Update("paid_amount", paid).Error
+}
+
+// refundableAmount 订单可退金额：实收的定金和收款减去此前的退款，折让不是实收不可退
+func refundableAmount(tx *gorm.DB, orderID uint) (float64, error) {
+	var received float64
+	err := tx.Model(&models.Payment{}).
+		Where("order_id = ?", orderID).
+		Select("COALESCE(SUM(CASE WHEN type = ? THEN -amount WHEN type = ? THEN 0 ELSE amount END), 0)", models.PaymentRefund, models.PaymentAllowance).
+		Scan(&received).Error
+	return roundMoney(received), err
+}
+
+// orderBalance 订单未收余额
+func orderBalance(order *models.Order) float64 {
+	return roundMoney(order.Amount - order.PaidAmount)
+}
+
+// recordPayment 记录一笔收付款并更新订单已收金额
+func recordPayment(tx *gorm.DB, order *models.Order, payment *models.Payment) error {
+	if !validPaymentType(payment.Type) {
+		return errors.New("无效的收款类型: " + payment.Type)
+	}
+	if !validPaymentMethod(payment.Method) {
+		return errors.New("无效的收款方式: " + payment.Method)
+	}
+	payment.Amount = roundMoney(payment.Amount)
+	if payment.Amount <= 0 {
+		return errors.New("金额必须大于0")
+	}
+	if payment.Type == models.PaymentRefund && payment.Amount > order.PaidAmount {
+		return errors.New("退款金额不能超过已收金额")
+	}
+
+	payment.OrderID = order.ID
+	payment.CustomerID = order.CustomerID
+	if payment.PaidAt.IsZero() {
+		payment.PaidAt = time.Now()
+	}
+	if err := tx.Create(payment).Error; err != nil {
+		return err
+	}
+
+	paid, err := refreshOrderPaid(tx, order.ID)
+	if err != nil {
+		return err
+	}
+	order.PaidAmount = paid
+	return nil
+}
+
+// GetOrderPayments 获取订单收款记录及余额
+func GetOrderPayments(c *gin.Context) {
+	var order models.Order
+	if err := database.DB.First(&order, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
+		return
+	}
+
+	payments := make([]models.Payment, 0)
+	database.DB.Where("order_id = ?", order.ID).Order("paid_at asc, id asc").Find(&payments)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": payments,
+		"summary": gin.H{
+			"amount":  order.Amount,
+			"paid":    order.PaidAmount,
+			"balance": orderBalance(&order),
+		},
+	})
+}
+
+// CreateOrderPayment 登记定金、收款或退款
+func CreateOrderPayment(c *gin.Context) {
+	var order models.Order
+	if err := database.DB.First(&order, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
+		return
+	}
+
+	var input struct {
+		Type      string  `json:"type"`
+		Method    string  `json:"method"`
+		Amount    float64 `json:"amount"`
+		PaidAtStr string  `json:"paid_at_str"` // YYYY-MM-DD，默认当前时间
+		Remark    string  `json:"remark"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	payment := models.Payment{
+		Type:     input.Type,
+		Method:   input.Method,
+		Amount:   input.Amount,
+		Operator: c.GetString("username"),
+		Remark:   input.Remark,
+	}
+	if input.PaidAtStr != "" {
+		t, err := time.ParseInLocation("2006-01-02", input.PaidAtStr, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "收款日期格式错误，应为 YYYY-MM-DD"})
+			return
+		}
+		payment.PaidAt = t
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		return recordPayment(tx, &order, &payment)
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"payment": payment,
+		"summary": gin.H{
+			"amount":  order.Amount,
+			"paid":    order.PaidAmount,
+			"balance": orderBalance(&order),
+		},
+	})
+}
+
+// DeletePayment 撤销一笔登记错误的收款记录
+func DeletePayment(c *gin.Context) {
+	var payment models.Payment
+	if err := database.DB.First(&payment, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "收款记录不存在"})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&payment).Error; err != nil {
+			return err
+		}
+		_, err := refreshOrderPaid(tx, payment.OrderID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "收款记录已撤销"})
+}
+
+// GetCustomerBalance 客户应收汇总：订单总额、已收、未收及欠款订单
+func GetCustomerBalance(c *gin.Context) {
+	var customer models.Customer
+	if err := database.DB.First(&customer, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "客户不存在"})
+		return
+	}
+
+	var orders []models.Order
+	database.DB.Where("customer_id = ? OR (customer_id = 0 AND phone = ?)", customer.ID, customer.Phone).
+		Order("created_at asc").
+		Find(&orders)
+
+	var totalAmount, totalPaid float64
+	openOrders := make([]gin.H, 0)
+	for i := range orders {
+		o := &orders[i]
+		totalAmount += o.Amount
+		totalPaid += o.PaidAmount
+		if balance := orderBalance(o); balance > 0 {
+			openOrders = append(openOrders, gin.H{
+				"id":         o.ID,
+				"order_no":   o.OrderNo,
+				"status":     o.Status,
+				"created_at": o.CreatedAt,
+				"amount":     o.Amount,
+				"paid":       o.PaidAmount,
+				"balance":    balance,
+			})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"customer":    customer,
+		"amount":      roundMoney(totalAmount),
+		"paid":        roundMoney(totalPaid),
+		"balance":     roundMoney(totalAmount - totalPaid),
+		"open_orders": openOrders,
+	})
+}
+
+// GetReceivablesAging 应收账龄报表，按下单日期分为 0-30/31-60/61-90/90天以上
+func GetReceivablesAging(c *gin.Context) {
+	asOf := time.Now()
+	if s := c.Query("as_of"); s != "" {
+		t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "日期格式错误，应为 YYYY-MM-DD"})
+			return
+		}
+		asOf = t.Add(24*time.Hour - time.Nanosecond)
+	}
+
+	var orders []models.Order
+	database.DB.Where("amount > ? AND created_at <= ?", 0.005, asOf).
+		Order("created_at asc").
+		Find(&orders)
+
+	// 已收金额按截止日期前的收付款记录重新汇总，而不是订单当前的已收金额
+	var paidRows []struct {
+		OrderID uint
+		Paid    float64
+	}
+	database.DB.Model(&models.Payment{}).
+		Select("order_id, COALESCE(SUM(CASE WHEN type = ? THEN -amount ELSE amount END), 0) AS paid", models.PaymentRefund).
+		Where("paid_at <= ?", asOf).
+		Where("order_id IN (?)", database.DB.Model(&models.Order{}).Select("id").Where("created_at <= ?", asOf)).
+		Group("order_id").
+		Scan(&paidRows)
+	paidAsOf := make(map[uint]float64, len(paidRows))
+	for _, p := range paidRows {
+		paidAsOf[p.OrderID] = p.Paid
+	}
+
+	type AgingRow struct {
+		CustomerID   uint    `json:"customer_id"`
+		CustomerName string  `json:"customer_name"`
+		Phone        string  `json:"phone"`
+		Current      float64 `json:"current"` // 0-30 天
+		Days31To60   float64 `json:"days_31_60"`
+		Days61To90   float64 `json:"days_61_90"`
+		Over90       float64 `json:"over_90"`
+		Total        float64 `json:"total"`
+		OrderCount   int     `json:"order_count"`
+	}
+
+	rows := make(map[string]*AgingRow)
+	var totals AgingRow
+	for i := range orders {
+		o := &orders[i]
+		balance := roundMoney(o.Amount - paidAsOf[o.ID])
+		if balance <= 0 {
+			continue
+		}
+		days := int(asOf.Sub(o.CreatedAt).Hours() / 24)
+
+		// 客户手机号唯一，旧订单没有客户ID时同样可按电话归集
+		row, ok := rows[o.Phone]
+		if !ok {
+			row = &AgingRow{CustomerName: o.CustomerName, Phone: o.Phone}
+			rows[o.Phone] = row
+		}
+		if row.CustomerID == 0 {
+			row.CustomerID = o.CustomerID
+		}
+
+		for _, r := range []*AgingRow{row, &totals} {
+			switch {
+			case days <= 30:
+				r.Current = roundMoney(r.Current + balance)
+			case days <= 60:
+				r.Days31To60 = roundMoney(r.Days31To60 + balance)
+			case days <= 90:
+				r.Days61To90 = roundMoney(r.Days61To90 + balance)
+			default:
+				r.Over90 = roundMoney(r.Over90 + balance)
+			}
+			r.Total = roundMoney(r.Total + balance)
+			r.OrderCount++
+		}
+	}
+
+	result := make([]AgingRow, 0, len(rows))
+	for _, row := range rows {
+		result = append(result, *row)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Total > result[j].Total })
+
+	c.JSON(http.StatusOK, gin.H{
+		"as_of":  asOf.Format("2006-01-02"),
+		"data":   result,
+		"totals": totals,
+	})
+}
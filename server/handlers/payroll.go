@@ -0,0 +1,723 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+	"trace-server/database"
+	"trace-server/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ---------- 计件工价 ----------
+
+// GetPieceRates 获取计件工价列表
+func GetPieceRates(c *gin.Context) {
+	var rates []models.PieceRate
+	query := database.DB.Preload("Product").Order("station asc, product_id asc")
+	if station := c.Query("station"); station != "" {
+		query = query.Where("station = ?", station)
+	}
+	query.Find(&rates)
+	c.JSON(http.StatusOK, rates)
+}
+
+// CreatePieceRate 新增计件工价
+func CreatePieceRate(c *gin.Context) {
+	var rate models.PieceRate
+	if err := c.ShouldBindJSON(&rate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validatePieceRate(&rate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := database.DB.Create(&rate).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	database.DB.Preload("Product").First(&rate, rate.ID)
+	c.JSON(http.StatusOK, rate)
+}
+
+// UpdatePieceRate 修改计件工价，只影响之后重新计算的工资期
+func UpdatePieceRate(c *gin.Context) {
+	var rate models.PieceRate
+	if err := database.DB.First(&rate, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "工价不存在"})
+		return
+	}
+	var input models.PieceRate
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.ID = rate.ID
+	if err := validatePieceRate(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rate.Station = input.Station
+	rate.ProductID = input.ProductID
+	rate.Unit = input.Unit
+	rate.Rate = input.Rate
+	rate.Remark = input.Remark
+	if err := database.DB.Omit("Product").Save(&rate).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	database.DB.Preload("Product").First(&rate, rate.ID)
+	c.JSON(http.StatusOK, rate)
+}
+
+// DeletePieceRate 删除计件工价
+func DeletePieceRate(c *gin.Context) {
+	if err := database.DB.Delete(&models.PieceRate{}, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "工价已删除"})
+}
+
+// validatePieceRate 校验工价，同一工位和产品只能有一条
+func validatePieceRate(rate *models.PieceRate) error {
+	if rate.Station == "" {
+		return errors.New("工位不能为空")
+	}
+	if rate.Unit == "" {
+		rate.Unit = models.RateUnitPiece
+	}
+	if rate.Unit != models.RateUnitPiece && rate.Unit != models.RateUnitSqm {
+		return errors.New("计件单位只能是 件 或 平米")
+	}
+	if rate.Rate < 0 {
+		return errors.New("工价不能为负数")
+	}
+	if rate.ProductID != 0 {
+		var product models.Product
+		if err := database.DB.First(&product, rate.ProductID).Error; err != nil {
+			return errors.New("产品不存在")
+		}
+	}
+	var count int64
+	database.DB.Model(&models.PieceRate{}).
+		Where("station = ? AND product_id = ? AND id <> ?", rate.Station, rate.ProductID, rate.ID).
+		Count(&count)
+	if count > 0 {
+		return errors.New("该工位和产品的工价已存在")
+	}
+	return nil
+}
+
+// pieceRateTable 按工位和产品查找工价，找不到产品专属工价时使用该工位的通用工价；
+// 工位按工位表匹配，别名（如运货）与工位名视为同一工位
+type pieceRateTable struct {
+	rates    map[string]models.PieceRate
+	stations stationIndex
+}
+
+func loadPieceRates(tx *gorm.DB) pieceRateTable {
+	var rates []models.PieceRate
+	tx.Find(&rates)
+	table := pieceRateTable{rates: make(map[string]models.PieceRate, len(rates)), stations: loadStationIndex(tx)}
+	for _, r := range rates {
+		table.rates[fmt.Sprintf("%s|%d", table.stations.canonical(r.Station), r.ProductID)] = r
+	}
+	return table
+}
+
+func (t pieceRateTable) find(station string, productID uint) (models.PieceRate, bool) {
+	station = t.stations.canonical(station)
+	if r, ok := t.rates[fmt.Sprintf("%s|%d", station, productID)]; ok {
+		return r, true
+	}
+	r, ok := t.rates[station+"|0"]
+	return r, ok
+}
+
+// ---------- 工资期 ----------
+
+// GetPayrollPeriods 获取工资期列表
+func GetPayrollPeriods(c *gin.Context) {
+	var periods []models.PayrollPeriod
+	database.DB.Order("start_date desc").Find(&periods)
+	c.JSON(http.StatusOK, periods)
+}
+
+// CreatePayrollPeriod 新建工资期并计算计件工资
+func CreatePayrollPeriod(c *gin.Context) {
+	var input struct {
+		Name      string `json:"name"`
+		StartDate string `json:"start_date"`
+		EndDate   string `json:"end_date"`
+		Remark    string `json:"remark"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	start, err := time.ParseInLocation("2006-01-02", input.StartDate, time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "开始日期格式应为 YYYY-MM-DD"})
+		return
+	}
+	end, err := time.ParseInLocation("2006-01-02", input.EndDate, time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "结束日期格式应为 YYYY-MM-DD"})
+		return
+	}
+	if end.Before(start) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "结束日期不能早于开始日期"})
+		return
+	}
+
+	// 工资期不能重叠，避免同一工序重复计薪
+	var overlap models.PayrollPeriod
+	if err := database.DB.Where("start_date <= ? AND end_date >= ?", end, start).First(&overlap).Error; err == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("与工资期「%s」时间重叠", overlap.Name)})
+		return
+	}
+
+	period := models.PayrollPeriod{
+		Name:      input.Name,
+		StartDate: start,
+		EndDate:   end,
+		Status:    models.PayrollDraft,
+		Remark:    input.Remark,
+	}
+	if period.Name == "" {
+		period.Name = start.Format("2006-01-02") + " ~ " + end.Format("2006-01-02")
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&period).Error; err != nil {
+			return err
+		}
+		return calculatePayroll(tx, &period)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, period)
+}
+
+// GetPayrollPeriod 工资期详情，含每个工人的汇总
+func GetPayrollPeriod(c *gin.Context) {
+	period, ok := findPayrollPeriod(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"period":  period,
+		"workers": payrollSummary(period.ID),
+	})
+}
+
+// GetPayrollWorker 某工人在工资期内的计件明细和调整
+func GetPayrollWorker(c *gin.Context) {
+	period, ok := findPayrollPeriod(c)
+	if !ok {
+		return
+	}
+	workerID, _ := strconv.Atoi(c.Param("workerId"))
+
+	var lines []models.PayrollLine
+	database.DB.Where("period_id = ? AND worker_id = ?", period.ID, workerID).
+		Order("completed_at asc, id asc").Find(&lines)
+	var adjustments []models.PayrollAdjustment
+	database.DB.Where("period_id = ? AND worker_id = ?", period.ID, workerID).
+		Order("id asc").Find(&adjustments)
+
+	var summary *payrollWorker
+	for _, s := range payrollSummary(period.ID) {
+		if s.WorkerID == uint(workerID) {
+			summary = &s
+			break
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"period":      period,
+		"summary":     summary,
+		"lines":       lines,
+		"adjustments": adjustments,
+	})
+}
+
+// RecalculatePayrollPeriod 按当前工价和扫码记录重新计算（仅草稿）
+func RecalculatePayrollPeriod(c *gin.Context) {
+	period, ok := findDraftPayrollPeriod(c)
+	if !ok {
+		return
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		return calculatePayroll(tx, &period)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, period)
+}
+
+// DeletePayrollPeriod 删除工资期（仅草稿）
+func DeletePayrollPeriod(c *gin.Context) {
+	period, ok := findDraftPayrollPeriod(c)
+	if !ok {
+		return
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("period_id = ?", period.ID).Delete(&models.PayrollLine{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("period_id = ?", period.ID).Delete(&models.PayrollAdjustment{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&period).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "工资期已删除"})
+}
+
+// LockPayrollPeriod 锁定工资期，锁定后不再重算和调整
+func LockPayrollPeriod(c *gin.Context) {
+	changePayrollStatus(c, models.PayrollDraft, models.PayrollLocked)
+}
+
+// UnlockPayrollPeriod 解锁工资期，恢复为草稿
+func UnlockPayrollPeriod(c *gin.Context) {
+	changePayrollStatus(c, models.PayrollLocked, models.PayrollDraft)
+}
+
+// ApprovePayrollPeriod 审核已锁定的工资期，审核后不可更改
+func ApprovePayrollPeriod(c *gin.Context) {
+	changePayrollStatus(c, models.PayrollLocked, models.PayrollApproved)
+}
+
+func changePayrollStatus(c *gin.Context, from, to string) {
+	period, ok := findPayrollPeriod(c)
+	if !ok {
+		return
+	}
+	if period.Status != from {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("工资期状态为 %s，不能改为 %s", period.Status, to)})
+		return
+	}
+
+	now := time.Now()
+	operator := c.GetString("username")
+	updates := map[string]interface{}{"status": to}
+	switch to {
+	case models.PayrollLocked:
+		updates["locked_by"] = operator
+		updates["locked_at"] = &now
+	case models.PayrollApproved:
+		updates["approved_by"] = operator
+		updates["approved_at"] = &now
+	case models.PayrollDraft:
+		updates["locked_by"] = ""
+		updates["locked_at"] = nil
+	}
+	// 条件更新，避免并发操作跳过状态
+	result := database.DB.Model(&models.PayrollPeriod{}).
+		Where("id = ? AND status = ?", period.ID, from).
+		Updates(updates)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "工资期状态已变化，请刷新后重试"})
+		return
+	}
+	database.DB.First(&period, period.ID)
+	c.JSON(http.StatusOK, period)
+}
+
+// CreatePayrollAdjustment 添加工资调整（仅草稿），奖励为正、扣款为负
+func CreatePayrollAdjustment(c *gin.Context) {
+	period, ok := findDraftPayrollPeriod(c)
+	if !ok {
+		return
+	}
+	var adj models.PayrollAdjustment
+	if err := c.ShouldBindJSON(&adj); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	adj.Amount = roundMoney(adj.Amount)
+	if adj.Amount == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "调整金额不能为0"})
+		return
+	}
+	if adj.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请填写调整原因"})
+		return
+	}
+	var worker models.Worker
+	if err := database.DB.First(&worker, adj.WorkerID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "工人不存在"})
+		return
+	}
+	adj.ID = 0
+	adj.PeriodID = period.ID
+	adj.Operator = c.GetString("username")
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&adj).Error; err != nil {
+			return err
+		}
+		return refreshPayrollAmount(tx, &period)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, adj)
+}
+
+// DeletePayrollAdjustment 删除工资调整（仅草稿）
+func DeletePayrollAdjustment(c *gin.Context) {
+	var adj models.PayrollAdjustment
+	if err := database.DB.First(&adj, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "调整记录不存在"})
+		return
+	}
+	var period models.PayrollPeriod
+	if err := database.DB.First(&period, adj.PeriodID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "工资期不存在"})
+		return
+	}
+	if period.Status != models.PayrollDraft {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "工资期已锁定，不能修改"})
+		return
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&adj).Error; err != nil {
+			return err
+		}
+		return refreshPayrollAmount(tx, &period)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "调整已删除"})
+}
+
+// ExportPayrollPeriod 导出工资表：xlsx 含汇总、计件明细、调整三个工作表，csv 用 sheet=summary|lines|adjustments 选择
+func ExportPayrollPeriod(c *gin.Context) {
+	period, ok := findPayrollPeriod(c)
+	if !ok {
+		return
+	}
+	e, err := newExporter(c, "工资表_"+period.Name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = e.sheet("summary", "汇总", []exportColumn{
+		{Title: "工人", Width: 12},
+		{Title: "件数", Kind: exportInt},
+		{Title: "平米", Kind: exportNumber},
+		{Title: "计件工资", Kind: exportMoney},
+		{Title: "调整", Kind: exportMoney},
+		{Title: "应发", Kind: exportMoney},
+		{Title: "未设工价明细", Width: 14, Kind: exportInt},
+	})
+	for _, s := range payrollSummary(period.ID) {
+		if err != nil {
+			break
+		}
+		err = e.write(s.WorkerName, s.Quantity, s.Area, s.PieceAmount, s.Adjustment, s.Total, s.Unpriced)
+	}
+	if err != nil {
+		exportFailed(c, err)
+		return
+	}
+
+	err = e.sheet("lines", "计件明细", []exportColumn{
+		{Title: "工人", Width: 12},
+		{Title: "完成时间", Width: 17, Kind: exportDateTime},
+		{Title: "工位", Width: 10},
+		{Title: "订单号", Width: 16},
+		{Title: "产品", Width: 12},
+		{Title: "长", Width: 8, Kind: exportNumber},
+		{Title: "宽", Width: 8, Kind: exportNumber},
+		{Title: "数量", Width: 8, Kind: exportInt},
+		{Title: "平米", Width: 8, Kind: exportNumber},
+		{Title: "计件单位", Width: 9},
+		{Title: "工价", Kind: exportMoney},
+		{Title: "金额", Kind: exportMoney},
+		{Title: "备注", Width: 20},
+	})
+	if err != nil {
+		exportFailed(c, err)
+		return
+	}
+	batches := database.DB.Model(&models.PayrollLine{}).
+		Where("period_id = ?", period.ID).
+		Order("worker_name asc, completed_at asc, id asc").
+		Session(&gorm.Session{})
+	for offset := 0; !e.skip; offset += exportBatch {
+		var lines []models.PayrollLine
+		if err := batches.Offset(offset).Limit(exportBatch).Find(&lines).Error; err != nil {
+			exportFailed(c, err)
+			return
+		}
+		for _, l := range lines {
+			err := e.write(l.WorkerName, l.CompletedAt, l.Station, l.OrderNo, l.ProductName, l.Length, l.Width,
+				l.Quantity, l.Area, l.Unit, l.Rate, l.Amount, l.Note)
+			if err != nil {
+				exportFailed(c, err)
+				return
+			}
+		}
+		if len(lines) < exportBatch {
+			break
+		}
+	}
+
+	err = e.sheet("adjustments", "调整", []exportColumn{
+		{Title: "工人", Width: 12},
+		{Title: "金额", Kind: exportMoney},
+		{Title: "原因", Width: 30},
+		{Title: "操作人", Width: 10},
+		{Title: "时间", Width: 17, Kind: exportDateTime},
+	})
+	var adjustments []struct {
+		models.PayrollAdjustment
+		WorkerName string
+	}
+	database.DB.Model(&models.PayrollAdjustment{}).
+		Select("payroll_adjustments.*, workers.name as worker_name").
+		Joins("left join workers on workers.id = payroll_adjustments.worker_id").
+		Where("payroll_adjustments.period_id = ?", period.ID).
+		Order("workers.name asc, payroll_adjustments.id asc").
+		Scan(&adjustments)
+	for _, a := range adjustments {
+		if err != nil {
+			break
+		}
+		err = e.write(a.WorkerName, a.Amount, a.Reason, a.Operator, a.CreatedAt)
+	}
+	if err == nil {
+		err = e.close(c)
+	}
+	if err != nil {
+		exportFailed(c, err)
+	}
+}
+
+func findPayrollPeriod(c *gin.Context) (models.PayrollPeriod, bool) {
+	var period models.PayrollPeriod
+	if err := database.DB.First(&period, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "工资期不存在"})
+		return period, false
+	}
+	return period, true
+}
+
+func findDraftPayrollPeriod(c *gin.Context) (models.PayrollPeriod, bool) {
+	period, ok := findPayrollPeriod(c)
+	if ok && period.Status != models.PayrollDraft {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "工资期已锁定，不能修改"})
+		return period, false
+	}
+	return period, ok
+}
+
+// calculatePayroll 重新生成工资期的计件明细：期内每条工序完成记录按订单明细逐行计价
+func calculatePayroll(tx *gorm.DB, period *models.PayrollPeriod) error {
+	if err := tx.Unscoped().Where("period_id = ?", period.ID).Delete(&models.PayrollLine{}).Error; err != nil {
+		return err
+	}
+
+	// 工序记录随订单一起删除，已删除订单的工序同样计薪
+	var processes []models.Process
+	err := tx.Unscoped().Where("created_at >= ? AND created_at < ? AND worker_id > 0", period.StartDate, period.EndDate.AddDate(0, 0, 1)).
+		Order("created_at asc, id asc").
+		Find(&processes).Error
+	if err != nil {
+		return err
+	}
+
+	rates := loadPieceRates(tx)
+	workers := map[uint]models.Worker{}
+	orders := map[uint]models.Order{}
+	var workerIDs, orderIDs []uint
+	for _, p := range processes {
+		workerIDs = append(workerIDs, p.WorkerID)
+		orderIDs = append(orderIDs, p.OrderID)
+	}
+	if len(processes) > 0 {
+		// 已删除的工人和订单同样计薪
+		var ws []models.Worker
+		tx.Unscoped().Where("id IN ?", workerIDs).Find(&ws)
+		for _, w := range ws {
+			workers[w.ID] = w
+		}
+		var list []models.Order
+		tx.Unscoped().
+			Preload("OrderProducts", func(db *gorm.DB) *gorm.DB { return db.Unscoped().Order("id asc") }).
+			Preload("OrderProducts.Product", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+			Where("id IN ?", orderIDs).Find(&list)
+		for _, o := range list {
+			o.OrderProducts = payrollOrderLines(o)
+			orders[o.ID] = o
+		}
+	}
+
+	var lines []models.PayrollLine
+	for _, p := range processes {
+		base := models.PayrollLine{
+			PeriodID:    period.ID,
+			WorkerID:    p.WorkerID,
+			WorkerName:  workers[p.WorkerID].Name,
+			ProcessID:   p.ID,
+			CompletedAt: p.CreatedAt,
+			Station:     p.Station,
+			OrderID:     p.OrderID,
+		}
+		order, ok := orders[p.OrderID]
+		if !ok || len(order.OrderProducts) == 0 {
+			base.OrderNo = order.OrderNo
+			base.Note = "订单无明细"
+			lines = append(lines, base)
+			continue
+		}
+		base.OrderNo = order.OrderNo
+		for _, op := range order.OrderProducts {
+			lines = append(lines, payrollLine(base, op, rates))
+		}
+	}
+	if len(lines) > 0 {
+		if err := tx.CreateInBatches(lines, 200).Error; err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	period.CalculatedAt = &now
+	return refreshPayrollAmount(tx, period)
+}
+
+// payrollOrderLines 订单的计薪明细：编辑时删除的明细不计，
+// 订单整单删除时只计与订单同时删除的明细
+func payrollOrderLines(order models.Order) []models.OrderProduct {
+	lines := make([]models.OrderProduct, 0, len(order.OrderProducts))
+	for _, op := range order.OrderProducts {
+		if !op.DeletedAt.Valid || (order.DeletedAt.Valid && op.DeletedAt.Time.Equal(order.DeletedAt.Time)) {
+			lines = append(lines, op)
+		}
+	}
+	return lines
+}
+
+// payrollLine 按工价计算一条订单明细的计件工资
+func payrollLine(line models.PayrollLine, op models.OrderProduct, rates pieceRateTable) models.PayrollLine {
+	line.OrderProductID = op.ID
+	line.ProductID = op.ProductID
+	line.ProductName = orderLineName(op)
+	line.Length = op.Length
+	line.Width = op.Width
+	line.Quantity = op.Quantity
+	// 长宽单位为厘米
+	line.Area = math.Round(op.Length*op.Width/10000*float64(op.Quantity)*1000) / 1000
+
+	rate, ok := rates.find(line.Station, op.ProductID)
+	if !ok {
+		line.Note = "未设置工价"
+		return line
+	}
+	line.Unit = rate.Unit
+	line.Rate = rate.Rate
+	switch rate.Unit {
+	case models.RateUnitSqm:
+		if line.Area == 0 {
+			line.Note = "缺少尺寸，无法按平米计算"
+			return line
+		}
+		line.Amount = roundMoney(line.Area * rate.Rate)
+	default:
+		line.Amount = roundMoney(float64(op.Quantity) * rate.Rate)
+	}
+	return line
+}
+
+// refreshPayrollAmount 汇总计件和调整金额
+func refreshPayrollAmount(tx *gorm.DB, period *models.PayrollPeriod) error {
+	var lines, adjustments float64
+	tx.Model(&models.PayrollLine{}).Where("period_id = ?", period.ID).Select("coalesce(sum(amount), 0)").Scan(&lines)
+	tx.Model(&models.PayrollAdjustment{}).Where("period_id = ?", period.ID).Select("coalesce(sum(amount), 0)").Scan(&adjustments)
+	period.Amount = roundMoney(lines + adjustments)
+	return tx.Model(period).Select("amount", "calculated_at").Updates(period).Error
+}
+
+// payrollWorker 工人在工资期内的工资汇总
+type payrollWorker struct {
+	WorkerID    uint    `json:"worker_id"`
+	WorkerName  string  `json:"worker_name"`
+	Quantity    int64   `json:"quantity"`     // 件数
+	Area        float64 `json:"area"`         // 平米数
+	PieceAmount float64 `json:"piece_amount"` // 计件工资
+	Adjustment  float64 `json:"adjustment"`   // 调整合计
+	Total       float64 `json:"total"`        // 应发
+	Unpriced    int64   `json:"unpriced"`     // 未设工价或无法计价的明细数
+}
+
+func payrollSummary(periodID uint) []payrollWorker {
+	var rows []payrollWorker
+	database.DB.Model(&models.PayrollLine{}).
+		Select("worker_id, max(worker_name) as worker_name, sum(quantity) as quantity, sum(area) as area, sum(amount) as piece_amount, "+
+			"sum(case when note <> '' then 1 else 0 end) as unpriced").
+		Where("period_id = ?", periodID).
+		Group("worker_id").
+		Scan(&rows)
+
+	var adjustments []struct {
+		WorkerID uint
+		Amount   float64
+	}
+	database.DB.Model(&models.PayrollAdjustment{}).
+		Select("worker_id, sum(amount) as amount").
+		Where("period_id = ?", periodID).
+		Group("worker_id").
+		Scan(&adjustments)
+
+	byWorker := make(map[uint]int, len(rows))
+	for i := range rows {
+		byWorker[rows[i].WorkerID] = i
+	}
+	for _, a := range adjustments {
+		i, ok := byWorker[a.WorkerID]
+		if !ok {
+			// 只有调整没有计件的工人
+			var worker models.Worker
+			database.DB.Unscoped().First(&worker, a.WorkerID)
+			rows = append(rows, payrollWorker{WorkerID: a.WorkerID, WorkerName: worker.Name})
+			i = len(rows) - 1
+			byWorker[a.WorkerID] = i
+		}
+		rows[i].Adjustment = roundMoney(a.Amount)
+	}
+	for i := range rows {
+		r := &rows[i]
+		r.Area = math.Round(r.Area*1000) / 1000
+		r.PieceAmount = roundMoney(r.PieceAmount)
+		r.Total = roundMoney(r.PieceAmount + r.Adjustment)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Total > rows[j].Total })
+	return rows
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"net/http"
+	"trace-server/database"
+	"trace-server/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetPriceLists 获取价目表列表（含价格明细）
+func GetPriceLists(c *gin.Context) {
+	var priceLists []models.PriceList
+	database.DB.
+		Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("product_id asc, min_quantity asc") }).
+		Preload("Items.Product").
+		Find(&priceLists)
+	c.JSON(http.StatusOK, priceLists)
+}
+
+// GetPriceList 获取单个价目表
+func GetPriceList(c *gin.Context) {
+	var priceList models.PriceList
+	if err := database.DB.
+		Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("product_id asc, min_quantity asc") }).
+		Preload("Items.Product").
+		First(&priceList, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "价目表不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, priceList)
+}
+
+// CreatePriceList 创建价目表
+func CreatePriceList(c *gin.Context) {
+	var priceList models.PriceList
+	if err := c.ShouldBindJSON(&priceList); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if priceList.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "价目表名称不能为空"})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if priceList.IsDefault {
+			if err := tx.Model(&models.PriceList{}).Where("is_default = ?", true).Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(&priceList).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, priceList)
+}
+
+// UpdatePriceList 更新价目表基本信息
+func UpdatePriceList(c *gin.Context) {
+	var priceList models.PriceList
+	if err := database.DB.First(&priceList, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "价目表不存在"})
+		return
+	}
+
+	var input models.PriceList
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "价目表名称不能为空"})
+		return
+	}
+
+	priceList.Name = input.Name
+	priceList.Remark = input.Remark
+	priceList.IsDefault = input.IsDefault
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// 默认价目表只能有一个
+		if priceList.IsDefault {
+			if err := tx.Model(&models.PriceList{}).Where("is_default = ? AND id <> ?", true, priceList.ID).Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Save(&priceList).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, priceList)
+}
+
+// DeletePriceList 删除价目表
+func DeletePriceList(c *gin.Context) {
+	var priceList models.PriceList
+	if err := database.DB.First(&priceList, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "价目表不存在"})
+		return
+	}
+
+	// 检查是否有客户使用此价目表
+	var count int64
+	database.DB.Model(&models.Customer{}).Where("price_list_id = ?", priceList.ID).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "该价目表已分配给客户，无法删除"})
+		return
+	}
+
+	database.DB.Where("price_list_id = ?", priceList.ID).Delete(&models.PriceListItem{})
+	database.DB.Delete(&priceList)
+	c.JSON(http.StatusOK, gin.H{"message": "价目表已删除"})
+}
+
+// CreatePriceListItem 添加价目表产品单价（阶梯价）
+func CreatePriceListItem(c *gin.Context) {
+	var priceList models.PriceList
+	if err := database.DB.First(&priceList, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "价目表不存在"})
+		return
+	}
+
+	var item models.PriceListItem
+	if err := c.ShouldBindJSON(&item); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	item.PriceListID = priceList.ID
+
+	if item.ProductID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "必须选择产品"})
+		return
+	}
+	if item.UnitPrice < 0 || item.MinQuantity < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "单价和起订数量不能为负数"})
+		return
+	}
+
+	if priceTierExists(&item) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "该产品已存在相同起订数量的价格"})
+		return
+	}
+
+	if err := database.DB.Create(&item).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, item)
+}
+
+// priceTierExists 同一产品同一起订数量只能有一档价格（不含明细自身）
+func priceTierExists(item *models.PriceListItem) bool {
+	var count int64
+	database.DB.Model(&models.PriceListItem{}).
+		Where("price_list_id = ? AND product_id = ? AND min_quantity = ? AND id <> ?", item.PriceListID, item.ProductID, item.MinQuantity, item.ID).
+		Count(&count)
+	return count > 0
+}
+
+// UpdatePriceListItem 更新价目表产品单价
+func UpdatePriceListItem(c *gin.Context) {
+	var item models.PriceListItem
+	if err := database.DB.Where("price_list_id = ?", c.Param("id")).First(&item, c.Param("itemId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "价格明细不存在"})
+		return
+	}
+
+	var input models.PriceListItem
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.UnitPrice < 0 || input.MinQuantity < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "单价和起订数量不能为负数"})
+		return
+	}
+
+	item.MinQuantity = input.MinQuantity
+	item.UnitPrice = input.UnitPrice
+	if priceTierExists(&item) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "该产品已存在相同起订数量的价格"})
+		return
+	}
+
+	database.DB.Save(&item)
+	c.JSON(http.StatusOK, item)
+}
+
+// DeletePriceListItem 删除价目表产品单价
+func DeletePriceListItem(c *gin.Context) {
+	var item models.PriceListItem
+	if err := database.DB.Where("price_list_id = ?", c.Param("id")).First(&item, c.Param("itemId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "价格明细不存在"})
+		return
+	}
+
+	database.DB.Delete(&item)
+	c.JSON(http.StatusOK, gin.H{"message": "价格已删除"})
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"trace-server/database"
+	"trace-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OrderItemInput 订单明细输入（创建、编辑订单共用）
+type OrderItemInput struct {
+	ProductID     uint    `json:"product_id"`
+	Length        float64 `json:"length"`
+	Width         float64 `json:"width"`
+	Height        float64 `json:"height"`
+	Quantity      int     `json:"quantity"`
+	Unit          string  `json:"unit"`           // 计量单位
+	UnitPrice     float64 `json:"unit_price"`     // 为 0 时按客户价目表取价
+	DiscountType  string  `json:"discount_type"`  // 行折扣类型: percent, fixed
+	DiscountValue float64 `json:"discount_value"` // 行折扣值
+	ExtraAttrs    string  `json:"extra_attrs"`    // 额外属性值 JSON
+}
+
+// roundMoney 金额保留两位小数
+func roundMoney(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// validateDiscount 校验折扣类型与折扣值
+func validateDiscount(discountType string, value float64) error {
+	switch discountType {
+	case "":
+		return nil
+	case models.DiscountPercent:
+		if value < 0 || value > 100 {
+			return errors.New("折扣百分比必须在 0-100 之间")
+		}
+	case models.DiscountFixed:
+		if value < 0 {
+			return errors.New("折扣金额不能为负数")
+		}
+	default:
+		return errors.New("无效的折扣类型: " + discountType)
+	}
+	return nil
+}
+
+// calcDiscount 计算减免金额，结果不超过原金额
+func calcDiscount(base float64, discountType string, value float64) float64 {
+	var discount float64
+	switch discountType {
+	case models.DiscountPercent:
+		discount = base * value / 100
+	case models.DiscountFixed:
+		discount = value
+	}
+	if discount < 0 {
+		discount = 0
+	}
+	if discount > base {
+		discount = base
+	}
+	return roundMoney(discount)
+}
+
+// resolvePriceListID 返回客户适用的价目表：客户专属价目表优先，否则使用默认价目表
+func resolvePriceListID(customer *models.Customer) uint {
+	if customer != nil && customer.PriceListID != nil {
+		return *customer.PriceListID
+	}
+	var def models.PriceList
+	if err := database.DB.Where("is_default = ?", true).First(&def).Error; err != nil {
+		return 0
+	}
+	return def.ID
+}
+
+// lookupUnitPrice 在价目表中查找产品单价，按数量命中最高一档阶梯价
+func lookupUnitPrice(priceListID, productID uint, quantity int) (float64, bool) {
+	if priceListID == 0 {
+		return 0, false
+	}
+	var item models.PriceListItem
+	err := database.DB.
+		Where("price_list_id = ? AND product_id = ? AND min_quantity <= ?", priceListID, productID, quantity).
+		Order("min_quantity desc").
+		First(&item).Error
+	if err != nil {
+		return 0, false
+	}
+	return item.UnitPrice, true
+}
+
+// buildOrderProducts 根据输入生成订单明细，未填写单价的行按价目表取价，返回明细及合计
+func buildOrderProducts(items []OrderItemInput, priceListID uint) ([]models.OrderProduct, float64, error) {
+	var orderProducts []models.OrderProduct
+	var subtotal float64
+	for _, item := range items {
+		if err := validateDiscount(item.DiscountType, item.DiscountValue); err != nil {
+			return nil, 0, err
+		}
+
+		listPrice, found := lookupUnitPrice(priceListID, item.ProductID, item.Quantity)
+		unitPrice := item.UnitPrice
+		if unitPrice <= 0 && found {
+			unitPrice = listPrice
+		}
+
+		gross := roundMoney(unitPrice * float64(item.Quantity))
+		discount := calcDiscount(gross, item.DiscountType, item.DiscountValue)
+		op := models.OrderProduct{
+			ProductID:     item.ProductID,
+			Length:        item.Length,
+			Width:         item.Width,
+			Height:        item.Height,
+			Quantity:      item.Quantity,
+			Unit:          item.Unit,
+			ListPrice:     listPrice,
+			UnitPrice:     unitPrice,
+			DiscountType:  item.DiscountType,
+			DiscountValue: item.DiscountValue,
+			Discount:      discount,
+			TotalPrice:    roundMoney(gross - discount),
+			ExtraAttrs:    item.ExtraAttrs,
+		}
+		orderProducts = append(orderProducts, op)
+		subtotal += op.TotalPrice
+	}
+	return orderProducts, roundMoney(subtotal), nil
+}
+
+// applyOrderDiscount 按整单折扣计算订单应收金额
+func applyOrderDiscount(order *models.Order, subtotal float64) {
+	order.Subtotal = roundMoney(subtotal)
+	order.Discount = calcDiscount(order.Subtotal, order.DiscountType, order.DiscountValue)
+	order.Amount = roundMoney(order.Subtotal - order.Discount)
+}
+
+// GetPriceQuote 查询客户某产品在指定数量下的价目表单价（供下单页自动填价）
+func GetPriceQuote(c *gin.Context) {
+	productID, _ := strconv.Atoi(c.Query("product_id"))
+	quantity, _ := strconv.Atoi(c.DefaultQuery("quantity", "1"))
+	if productID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少产品ID"})
+		return
+	}
+
+	var customer *models.Customer
+	if customerID := c.Query("customer_id"); customerID != "" {
+		var cust models.Customer
+		if err := database.DB.First(&cust, customerID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "客户不存在"})
+			return
+		}
+		customer = &cust
+	} else if phone := c.Query("phone"); phone != "" {
+		var cust models.Customer
+		if err := database.DB.Where("phone = ?", phone).First(&cust).Error; err == nil {
+			customer = &cust
+		}
+	}
+
+	priceListID := resolvePriceListID(customer)
+	unitPrice, found := lookupUnitPrice(priceListID, uint(productID), quantity)
+
+	c.JSON(http.StatusOK, gin.H{
+		"price_list_id": priceListID,
+		"unit_price":    unitPrice,
+		"found":         found,
+	})
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+	"trace-server/database"
+	"trace-server/models"
+	"trace-server/printing"
+
+	"gorm.io/gorm"
+)
+
+const (
+	printJobMaxAttempts = 5
+	printRetryInterval  = 30 * time.Second // 第 n 次失败后等待 n 倍间隔再重试
+	printQueuePoll      = 5 * time.Second
+	printQueueMaxDelay  = 5 * time.Minute // 数据库出错时退避等待的上限
+	printSendTimeout    = 30 * time.Second
+)
+
+// printQueueWake 新任务入队后唤醒队列，不必等下一次轮询
+var printQueueWake = make(chan struct{}, 1)
+
+func wakePrintQueue() {
+	select {
+	case printQueueWake <- struct{}{}:
+	default:
+	}
+}
+
+// StartPrintQueue 启动打印队列：服务重启时中断的任务重新排队，之后按入队顺序逐个发送
+func StartPrintQueue() {
+	database.DB.Model(&models.PrintJob{}).
+		Where("status = ?", models.PrintJobPrinting).
+		Update("status", models.PrintJobPending)
+
+	go func() {
+		ticker := time.NewTicker(printQueuePoll)
+		defer ticker.Stop()
+		var delay time.Duration
+		for {
+			// 读取或占用任务出错时逐次加倍等待，避免数据库故障时空转
+			if err := processPrintJobs(); err != nil {
+				delay = min(max(delay*2, printQueuePoll), printQueueMaxDelay)
+				time.Sleep(delay)
+				continue
+			}
+			delay = 0
+			select {
+			case <-printQueueWake:
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// processPrintJobs 发送所有到期的待打印任务，读取或占用任务出错时返回错误
+func processPrintJobs() error {
+	for {
+		var job models.PrintJob
+		err := database.DB.Preload("Printer").
+			Where("status = ? AND (next_run_at IS NULL OR next_run_at <= ?)", models.PrintJobPending, time.Now()).
+			Order("id asc").First(&job).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			log.Printf("Failed to load print jobs: %v\n", err)
+			return err
+		}
+		if err := runPrintJob(&job); err != nil {
+			log.Printf("Failed to claim print job %d: %v\n", job.ID, err)
+			return err
+		}
+	}
+}
+
+// runPrintJob 发送一个任务；失败时未用完重试次数则延后重试，否则标记失败。
+// 只有占用任务出错时返回错误，打印失败记录在任务上
+func runPrintJob(job *models.PrintJob) error {
+	// 先占用任务，避免被取消的任务继续打印
+	result := database.DB.Model(&models.PrintJob{}).
+		Where("id = ? AND status = ?", job.ID, models.PrintJobPending).
+		Updates(map[string]interface{}{"status": models.PrintJobPrinting, "attempts": gorm.Expr("attempts + 1")})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+	job.Attempts++
+
+	err := sendPrintJob(job)
+	updates := map[string]interface{}{}
+	now := time.Now()
+	switch {
+	case err == nil:
+		updates["status"] = models.PrintJobDone
+		updates["printed_at"] = &now
+		updates["last_error"] = ""
+		updates["next_run_at"] = nil
+	case job.Attempts >= job.MaxAttempts:
+		updates["status"] = models.PrintJobFailed
+		updates["last_error"] = err.Error()
+		updates["next_run_at"] = nil
+	default:
+		next := now.Add(time.Duration(job.Attempts) * printRetryInterval)
+		updates["status"] = models.PrintJobPending
+		updates["last_error"] = err.Error()
+		updates["next_run_at"] = &next
+	}
+	database.DB.Model(&models.PrintJob{}).
+		Where("id = ? AND status = ?", job.ID, models.PrintJobPrinting).
+		Updates(updates)
+	return nil
+}
+
+func sendPrintJob(job *models.PrintJob) error {
+	printer := job.Printer
+	if printer == nil {
+		return errors.New("打印机不存在")
+	}
+	if !printer.Enabled {
+		return errors.New("打印机已停用")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), printSendTimeout)
+	defer cancel()
+	return printing.Send(ctx, printer.Host, printer.Port, job.Data)
+}
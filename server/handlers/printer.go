@@ -0,0 +1,505 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"trace-server/database"
+	"trace-server/models"
+	"trace-server/printing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// printerInput 新增/修改打印机的请求
+type printerInput struct {
+	Name     string  `json:"name"`
+	Station  string  `json:"station"`
+	Protocol string  `json:"protocol"`
+	Host     string  `json:"host"`
+	Port     int     `json:"port"`
+	WidthMM  float64 `json:"width_mm"`
+	HeightMM float64 `json:"height_mm"`
+	DPI      int     `json:"dpi"`
+	Font     string  `json:"font"`
+	Enabled  *bool   `json:"enabled"` // 不传时新增默认启用，修改保持不变
+	Remark   string  `json:"remark"`
+}
+
+// apply 校验并写入打印机配置
+func (in printerInput) apply(p *models.Printer) error {
+	in.Name, in.Host = strings.TrimSpace(in.Name), strings.TrimSpace(in.Host)
+	in.Protocol = strings.ToLower(strings.TrimSpace(in.Protocol))
+	if in.Name == "" {
+		return errors.New("打印机名称不能为空")
+	}
+	if in.Host == "" {
+		return errors.New("打印机地址不能为空")
+	}
+	if !printing.Valid(in.Protocol) {
+		return errors.New("打印指令只能是 zpl、tspl 或 escpos")
+	}
+	if in.Port <= 0 {
+		in.Port = printing.DefaultPort
+	}
+	p.Name, p.Station, p.Protocol = in.Name, strings.TrimSpace(in.Station), in.Protocol
+	p.Host, p.Port = in.Host, in.Port
+	p.WidthMM, p.HeightMM, p.DPI, p.Font = in.WidthMM, in.HeightMM, in.DPI, in.Font
+	p.Remark = in.Remark
+	if in.Enabled != nil {
+		p.Enabled = *in.Enabled
+	}
+	return nil
+}
+
+func printerMedia(p models.Printer) printing.Media {
+	return printing.Media{WidthMM: p.WidthMM, HeightMM: p.HeightMM, DPI: p.DPI, Font: p.Font}
+}
+
+// GetPrinters 打印机列表（可按工位筛选）
+func GetPrinters(c *gin.Context) {
+	printers := make([]models.Printer, 0)
+	query := database.DB.Order("station asc, id asc")
+	if station := c.Query("station"); station != "" {
+		query = query.Where("station = ?", station)
+	}
+	query.Find(&printers)
+	c.JSON(http.StatusOK, gin.H{"data": printers})
+}
+
+func CreatePrinter(c *gin.Context) {
+	var input printerInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	printer := models.Printer{Enabled: true}
+	if err := input.apply(&printer); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := database.DB.Create(&printer).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, printer)
+}
+
+func UpdatePrinter(c *gin.Context) {
+	var printer models.Printer
+	if err := database.DB.First(&printer, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "打印机不存在"})
+		return
+	}
+	var input printerInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := input.apply(&printer); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	database.DB.Save(&printer)
+	c.JSON(http.StatusOK, printer)
+}
+
+// DeletePrinter 删除打印机，其未完成的任务一并取消
+func DeletePrinter(c *gin.Context) {
+	var printer models.Printer
+	if err := database.DB.First(&printer, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "打印机不存在"})
+		return
+	}
+	database.DB.Model(&models.PrintJob{}).
+		Where("printer_id = ? AND status = ?", printer.ID, models.PrintJobPending).
+		Update("status", models.PrintJobCanceled)
+	database.DB.Delete(&printer)
+	c.JSON(http.StatusOK, gin.H{"message": "打印机已删除"})
+}
+
+// stationPrinter 选择工位上启用的打印机：标签优先用标签机，小票只能用 ESC/POS 小票机
+func stationPrinter(station, kind string) (models.Printer, error) {
+	var printers []models.Printer
+	stations := expandStationNames([]string{station})
+	database.DB.Where("station IN ? AND enabled = ?", stations, true).Order("id asc").Find(&printers)
+
+	var fallback *models.Printer
+	for i, p := range printers {
+		if kind == models.PrintKindReceipt {
+			if p.Protocol == printing.ProtocolESCPOS {
+				return p, nil
+			}
+			continue
+		}
+		if printing.IsLabelProtocol(p.Protocol) {
+			return p, nil
+		}
+		if fallback == nil {
+			fallback = &printers[i]
+		}
+	}
+	if fallback != nil {
+		return *fallback, nil
+	}
+	return models.Printer{}, fmt.Errorf("工位 %s 未配置可用的打印机", station)
+}
+
+// selectPrinter 指定打印机，或按工位选择
+func selectPrinter(printerID uint, station, kind string) (models.Printer, error) {
+	if printerID == 0 {
+		if station == "" {
+			return models.Printer{}, errors.New("请选择打印机或工位")
+		}
+		return stationPrinter(station, kind)
+	}
+	var printer models.Printer
+	if err := database.DB.First(&printer, printerID).Error; err != nil {
+		return printer, errors.New("打印机不存在")
+	}
+	if !printer.Enabled {
+		return printer, errors.New("打印机已停用")
+	}
+	if kind == models.PrintKindReceipt && printer.Protocol != printing.ProtocolESCPOS {
+		return printer, errors.New("小票只能发送到 ESC/POS 小票机")
+	}
+	return printer, nil
+}
+
+// orderPrintLabel 订单标签内容：订单号、客户信息、明细和二维码
+func orderPrintLabel(order models.Order, lines []models.OrderProduct, caption string) printing.Label {
+	label := printing.Label{
+		Title: order.OrderNo,
+		Fields: [][2]string{
+			{"客户", order.CustomerName},
+			{"电话", order.Phone},
+			{"地址", order.Address},
+		},
+		QRCode: order.QRCode,
+	}
+	if order.Deadline != nil {
+		label.Fields = append(label.Fields, [2]string{"交期", order.Deadline.Format("2006-01-02")})
+	}
+	for _, op := range lines {
+		line := fmt.Sprintf("%s %s ×%d", orderLineName(op), orderLineSize(op), op.Quantity)
+		if attrs := orderLineAttrs(op.ExtraAttrs); len(attrs) > 0 {
+			line += " " + strings.Join(attrs, "；")
+		}
+		label.Lines = append(label.Lines, line)
+	}
+	if caption != "" {
+		label.Footer = []string{caption}
+	}
+	return label
+}
+
+// orderLabels 订单标签；perLine 为 true 时每条明细一张
+func orderLabels(order models.Order, lines []models.OrderProduct, perLine bool) []printing.Label {
+	if !perLine || len(lines) == 0 {
+		return []printing.Label{orderPrintLabel(order, lines, "")}
+	}
+	labels := make([]printing.Label, 0, len(lines))
+	for i, op := range lines {
+		labels = append(labels, orderPrintLabel(order, []models.OrderProduct{op}, fmt.Sprintf("第 %d/%d 项", i+1, len(lines))))
+	}
+	return labels
+}
+
+// orderReceipt 订单小票：明细、优惠、已收和待收金额
+func orderReceipt(order models.Order) printing.Receipt {
+	receipt := printing.Receipt{
+		Title: "销货清单",
+		Header: []string{
+			pdfCompany(),
+			"订单号：" + order.OrderNo,
+			"日期：" + order.CreatedAt.Format("2006-01-02"),
+			"客户：" + order.CustomerName + "  " + order.Phone,
+		},
+		QRCode: order.QRCode,
+	}
+	if order.Address != "" {
+		receipt.Header = append(receipt.Header, "地址："+order.Address)
+	}
+	for _, op := range order.OrderProducts {
+		var detail []string
+		if size := orderLineSize(op); size != "-" {
+			detail = append(detail, size)
+		}
+		detail = append(detail, orderLineAttrs(op.ExtraAttrs)...)
+		receipt.Items = append(receipt.Items, printing.ReceiptItem{
+			Name:   orderLineName(op),
+			Detail: strings.Join(detail, " "),
+			Qty:    fmt.Sprintf("%d %s × %.2f", op.Quantity, orderLineUnit(op), op.UnitPrice),
+			Amount: fmt.Sprintf("%.2f", op.TotalPrice),
+		})
+	}
+	if order.Discount > 0 {
+		receipt.Totals = append(receipt.Totals,
+			[2]string{"明细合计", fmt.Sprintf("%.2f", order.Subtotal)},
+			[2]string{"整单优惠", fmt.Sprintf("-%.2f", order.Discount)})
+	}
+	receipt.Totals = append(receipt.Totals,
+		[2]string{"应收", fmt.Sprintf("%.2f", order.Amount)},
+		[2]string{"已收", fmt.Sprintf("%.2f", order.PaidAmount)},
+		[2]string{"待收", fmt.Sprintf("%.2f", orderBalance(&order))})
+	if order.Remark != "" {
+		receipt.Footer = append(receipt.Footer, "备注："+order.Remark)
+	}
+	receipt.Footer = append(receipt.Footer, pdfContact())
+	return receipt
+}
+
+// printOrderInput 打印订单标签或小票的请求
+type printOrderInput struct {
+	Kind      string `json:"kind"` // label（默认）, receipt
+	PrinterID uint   `json:"printer_id"`
+	Station   string `json:"station"`  // 未指定打印机时按工位选择
+	ItemIDs   []uint `json:"item_ids"` // 只打印部分明细
+	PerLine   bool   `json:"per_line"` // 每条明细一张标签
+	Copies    int    `json:"copies"`
+}
+
+// maxPrintCopies 单次打印份数上限（工位打印接口无需登录）
+const maxPrintCopies = 20
+
+// enqueueOrderPrint 生成订单打印指令并加入打印队列
+func enqueueOrderPrint(orderID interface{}, input printOrderInput, operator string) (*models.PrintJob, int, error) {
+	if input.Kind == "" {
+		input.Kind = models.PrintKindLabel
+	}
+	if input.Kind != models.PrintKindLabel && input.Kind != models.PrintKindReceipt {
+		return nil, http.StatusBadRequest, errors.New("打印内容只能是 label 或 receipt")
+	}
+	if input.Copies <= 0 {
+		input.Copies = 1
+	}
+	if input.Copies > maxPrintCopies {
+		return nil, http.StatusBadRequest, fmt.Errorf("打印份数不能超过 %d", maxPrintCopies)
+	}
+
+	order, err := loadPrintOrder(orderID)
+	if err != nil {
+		return nil, http.StatusNotFound, errors.New("订单不存在")
+	}
+	lines := order.OrderProducts
+	if len(input.ItemIDs) > 0 {
+		wanted := make(map[uint]bool, len(input.ItemIDs))
+		for _, id := range input.ItemIDs {
+			wanted[id] = true
+		}
+		lines = nil
+		for _, op := range order.OrderProducts {
+			if wanted[op.ID] {
+				lines = append(lines, op)
+			}
+		}
+		if len(lines) == 0 {
+			return nil, http.StatusBadRequest, errors.New("订单明细不存在")
+		}
+	}
+
+	printer, err := selectPrinter(input.PrinterID, input.Station, input.Kind)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	var data []byte
+	var desc string
+	if input.Kind == models.PrintKindReceipt {
+		data, err = printing.EncodeReceipt(printerMedia(printer), orderReceipt(order), input.Copies)
+		desc = order.OrderNo + " 小票"
+	} else {
+		labels := orderLabels(order, lines, input.PerLine)
+		data, err = printing.EncodeLabels(printer.Protocol, printerMedia(printer), labels, input.Copies)
+		desc = fmt.Sprintf("%s 标签 %d 张", order.OrderNo, len(labels))
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if input.Copies > 1 {
+		desc += fmt.Sprintf(" ×%d", input.Copies)
+	}
+
+	job := models.PrintJob{
+		PrinterID:   printer.ID,
+		OrderID:     &order.ID,
+		Kind:        input.Kind,
+		Description: desc,
+		Data:        data,
+		Copies:      input.Copies,
+		Status:      models.PrintJobPending,
+		MaxAttempts: printJobMaxAttempts,
+		Operator:    operator,
+	}
+	if err := database.DB.Create(&job).Error; err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	wakePrintQueue()
+	job.Printer = &printer
+	return &job, http.StatusOK, nil
+}
+
+// PrintOrder 打印订单标签或小票（加入打印队列）
+func PrintOrder(c *gin.Context) {
+	var input printOrderInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	job, status, err := enqueueOrderPrint(c.Param("id"), input, c.GetString("username"))
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// StationPrint 工位端打印订单标签，使用扫码枪绑定工位或工人默认工位的打印机。
+// 工人须凭工牌码或已登记的扫码枪识别，只能打印标签
+func StationPrint(c *gin.Context) {
+	var input struct {
+		printOrderInput
+		OrderID     uint   `json:"order_id"`
+		BadgeCode   string `json:"badge_code"`
+		ScannerCode string `json:"scanner_code"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.BadgeCode == "" && input.ScannerCode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请扫工牌或使用已登记的扫码枪"})
+		return
+	}
+	worker, ok := stationWorker(input.BadgeCode, input.ScannerCode)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "工人不存在"})
+		return
+	}
+	station := deviceStation(input.ScannerCode)
+	if station == "" {
+		station = worker.Station
+	}
+	input.Kind, input.PrinterID, input.Station = models.PrintKindLabel, 0, station
+	job, status, err := enqueueOrderPrint(input.OrderID, input.printOrderInput, worker.Name)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// TestPrinter 打印测试页
+func TestPrinter(c *gin.Context) {
+	var printer models.Printer
+	if err := database.DB.First(&printer, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "打印机不存在"})
+		return
+	}
+	label := printing.Label{
+		Title: "打印测试",
+		Fields: [][2]string{
+			{"打印机", printer.Name},
+			{"工位", printer.Station},
+			{"时间", time.Now().Format("2006-01-02 15:04:05")},
+		},
+		QRCode: "PRINTER-" + strconv.Itoa(int(printer.ID)),
+		Footer: []string{pdfCompany()},
+	}
+	data, err := printing.EncodeLabels(printer.Protocol, printerMedia(printer), []printing.Label{label}, 1)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	job := models.PrintJob{
+		PrinterID:   printer.ID,
+		Kind:        models.PrintKindTest,
+		Description: "测试页",
+		Data:        data,
+		Copies:      1,
+		Status:      models.PrintJobPending,
+		MaxAttempts: 1,
+		Operator:    c.GetString("username"),
+	}
+	if err := database.DB.Create(&job).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	wakePrintQueue()
+	c.JSON(http.StatusOK, job)
+}
+
+// GetPrintJobs 打印队列（可按状态、打印机、订单筛选）
+func GetPrintJobs(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	offset := (page - 1) * pageSize
+
+	var jobs []models.PrintJob
+	var total int64
+	query := database.DB.Model(&models.PrintJob{}).Preload("Printer")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if printerID := c.Query("printer_id"); printerID != "" {
+		query = query.Where("printer_id = ?", printerID)
+	}
+	if orderID := c.Query("order_id"); orderID != "" {
+		query = query.Where("order_id = ?", orderID)
+	}
+
+	query.Count(&total)
+	query.Order("id desc").Offset(offset).Limit(pageSize).Find(&jobs)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  jobs,
+		"total": total,
+		"page":  page,
+	})
+}
+
+func GetPrintJob(c *gin.Context) {
+	var job models.PrintJob
+	if err := database.DB.Preload("Printer").First(&job, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "打印任务不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// RetryPrintJob 重新打印失败、已取消或已完成的任务
+func RetryPrintJob(c *gin.Context) {
+	var job models.PrintJob
+	if err := database.DB.First(&job, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "打印任务不存在"})
+		return
+	}
+	if job.Status == models.PrintJobPending || job.Status == models.PrintJobPrinting {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "任务正在排队或打印中"})
+		return
+	}
+	database.DB.Model(&job).Updates(map[string]interface{}{
+		"status":      models.PrintJobPending,
+		"attempts":    0,
+		"last_error":  "",
+		"next_run_at": nil,
+	})
+	database.DB.First(&job, job.ID)
+	wakePrintQueue()
+	c.JSON(http.StatusOK, job)
+}
+
+// CancelPrintJob 取消排队中的任务
+func CancelPrintJob(c *gin.Context) {
+	result := database.DB.Model(&models.PrintJob{}).
+		Where("id = ? AND status = ?", c.Param("id"), models.PrintJobPending).
+		Updates(map[string]interface{}{"status": models.PrintJobCanceled, "next_run_at": nil})
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "只能取消排队中的任务"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "打印任务已取消"})
+}
@@ -0,0 +1,393 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"trace-server/database"
+	"trace-server/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// quotationInput 创建/编辑报价单的输入
+type quotationInput struct {
+	CustomerName  string           `json:"customer_name"`
+	Phone         string           `json:"phone"`
+	Address       string           `json:"address"`
+	Remark        string           `json:"remark"`
+	DiscountType  string           `json:"discount_type"`
+	DiscountValue float64          `json:"discount_value"`
+	ValidUntilStr string           `json:"valid_until_str"` // YYYY-MM-DD
+	Items         []OrderItemInput `json:"items"`
+}
+
+// quotationExpired 报价是否已过有效期（有效期当天仍有效）
+func quotationExpired(q *models.Quotation, now time.Time) bool {
+	if q.ValidUntil == nil {
+		return false
+	}
+	return now.After(q.ValidUntil.AddDate(0, 0, 1))
+}
+
+// toQuotationItems 将定价后的订单明细转换为报价明细
+func toQuotationItems(orderProducts []models.OrderProduct) []models.QuotationItem {
+	items := make([]models.QuotationItem, 0, len(orderProducts))
+	for _, op := range orderProducts {
+		items = append(items, models.QuotationItem{
+			ProductID:     op.ProductID,
+			Length:        op.Length,
+			Width:         op.Width,
+			Height:        op.Height,
+			Quantity:      op.Quantity,
+			Unit:          op.Unit,
+			ListPrice:     op.ListPrice,
+			UnitPrice:     op.UnitPrice,
+			TotalPrice:    op.TotalPrice,
+			DiscountType:  op.DiscountType,
+			DiscountValue: op.DiscountValue,
+			Discount:      op.Discount,
+			ExtraAttrs:    op.ExtraAttrs,
+		})
+	}
+	return items
+}
+
+// toOrderProducts 将报价明细按报价时的价格转为订单明细
+func toOrderProducts(items []models.QuotationItem) []models.OrderProduct {
+	orderProducts := make([]models.OrderProduct, 0, len(items))
+	for _, item := range items {
+		orderProducts = append(orderProducts, models.OrderProduct{
+			ProductID:     item.ProductID,
+			Length:        item.Length,
+			Width:         item.Width,
+			Height:        item.Height,
+			Quantity:      item.Quantity,
+			Unit:          item.Unit,
+			ListPrice:     item.ListPrice,
+			UnitPrice:     item.UnitPrice,
+			TotalPrice:    item.TotalPrice,
+			DiscountType:  item.DiscountType,
+			DiscountValue: item.DiscountValue,
+			Discount:      item.Discount,
+			ExtraAttrs:    item.ExtraAttrs,
+		})
+	}
+	return orderProducts
+}
+
+// fillQuotation 校验输入并计算报价明细与金额
+func fillQuotation(quotation *models.Quotation, input *quotationInput) error {
+	if input.CustomerName == "" {
+		return fmt.Errorf("客户姓名不能为空")
+	}
+	if input.Phone == "" {
+		return fmt.Errorf("联系电话不能为空")
+	}
+	if len(input.Items) == 0 {
+		return fmt.Errorf("必须选择至少一个产品")
+	}
+	if err := validateDiscount(input.DiscountType, input.DiscountValue); err != nil {
+		return err
+	}
+
+	quotation.CustomerName = input.CustomerName
+	quotation.Phone = input.Phone
+	quotation.Address = input.Address
+	quotation.Remark = input.Remark
+	quotation.DiscountType = input.DiscountType
+	quotation.DiscountValue = input.DiscountValue
+	quotation.ValidUntil = nil
+	if input.ValidUntilStr != "" {
+		t, err := time.Parse("2006-01-02", input.ValidUntilStr)
+		if err != nil {
+			return fmt.Errorf("有效期格式错误，应为 YYYY-MM-DD")
+		}
+		quotation.ValidUntil = &t
+	}
+
+	// 报价阶段不强制建档，已有客户时按其价目表取价
+	var customer *models.Customer
+	var cust models.Customer
+	quotation.CustomerID = 0
+	if err := database.DB.Where("phone = ?", input.Phone).First(&cust).Error; err == nil {
+		customer = &cust
+		quotation.CustomerID = cust.ID
+	}
+
+	orderProducts, subtotal, err := buildOrderProducts(input.Items, resolvePriceListID(customer))
+	if err != nil {
+		return err
+	}
+	quotation.Items = toQuotationItems(orderProducts)
+
+	quotation.Subtotal = subtotal
+	quotation.Discount = calcDiscount(subtotal, quotation.DiscountType, quotation.DiscountValue)
+	quotation.Amount = roundMoney(subtotal - quotation.Discount)
+	return nil
+}
+
+// GetQuotations 获取报价单列表
+func GetQuotations(c *gin.Context) {
+	status := c.DefaultQuery("status", "")
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	offset := (page - 1) * pageSize
+
+	var quotations []models.Quotation
+	var total int64
+
+	query := database.DB.Model(&models.Quotation{}).
+		Preload("Items").
+		Preload("Items.Product")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	q := c.Query("q")
+	if q != "" {
+		wildcard := "%" + q + "%"
+		query = query.Where("quote_no LIKE ? OR customer_name LIKE ? OR phone LIKE ?", wildcard, wildcard, wildcard)
+	}
+
+	query.Count(&total)
+	query.Order("id desc").Offset(offset).Limit(pageSize).Find(&quotations)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  quotations,
+		"total": total,
+		"page":  page,
+	})
+}
+
+// GetQuotation 获取报价单详情
+func GetQuotation(c *gin.Context) {
+	var quotation models.Quotation
+	if err := database.DB.
+		Preload("Items").
+		Preload("Items.Product").
+		Preload("Items.Product.Attributes").
+		First(&quotation, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "报价单不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, quotation)
+}
+
+// CreateQuotation 创建报价单
+func CreateQuotation(c *gin.Context) {
+	var input quotationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var quotation models.Quotation
+	if err := fillQuotation(&quotation, &input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	quotation.Status = models.QuotationPending
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		quoteNo, err := nextSequence(tx, models.SequenceQuotation)
+		if err != nil {
+			return err
+		}
+		quotation.QuoteNo = quoteNo
+		return tx.Create(&quotation).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, quotation)
+}
+
+// UpdateQuotation 编辑报价单（仅待确认状态可编辑）
+func UpdateQuotation(c *gin.Context) {
+	var quotation models.Quotation
+	if err := database.DB.First(&quotation, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "报价单不存在"})
+		return
+	}
+	if quotation.Status != models.QuotationPending {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "报价单" + quotation.Status + "，不能编辑"})
+		return
+	}
+
+	var input quotationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := fillQuotation(&quotation, &input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("quotation_id = ?", quotation.ID).Delete(&models.QuotationItem{}).Error; err != nil {
+			return err
+		}
+		for i := range quotation.Items {
+			quotation.Items[i].QuotationID = quotation.ID
+		}
+		return tx.Save(&quotation).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	database.DB.Preload("Items").Preload("Items.Product").First(&quotation, quotation.ID)
+	c.JSON(http.StatusOK, quotation)
+}
+
+// UpdateQuotationStatus 标记报价单为已接受/已拒绝
+func UpdateQuotationStatus(c *gin.Context) {
+	var quotation models.Quotation
+	if err := database.DB.First(&quotation, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "报价单不存在"})
+		return
+	}
+
+	var input struct {
+		Status string `json:"status"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch input.Status {
+	case models.QuotationPending, models.QuotationAccepted, models.QuotationRejected:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的报价单状态: " + input.Status})
+		return
+	}
+	if quotation.Status == models.QuotationConverted {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "报价单已转订单，不能修改状态"})
+		return
+	}
+
+	quotation.Status = input.Status
+	database.DB.Save(&quotation)
+	c.JSON(http.StatusOK, quotation)
+}
+
+// DeleteQuotation 删除报价单
+func DeleteQuotation(c *gin.Context) {
+	var quotation models.Quotation
+	if err := database.DB.First(&quotation, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "报价单不存在"})
+		return
+	}
+	if quotation.Status == models.QuotationConverted {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "报价单已转订单，无法删除"})
+		return
+	}
+
+	database.DB.Where("quotation_id = ?", quotation.ID).Delete(&models.QuotationItem{})
+	database.DB.Delete(&quotation)
+	c.JSON(http.StatusOK, gin.H{"message": "报价单已删除"})
+}
+
+var errQuotationConverted = errors.New("报价单已转订单")
+
+// ConvertQuotation 报价单转订单，按报价价格生成订单并进入生产流程
+func ConvertQuotation(c *gin.Context) {
+	var quotation models.Quotation
+	if err := database.DB.Preload("Items").First(&quotation, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "报价单不存在"})
+		return
+	}
+
+	var input struct {
+		DeadlineStr string `json:"deadline_str"`
+		Specs       string `json:"specs"`
+	}
+	// 请求体可为空
+	c.ShouldBindJSON(&input)
+
+	switch {
+	case quotation.Status == models.QuotationConverted:
+		c.JSON(http.StatusBadRequest, gin.H{"error": errQuotationConverted.Error()})
+		return
+	case quotation.Status == models.QuotationRejected:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "报价单已被拒绝，不能转订单"})
+		return
+	case quotation.Status != models.QuotationAccepted:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "报价单需客户接受后才能转订单"})
+		return
+	case quotationExpired(&quotation, time.Now()):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "报价单已过有效期，请重新报价"})
+		return
+	case len(quotation.Items) == 0:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "报价单没有产品明细"})
+		return
+	case quotation.Amount <= 0:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "报价金额必须大于0"})
+		return
+	}
+
+	order := models.Order{
+		CustomerName:  quotation.CustomerName,
+		Phone:         quotation.Phone,
+		Address:       quotation.Address,
+		Subtotal:      quotation.Subtotal,
+		DiscountType:  quotation.DiscountType,
+		DiscountValue: quotation.DiscountValue,
+		Discount:      quotation.Discount,
+		Amount:        quotation.Amount,
+		Specs:         input.Specs,
+		Remark:        quotation.Remark,
+		OrderProducts: toOrderProducts(quotation.Items),
+	}
+	if input.DeadlineStr != "" {
+		t, err := time.Parse("2006-01-02", input.DeadlineStr)
+		if err == nil {
+			order.Deadline = &t
+		}
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// 先按状态条件标记已转换，并发请求中只有一个能更新成功
+		res := tx.Model(&models.Quotation{}).
+			Where("id = ? AND status <> ?", quotation.ID, models.QuotationConverted).
+			Update("status", models.QuotationConverted)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errQuotationConverted
+		}
+		if err := createOrder(tx, &order); err != nil {
+			return err
+		}
+		return tx.Model(&quotation).Updates(map[string]interface{}{
+			"order_id":    order.ID,
+			"customer_id": order.CustomerID,
+		}).Error
+	})
+	if errors.Is(err, errQuotationConverted) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	quotation.Status = models.QuotationConverted
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "已转为订单 " + order.OrderNo,
+		"order":     order,
+		"quotation": quotation,
+	})
+}
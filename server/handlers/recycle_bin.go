@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+	"trace-server/config"
+	"trace-server/database"
+	"trace-server/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 未配置时已删除订单默认保留 30 天
+const defaultRetentionDays = 30
+
+// retentionDays 已删除订单的保留天数
+func retentionDays() int {
+	if days := config.Current.Recycle.RetentionDays; days > 0 {
+		return days
+	}
+	return defaultRetentionDays
+}
+
+// 引用订单且随订单一起删除、恢复的子表（均按 order_id 关联）；售后明细经售后工单关联。
+// 计件工资明细保留订单号快照，作为已发工资的历史记录不随订单删除。
+var orderChildModels = []interface{}{
+	&models.OrderProduct{},
+	&models.Process{},
+	&models.ScanLog{},
+	&models.Payment{},
+	&models.DeliveryStop{},
+	&models.AfterSaleTicket{},
+}
+
+// orderRefs 引用订单但不随订单删除的记录：拆出的子订单、重做单对应的售后工单、打印任务和报价单
+var orderRefs = []struct {
+	Model  interface{}
+	Column string
+}{
+	{&models.Order{}, "parent_id"},
+	{&models.AfterSaleTicket{}, "remake_order_id"},
+	{&models.PrintJob{}, "order_id"},
+	{&models.Quotation{}, "order_id"},
+}
+
+// orderTicketIDs 订单的售后工单ID（含已删除），用于关联售后明细
+func orderTicketIDs(tx *gorm.DB, orderID uint) *gorm.DB {
+	return tx.Unscoped().Model(&models.AfterSaleTicket{}).Select("id").Where("order_id = ?", orderID)
+}
+
+// softDeleteOrder 软删除订单及其子记录，统一使用同一删除时间
+func softDeleteOrder(db *gorm.DB, order *models.Order, now time.Time) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.AfterSaleItem{}).Where("ticket_id IN (?)", orderTicketIDs(tx, order.ID)).Update("deleted_at", now).Error; err != nil {
+			return err
+		}
+		for _, model := range orderChildModels {
+			if err := tx.Model(model).Where("order_id = ?", order.ID).Update("deleted_at", now).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(order).Update("deleted_at", now).Error
+	})
+}
+
+// deletedOrders 回收站中的订单；合并后删除的订单不在回收站中
+func deletedOrders(db *gorm.DB) *gorm.DB {
+	return db.Unscoped().Model(&models.Order{}).
+		Where("deleted_at IS NOT NULL AND merged_into_id IS NULL")
+}
+
+// purgeOrder 永久删除订单及其子记录和附件文件
+func purgeOrder(order *models.Order) error {
+	var attachments []models.Attachment
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		return purgeOrderTx(tx, order, &attachments)
+	})
+	if err != nil {
+		return err
+	}
+	// 数据库删除成功后再删文件，避免回滚后附件丢失
+	removeAttachmentFiles(attachments)
+	return nil
+}
+
+// purgeOrderTx 在事务内永久删除订单：子记录和附件一并删除，其他记录对该订单的引用置空，
+// 已合并到该订单的旧订单一并清除。待删除的附件文件追加到 attachments
+func purgeOrderTx(tx *gorm.DB, order *models.Order, attachments *[]models.Attachment) error {
+	var merged []models.Order
+	if err := tx.Unscoped().Where("merged_into_id = ?", order.ID).Find(&merged).Error; err != nil {
+		return err
+	}
+	for i := range merged {
+		if err := purgeOrderTx(tx, &merged[i], attachments); err != nil {
+			return err
+		}
+	}
+
+	var ticketIDs []uint
+	if err := orderTicketIDs(tx, order.ID).Pluck("id", &ticketIDs).Error; err != nil {
+		return err
+	}
+	for _, id := range ticketIDs {
+		atts, err := deleteOwnerAttachments(tx, models.AttachmentOwnerAfterSale, id)
+		if err != nil {
+			return err
+		}
+		*attachments = append(*attachments, atts...)
+	}
+	if len(ticketIDs) > 0 {
+		if err := tx.Unscoped().Where("ticket_id IN ?", ticketIDs).Delete(&models.AfterSaleItem{}).Error; err != nil {
+			return err
+		}
+	}
+	var stopIDs []uint
+	if err := tx.Unscoped().Model(&models.DeliveryStop{}).Where("order_id = ?", order.ID).Pluck("id", &stopIDs).Error; err != nil {
+		return err
+	}
+	for _, id := range stopIDs {
+		atts, err := deleteOwnerAttachments(tx, models.AttachmentOwnerDelivery, id)
+		if err != nil {
+			return err
+		}
+		*attachments = append(*attachments, atts...)
+	}
+	for _, model := range orderChildModels {
+		if err := tx.Unscoped().Where("order_id = ?", order.ID).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	atts, err := deleteOwnerAttachments(tx, models.AttachmentOwnerOrder, order.ID)
+	if err != nil {
+		return err
+	}
+	*attachments = append(*attachments, atts...)
+
+	// 拆出的子订单、重做单对应的售后工单、打印任务和报价单只保留记录，解除与该订单的关联
+	for _, ref := range orderRefs {
+		if err := tx.Unscoped().Model(ref.Model).Where(ref.Column+" = ?", order.ID).Update(ref.Column, nil).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Unscoped().Delete(order).Error
+}
+
+// GetDeletedOrders 回收站：已删除订单列表
+func GetDeletedOrders(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	offset := (page - 1) * pageSize
+
+	var orders []models.Order
+	var total int64
+	query := deletedOrders(database.DB)
+	if q := c.Query("q"); q != "" {
+		wildcard := "%" + q + "%"
+		query = query.Where("order_no LIKE ? OR customer_name LIKE ? OR phone LIKE ?", wildcard, wildcard, wildcard)
+	}
+
+	query.Count(&total)
+	query.Order("deleted_at desc").Offset(offset).Limit(pageSize).Find(&orders)
+
+	days := retentionDays()
+	now := time.Now()
+	result := make([]gin.H, 0, len(orders))
+	for _, o := range orders {
+		purgeAt := o.DeletedAt.Time.AddDate(0, 0, days)
+		result = append(result, gin.H{
+			"order":     o,
+			"purge_at":  purgeAt,
+			"purgeable": !now.Before(purgeAt),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":           result,
+		"total":          total,
+		"page":           page,
+		"retention_days": days,
+	})
+}
+
+// RestoreOrder 从回收站恢复订单，连同删除订单时一并删除的子记录
+func RestoreOrder(c *gin.Context) {
+	var order models.Order
+	if err := deletedOrders(database.DB).First(&order, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "回收站中没有该订单"})
+		return
+	}
+
+	// 只恢复与订单同一时间删除的子记录，编辑订单时替换掉的旧明细不会被找回
+	deletedAt := order.DeletedAt.Time
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&models.AfterSaleItem{}).
+			Where("ticket_id IN (?) AND deleted_at = ?", orderTicketIDs(tx, order.ID), deletedAt).
+			Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		for _, model := range orderChildModels {
+			if err := tx.Unscoped().Model(model).
+				Where("order_id = ? AND deleted_at = ?", order.ID, deletedAt).
+				Update("deleted_at", nil).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Unscoped().Model(&order).Update("deleted_at", nil).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	database.DB.Preload("OrderProducts").Preload("OrderProducts.Product").Preload("Processes").First(&order, order.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "订单已恢复", "order": order})
+}
+
+// PurgeOrder 永久删除回收站中超过保留期的订单（仅管理员）
+func PurgeOrder(c *gin.Context) {
+	var order models.Order
+	if err := deletedOrders(database.DB).First(&order, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "回收站中没有该订单"})
+		return
+	}
+
+	days := retentionDays()
+	if time.Now().Before(order.DeletedAt.Time.AddDate(0, 0, days)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "订单删除未满 " + strconv.Itoa(days) + " 天，暂不能永久删除"})
+		return
+	}
+
+	if err := purgeOrder(&order); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "订单已永久删除"})
+}
+
+// PurgeExpiredOrders 一键清除所有超过保留期的已删除订单（仅管理员）
+func PurgeExpiredOrders(c *gin.Context) {
+	days := retentionDays()
+	cutoff := time.Now().AddDate(0, 0, -days)
+
+	var orders []models.Order
+	deletedOrders(database.DB).Where("deleted_at <= ?", cutoff).Find(&orders)
+
+	purged := 0
+	for i := range orders {
+		if err := purgeOrder(&orders[i]); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "purged": purged})
+			return
+		}
+		purged++
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "已永久删除 " + strconv.Itoa(purged) + " 个订单",
+		"purged":  purged,
+	})
+}
@@ -0,0 +1,413 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"trace-server/config"
+	"trace-server/database"
+	"trace-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	scannerMonitorInterval = time.Minute
+	scannerFailureMinScans = 10  // 扫码次数少于该值时不判断失败率
+	scannerFailureRate     = 0.3 // 失败率超过该值标记为失败率高
+)
+
+// 扫码枪状态
+const (
+	scannerOK      = "正常"
+	scannerSilent  = "静默"
+	scannerFailing = "失败率高"
+	scannerUnused  = "未使用"
+)
+
+// deviceStation 扫码枪绑定的工位，未登记或未绑定返回空
+func deviceStation(scannerCode string) string {
+	if scannerCode == "" {
+		return ""
+	}
+	var device models.ScannerDevice
+	if err := database.DB.Where("code = ?", scannerCode).First(&device).Error; err != nil {
+		return ""
+	}
+	return device.Station
+}
+
+// scannerWorker 扫码枪对应的工人：设备指定了工人时以设备为准，否则按工人的扫码枪代码
+func scannerWorker(code string) (models.Worker, bool) {
+	var worker models.Worker
+	var device models.ScannerDevice
+	if database.DB.Where("code = ?", code).First(&device).Error == nil && device.WorkerID != nil {
+		if database.DB.First(&worker, *device.WorkerID).Error == nil {
+			return worker, true
+		}
+	}
+	return worker, database.DB.Where("scanner_code = ?", code).First(&worker).Error == nil
+}
+
+// stationWorker 工位端公开接口识别工人：工牌码或已登记的扫码枪，不接受工人ID
+func stationWorker(badgeCode, scannerCode string) (models.Worker, bool) {
+	var worker models.Worker
+	switch {
+	case badgeCode != "":
+		return worker, database.DB.Where("badge_code = ?", badgeCode).First(&worker).Error == nil
+	case scannerCode != "":
+		return scannerWorker(scannerCode)
+	}
+	return worker, false
+}
+
+// touchScanner 记录扫码枪最后扫码时间并关闭静默告警；工人的扫码枪首次扫码时自动登记。
+// 自动登记不指定工人，仍按工人的扫码枪代码识别，修改工人扫码枪代码后即时生效
+func touchScanner(code string) {
+	if code == "" {
+		return
+	}
+	now := time.Now()
+	var device models.ScannerDevice
+	if err := database.DB.Where("code = ?", code).First(&device).Error; err != nil {
+		var worker models.Worker
+		if database.DB.Where("scanner_code = ?", code).First(&worker).Error != nil {
+			return
+		}
+		device = models.ScannerDevice{Code: code, Name: worker.Name, LastSeenAt: &now, Remark: "首次扫码自动登记"}
+		if err := database.DB.Create(&device).Error; err != nil {
+			log.Printf("Failed to register scanner %s: %v\n", code, err)
+		}
+		return
+	}
+	database.DB.Model(&device).Update("last_seen_at", now)
+	database.DB.Model(&models.ScannerAlert{}).
+		Where("device_id = ? AND resolved_at IS NULL", device.ID).
+		Update("resolved_at", now)
+}
+
+// ---------- 扫码枪登记 ----------
+
+// scanCount 扫码枪在一段时间内的扫码次数
+type scanCount struct {
+	ScannerCode string
+	Total       int64
+	Success     int64
+}
+
+func scanCounts(since time.Time) map[string]scanCount {
+	var rows []scanCount
+	database.DB.Model(&models.ScanLog{}).
+		Select("scanner_code, count(*) as total, sum(case when is_success then 1 else 0 end) as success").
+		Where("created_at >= ? AND scanner_code <> ''", since).
+		Group("scanner_code").
+		Scan(&rows)
+	counts := make(map[string]scanCount, len(rows))
+	for _, r := range rows {
+		counts[r.ScannerCode] = r
+	}
+	return counts
+}
+
+// GetScanners 扫码枪列表，附带最后扫码时间、成功/失败次数（今日和最近 days 天）和状态
+func GetScanners(c *gin.Context) {
+	days, _ := strconv.Atoi(c.DefaultQuery("days", "7"))
+	if days <= 0 {
+		days = 7
+	}
+
+	var devices []models.ScannerDevice
+	query := database.DB.Preload("Worker").Order("station asc, code asc")
+	if station := c.Query("station"); station != "" {
+		query = query.Where("station = ?", station)
+	}
+	query.Find(&devices)
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	todayCounts := scanCounts(today)
+	rangeCounts := scanCounts(today.AddDate(0, 0, 1-days))
+
+	var alerts []models.ScannerAlert
+	database.DB.Where("resolved_at IS NULL").Find(&alerts)
+	silent := map[uint]bool{}
+	for _, a := range alerts {
+		silent[a.DeviceID] = true
+	}
+
+	type scannerRow struct {
+		models.ScannerDevice
+		TodaySuccess int64   `json:"today_success"`
+		TodayFailure int64   `json:"today_failure"`
+		Success      int64   `json:"success"`
+		Failure      int64   `json:"failure"`
+		FailureRate  float64 `json:"failure_rate"`
+		Status       string  `json:"status"`
+	}
+	rows := make([]scannerRow, 0, len(devices))
+	for _, d := range devices {
+		t, r := todayCounts[d.Code], rangeCounts[d.Code]
+		row := scannerRow{
+			ScannerDevice: d,
+			TodaySuccess:  t.Success,
+			TodayFailure:  t.Total - t.Success,
+			Success:       r.Success,
+			Failure:       r.Total - r.Success,
+		}
+		if r.Total > 0 {
+			row.FailureRate = roundMoney(float64(row.Failure) / float64(r.Total))
+		}
+		switch {
+		case silent[d.ID]:
+			row.Status = scannerSilent
+		case d.LastSeenAt == nil:
+			row.Status = scannerUnused
+		case r.Total >= scannerFailureMinScans && row.FailureRate > scannerFailureRate:
+			row.Status = scannerFailing
+		default:
+			row.Status = scannerOK
+		}
+		rows = append(rows, row)
+	}
+	c.JSON(http.StatusOK, rows)
+}
+
+type scannerInput struct {
+	Code          string `json:"code"`
+	Name          string `json:"name"`
+	Station       string `json:"station"`
+	SilentMinutes int    `json:"silent_minutes"`
+	Remark        string `json:"remark"`
+}
+
+func (in *scannerInput) apply(d *models.ScannerDevice) error {
+	d.Code = strings.TrimSpace(in.Code)
+	d.Name = in.Name
+	d.SilentMinutes = in.SilentMinutes
+	d.Remark = in.Remark
+	if d.Code == "" {
+		return errors.New("扫码枪代码不能为空")
+	}
+	if d.SilentMinutes < 0 {
+		return errors.New("静默告警分钟不能为负数")
+	}
+	station, err := resolveStation(in.Station)
+	if err != nil {
+		return err
+	}
+	d.Station, d.StationID = station.Name, station.ID
+	var count int64
+	database.DB.Model(&models.ScannerDevice{}).Where("code = ? AND id <> ?", d.Code, d.ID).Count(&count)
+	if count > 0 {
+		return errors.New("扫码枪代码已存在")
+	}
+	return nil
+}
+
+// CreateScanner 登记扫码枪
+func CreateScanner(c *gin.Context) {
+	var input scannerInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var device models.ScannerDevice
+	if err := input.apply(&device); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := database.DB.Create(&device).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, device)
+}
+
+// UpdateScanner 修改扫码枪（如换绑工位）
+func UpdateScanner(c *gin.Context) {
+	var device models.ScannerDevice
+	if err := database.DB.First(&device, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "扫码枪不存在"})
+		return
+	}
+	var input scannerInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := input.apply(&device); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := database.DB.Omit("Worker").Save(&device).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, device)
+}
+
+// AssignScanner 把扫码枪转给另一个工人使用，之后的扫码记在该工人名下；worker_id 为空时恢复按工人扫码枪代码识别
+func AssignScanner(c *gin.Context) {
+	var device models.ScannerDevice
+	if err := database.DB.First(&device, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "扫码枪不存在"})
+		return
+	}
+	var input struct {
+		WorkerID *uint `json:"worker_id"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	device.Worker = nil
+	if input.WorkerID != nil {
+		var worker models.Worker
+		if err := database.DB.First(&worker, *input.WorkerID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "工人不存在"})
+			return
+		}
+		device.Worker = &worker
+	}
+	device.WorkerID = input.WorkerID
+	if err := database.DB.Model(&device).Update("worker_id", device.WorkerID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, device)
+}
+
+// DeleteScanner 删除扫码枪，之后该代码的扫码按工人扫码枪代码和默认工位处理
+func DeleteScanner(c *gin.Context) {
+	if err := database.DB.Unscoped().Delete(&models.ScannerDevice{}, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "扫码枪已删除"})
+}
+
+// ---------- 静默告警 ----------
+
+// GetScannerAlerts 扫码枪告警，默认只返回未恢复的
+func GetScannerAlerts(c *gin.Context) {
+	query := database.DB.Order("id desc")
+	if c.Query("status") != "all" {
+		query = query.Where("resolved_at IS NULL")
+	}
+	var alerts []models.ScannerAlert
+	query.Limit(200).Find(&alerts)
+	c.JSON(http.StatusOK, alerts)
+}
+
+// AckScannerAlert 告警已知悉
+func AckScannerAlert(c *gin.Context) {
+	var alert models.ScannerAlert
+	if err := database.DB.First(&alert, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "告警不存在"})
+		return
+	}
+	now := time.Now()
+	alert.AckBy, alert.AckAt = c.GetString("username"), &now
+	database.DB.Model(&alert).Updates(map[string]interface{}{"ack_by": alert.AckBy, "ack_at": now})
+	c.JSON(http.StatusOK, alert)
+}
+
+// StartScannerMonitor 定时检查工作时间内长时间没有扫码的工位扫码枪
+func StartScannerMonitor() {
+	go func() {
+		ticker := time.NewTicker(scannerMonitorInterval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			checkSilentScanners(now)
+		}
+	}()
+}
+
+// workingHours 当天的上下班时间和固定休息：使用默认班次，未设置时使用配置
+func workingHours(now time.Time) (start, end, breakStart, breakEnd time.Time) {
+	var shift models.Shift
+	if database.DB.Where("is_default = ?", true).First(&shift).Error != nil {
+		shift.StartTime, shift.EndTime = config.Current.Scanner.WorkStart, config.Current.Scanner.WorkEnd
+		if shift.StartTime == "" {
+			shift.StartTime = "08:00"
+		}
+		if shift.EndTime == "" {
+			shift.EndTime = "18:00"
+		}
+	}
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	start, _ = shiftClock(day, shift.StartTime)
+	end, _ = shiftClock(day, shift.EndTime)
+	if !end.After(start) {
+		// 跨天班次：凌晨属于前一天的班
+		if now.Before(end) {
+			start = start.AddDate(0, 0, -1)
+		} else {
+			end = end.AddDate(0, 0, 1)
+		}
+	}
+	bs, okBS := shiftClock(start, shift.BreakStart)
+	be, okBE := shiftClock(start, shift.BreakEnd)
+	if okBS && okBE {
+		if bs.Before(start) {
+			bs, be = bs.AddDate(0, 0, 1), be.AddDate(0, 0, 1)
+		}
+		if !be.After(bs) {
+			be = be.AddDate(0, 0, 1)
+		}
+		breakStart, breakEnd = bs, be
+	}
+	return start, end, breakStart, breakEnd
+}
+
+// checkSilentScanners 工作时间内超过阈值没有扫码的工位扫码枪生成告警（每台设备同时只有一条未恢复告警）
+func checkSilentScanners(now time.Time) {
+	start, end, breakStart, breakEnd := workingHours(now)
+	if now.Before(start) || !now.Before(end) || (!now.Before(breakStart) && now.Before(breakEnd)) {
+		return
+	}
+
+	defaultMinutes := config.Current.Scanner.SilentMinutes
+	if defaultMinutes <= 0 {
+		defaultMinutes = 30
+	}
+	var devices []models.ScannerDevice
+	database.DB.Where("station_id > 0").Find(&devices)
+	for _, d := range devices {
+		minutes := d.SilentMinutes
+		if minutes <= 0 {
+			minutes = defaultMinutes
+		}
+		from := start
+		if d.LastSeenAt != nil && d.LastSeenAt.After(from) {
+			from = *d.LastSeenAt
+		}
+		// 固定休息时间不计入静默
+		silent := now.Sub(from) - overlap(from, now, breakStart, breakEnd)
+		if silent < time.Duration(minutes)*time.Minute {
+			continue
+		}
+
+		var open int64
+		database.DB.Model(&models.ScannerAlert{}).Where("device_id = ? AND resolved_at IS NULL", d.ID).Count(&open)
+		if open > 0 {
+			continue
+		}
+		alert := models.ScannerAlert{
+			DeviceID:   d.ID,
+			Code:       d.Code,
+			Station:    d.Station,
+			Message:    fmt.Sprintf("%s工位扫码枪 %s 已 %d 分钟没有扫码", d.Station, d.Code, int(silent.Minutes())),
+			SilentFrom: from,
+		}
+		if err := database.DB.Create(&alert).Error; err != nil {
+			log.Printf("Failed to create scanner alert: %v\n", err)
+			continue
+		}
+		log.Println("Scanner alert:", alert.Message)
+	}
+}
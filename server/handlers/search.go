@@ -0,0 +1,332 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"trace-server/database"
+	"trace-server/models"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 参与全文检索的字段，需与 database.fulltextIndexes 保持一致
+const (
+	orderSearchColumns    = "order_no, customer_name, phone, address, specs, remark"
+	orderLineSearchColumn = "extra_attrs"
+	customerSearchColumns = "name, phone, address, remark"
+	productSearchColumns  = "name, code"
+)
+
+// ngram 分词默认 2 个字，单字词无法命中全文索引
+const ngramTokenSize = 2
+
+// searchHit 统一搜索结果
+type searchHit struct {
+	Type     string  `json:"type"` // order, customer, product
+	ID       uint    `json:"id"`
+	Title    string  `json:"title"`
+	Subtitle string  `json:"subtitle"`
+	Snippet  string  `json:"snippet"` // 命中内容片段
+	Score    float64 `json:"score"`
+}
+
+// searchTerms 按空白拆分关键词，如 "阳台 2米"
+func searchTerms(q string) []string {
+	return strings.Fields(q)
+}
+
+// useFulltext 是否可以使用 MySQL 全文索引
+func useFulltext(terms []string) bool {
+	if database.DB.Dialector.Name() != "mysql" {
+		return false
+	}
+	for _, t := range terms {
+		if utf8.RuneCountInString(t) < ngramTokenSize {
+			return false
+		}
+	}
+	return true
+}
+
+// booleanQuery 生成 BOOLEAN MODE 查询串：每个词作为短语，任一命中即可，命中越多得分越高
+func booleanQuery(terms []string) string {
+	quoted := make([]string, 0, len(terms))
+	for _, t := range terms {
+		t = strings.NewReplacer(`"`, "", "+", "", "-", "", "<", "", ">", "", "(", "", ")", "", "~", "", "*", "", "@", "").Replace(t)
+		if t != "" {
+			quoted = append(quoted, `"`+t+`"`)
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// fulltextScores 全文检索，返回 ID -> 相关度；缺少全文索引等情况下返回错误
+func fulltextScores(db *gorm.DB, idColumn, columns string, terms []string, limit int) (map[uint]float64, error) {
+	type row struct {
+		ID    uint
+		Score float64
+	}
+	var rows []row
+	match := "MATCH(" + columns + ") AGAINST (? IN BOOLEAN MODE)"
+	query := booleanQuery(terms)
+	err := db.Select(idColumn+" AS id, MAX("+match+") AS score", query).
+		Where(match, query).
+		Group(idColumn).
+		Order("score DESC").
+		Limit(limit).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	scores := make(map[uint]float64, len(rows))
+	for _, r := range rows {
+		scores[r.ID] = r.Score
+	}
+	return scores, nil
+}
+
+// searchScores 可用全文索引时返回全文检索得分；不可用或检索出错时返回 false，由调用方改用模糊匹配
+func searchScores(model interface{}, idColumn, columns string, terms []string, limit int) (map[uint]float64, bool) {
+	if !useFulltext(terms) {
+		return nil, false
+	}
+	scores, err := fulltextScores(database.DB.Model(model), idColumn, columns, terms, limit)
+	if err != nil {
+		log.Printf("Fulltext search on %s failed, falling back to LIKE: %v\n", columns, err)
+		return nil, false
+	}
+	return scores, true
+}
+
+// likeCondition 任一关键词模糊匹配任一字段
+func likeCondition(columns string, terms []string) (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	for _, col := range strings.Split(columns, ",") {
+		col = strings.TrimSpace(col)
+		for _, t := range terms {
+			conds = append(conds, col+" LIKE ?")
+			args = append(args, "%"+t+"%")
+		}
+	}
+	return strings.Join(conds, " OR "), args
+}
+
+// countMatches 模糊匹配时的相关度：命中的关键词数为主，出现次数为辅
+func countMatches(terms []string, fields ...string) float64 {
+	var score float64
+	for _, t := range terms {
+		hits := 0
+		for _, f := range fields {
+			hits += strings.Count(f, t)
+		}
+		if hits > 0 {
+			score += 1 + float64(hits)/10
+		}
+	}
+	return score
+}
+
+// searchSnippet 截取第一个命中关键词附近的内容
+func searchSnippet(terms []string, fields ...string) string {
+	const radius = 20
+	for _, f := range fields {
+		for _, t := range terms {
+			i := strings.Index(f, t)
+			if i < 0 {
+				continue
+			}
+			runes := []rune(f)
+			pos := utf8.RuneCountInString(f[:i])
+			start, end := pos-radius, pos+utf8.RuneCountInString(t)+radius
+			prefix, suffix := "…", "…"
+			if start <= 0 {
+				start, prefix = 0, ""
+			}
+			if end >= len(runes) {
+				end, suffix = len(runes), ""
+			}
+			return prefix + string(runes[start:end]) + suffix
+		}
+	}
+	return ""
+}
+
+// searchOrders 检索订单，含订单明细额外属性
+func searchOrders(terms []string, limit int) []searchHit {
+	scores := make(map[uint]float64)
+	orderScores, ok := searchScores(&models.Order{}, "id", orderSearchColumns, terms, limit)
+	var lineScores map[uint]float64
+	if ok {
+		lineScores, ok = searchScores(&models.OrderProduct{}, "order_id", orderLineSearchColumn, terms, limit)
+	}
+	if ok {
+		for id, s := range orderScores {
+			scores[id] += s
+		}
+		for id, s := range lineScores {
+			scores[id] += s
+		}
+	} else {
+		var ids []uint
+		cond, args := likeCondition(orderSearchColumns, terms)
+		database.DB.Model(&models.Order{}).Where(cond, args...).Limit(limit).Pluck("id", &ids)
+		var lineIDs []uint
+		cond, args = likeCondition(orderLineSearchColumn, terms)
+		database.DB.Model(&models.OrderProduct{}).Where(cond, args...).Limit(limit).Pluck("order_id", &lineIDs)
+		for _, id := range append(ids, lineIDs...) {
+			scores[id] = 0
+		}
+	}
+	if len(scores) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
+	}
+	var orders []models.Order
+	database.DB.Preload("OrderProducts").Where("id IN ?", ids).Find(&orders)
+
+	hits := make([]searchHit, 0, len(orders))
+	for _, o := range orders {
+		fields := []string{o.Remark, o.Specs, o.Address, o.OrderNo, o.CustomerName, o.Phone}
+		for _, op := range o.OrderProducts {
+			fields = append(fields, op.ExtraAttrs)
+		}
+		score := scores[o.ID]
+		if score == 0 {
+			score = countMatches(terms, fields...)
+		}
+		hits = append(hits, searchHit{
+			Type:     "order",
+			ID:       o.ID,
+			Title:    o.OrderNo,
+			Subtitle: o.CustomerName + " · " + o.Status,
+			Snippet:  searchSnippet(terms, fields...),
+			Score:    score,
+		})
+	}
+	return hits
+}
+
+// searchCustomers 检索客户
+func searchCustomers(terms []string, limit int) []searchHit {
+	var customers []models.Customer
+	scores, ok := searchScores(&models.Customer{}, "id", customerSearchColumns, terms, limit)
+	if ok {
+		if len(scores) == 0 {
+			return nil
+		}
+		ids := make([]uint, 0, len(scores))
+		for id := range scores {
+			ids = append(ids, id)
+		}
+		database.DB.Where("id IN ?", ids).Find(&customers)
+	} else {
+		cond, args := likeCondition(customerSearchColumns, terms)
+		database.DB.Where(cond, args...).Limit(limit).Find(&customers)
+	}
+
+	hits := make([]searchHit, 0, len(customers))
+	for _, cu := range customers {
+		fields := []string{cu.Name, cu.Phone, cu.Address, cu.Remark}
+		score := scores[cu.ID]
+		if score == 0 {
+			score = countMatches(terms, fields...)
+		}
+		hits = append(hits, searchHit{
+			Type:     "customer",
+			ID:       cu.ID,
+			Title:    cu.Name,
+			Subtitle: cu.Phone,
+			Snippet:  searchSnippet(terms, fields...),
+			Score:    score,
+		})
+	}
+	return hits
+}
+
+// searchProducts 检索产品
+func searchProducts(terms []string, limit int) []searchHit {
+	var products []models.Product
+	scores, ok := searchScores(&models.Product{}, "id", productSearchColumns, terms, limit)
+	if ok {
+		if len(scores) == 0 {
+			return nil
+		}
+		ids := make([]uint, 0, len(scores))
+		for id := range scores {
+			ids = append(ids, id)
+		}
+		database.DB.Where("id IN ?", ids).Find(&products)
+	} else {
+		cond, args := likeCondition(productSearchColumns, terms)
+		database.DB.Where(cond, args...).Limit(limit).Find(&products)
+	}
+
+	hits := make([]searchHit, 0, len(products))
+	for _, p := range products {
+		fields := []string{p.Name, p.Code}
+		score := scores[p.ID]
+		if score == 0 {
+			score = countMatches(terms, fields...)
+		}
+		hits = append(hits, searchHit{
+			Type:     "product",
+			ID:       p.ID,
+			Title:    p.Name,
+			Subtitle: p.Code,
+			Snippet:  searchSnippet(terms, fields...),
+			Score:    score,
+		})
+	}
+	return hits
+}
+
+// Search 统一搜索订单、客户和产品，按相关度排序
+// MySQL 使用 ngram 全文索引；其他数据库或单字关键词时退化为模糊匹配
+func Search(c *gin.Context) {
+	terms := searchTerms(c.Query("q"))
+	if len(terms) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请输入搜索关键词"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	types := map[string]bool{"order": true, "customer": true, "product": true}
+	if list := queryList(c, "types"); len(list) > 0 {
+		types = make(map[string]bool, len(list))
+		for _, t := range list {
+			types[t] = true
+		}
+	}
+
+	hits := make([]searchHit, 0)
+	if types["order"] {
+		hits = append(hits, searchOrders(terms, limit)...)
+	}
+	if types["customer"] {
+		hits = append(hits, searchCustomers(terms, limit)...)
+	}
+	if types["product"] {
+		hits = append(hits, searchProducts(terms, limit)...)
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+
+	c.JSON(http.StatusOK, gin.H{
+		"query": c.Query("q"),
+		"data":  hits,
+		"total": len(hits),
+	})
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"trace-server/database"
+	"trace-server/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// sequencePeriodKey 返回当前时间所在的计数周期
+func sequencePeriodKey(reset string, now time.Time) string {
+	switch reset {
+	case models.SequenceResetDay:
+		return now.Format("20060102")
+	case models.SequenceResetMonth:
+		return now.Format("200601")
+	case models.SequenceResetYear:
+		return now.Format("2006")
+	}
+	return ""
+}
+
+// formatSequence 按规则模板生成编号
+func formatSequence(seq *models.Sequence, value int64, now time.Time) string {
+	return strings.NewReplacer(
+		"{YYYY}", now.Format("2006"),
+		"{YY}", now.Format("06"),
+		"{MM}", now.Format("01"),
+		"{DD}", now.Format("02"),
+		"{SEQ}", fmt.Sprintf("%0*d", seq.Padding, value),
+	).Replace(seq.Pattern)
+}
+
+// validateSequence 校验编号规则：必须含序号，且模板中的日期能区分各个重置周期
+func validateSequence(seq *models.Sequence) error {
+	if !strings.Contains(seq.Pattern, "{SEQ}") {
+		return errors.New("编号模板必须包含 {SEQ}")
+	}
+	if seq.Padding < 1 || seq.Padding > 10 {
+		return errors.New("序号位数必须在 1-10 之间")
+	}
+	hasYear := strings.Contains(seq.Pattern, "{YYYY}") || strings.Contains(seq.Pattern, "{YY}")
+	hasMonth := strings.Contains(seq.Pattern, "{MM}")
+	hasDay := strings.Contains(seq.Pattern, "{DD}")
+	switch seq.Reset {
+	case models.SequenceResetNever:
+	case models.SequenceResetYear:
+		if !hasYear {
+			return errors.New("按年重置的编号模板必须包含年份")
+		}
+	case models.SequenceResetMonth:
+		if !hasYear || !hasMonth {
+			return errors.New("按月重置的编号模板必须包含年份和月份")
+		}
+	case models.SequenceResetDay:
+		if !hasYear || !hasMonth || !hasDay {
+			return errors.New("按日重置的编号模板必须包含年、月、日")
+		}
+	default:
+		return errors.New("无效的重置周期: " + seq.Reset)
+	}
+	return nil
+}
+
+// 各编号规则生成的编号所在的表和字段（均有唯一索引）
+var sequenceTargets = map[string]struct{ Table, Column string }{
+	models.SequenceOrder:     {"orders", "order_no"},
+	models.SequenceQuotation: {"quotations", "quote_no"},
+	models.SequenceDelivery:  {"delivery_batches", "batch_no"},
+	models.SequenceAfterSale: {"after_sale_tickets", "ticket_no"},
+}
+
+// 跳过已被占用编号的最大次数
+const sequenceMaxSkips = 1000
+
+// nextSequence 在事务内取下一个编号。
+// 计数器行先 UPDATE 自增再读取，数据库行锁保证并发下不重号；
+// 事务回滚时计数器一并回滚，因此编号连续无空号。
+// 修改模板或重置周期后可能生成历史上已用过的编号，此时跳过已存在的编号（含已删除的记录）。
+func nextSequence(tx *gorm.DB, name string) (string, error) {
+	var seq models.Sequence
+	if err := tx.Where("name = ?", name).First(&seq).Error; err != nil {
+		return "", fmt.Errorf("编号规则 %s 不存在", name)
+	}
+
+	now := time.Now()
+	periodKey := sequencePeriodKey(seq.Reset, now)
+	target, checked := sequenceTargets[name]
+
+	for skip := 0; skip <= sequenceMaxSkips; skip++ {
+		value, err := incrementSequence(tx, name, periodKey, now)
+		if err != nil {
+			return "", err
+		}
+		no := formatSequence(&seq, value, now)
+		if !checked {
+			return no, nil
+		}
+		var count int64
+		if err := tx.Table(target.Table).Where(target.Column+" = ?", no).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return no, nil
+		}
+	}
+	return "", fmt.Errorf("生成编号失败: %s 的编号已被占用，请修改编号模板", name)
+}
+
+// incrementSequence 计数器自增并返回新值
+func incrementSequence(tx *gorm.DB, name, periodKey string, now time.Time) (int64, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		result := tx.Model(&models.SequenceCounter{}).
+			Where("name = ? AND period_key = ?", name, periodKey).
+			Updates(map[string]interface{}{"value": gorm.Expr("value + 1"), "updated_at": now})
+		if result.Error != nil {
+			return 0, result.Error
+		}
+		if result.RowsAffected == 0 {
+			// 本周期首个编号；并发插入时唯一索引冲突，重试走自增分支
+			counter := models.SequenceCounter{Name: name, PeriodKey: periodKey, Value: 1, UpdatedAt: now}
+			if err := tx.Create(&counter).Error; err != nil {
+				continue
+			}
+			return counter.Value, nil
+		}
+
+		var counter models.SequenceCounter
+		if err := tx.Where("name = ? AND period_key = ?", name, periodKey).First(&counter).Error; err != nil {
+			return 0, err
+		}
+		return counter.Value, nil
+	}
+	return 0, fmt.Errorf("生成编号失败: %s", name)
+}
+
+// GetSequences 获取编号规则及当前周期计数
+func GetSequences(c *gin.Context) {
+	var sequences []models.Sequence
+	database.DB.Order("id asc").Find(&sequences)
+
+	now := time.Now()
+	result := make([]gin.H, 0, len(sequences))
+	for i := range sequences {
+		seq := &sequences[i]
+		var counter models.SequenceCounter
+		database.DB.Where("name = ? AND period_key = ?", seq.Name, sequencePeriodKey(seq.Reset, now)).First(&counter)
+		result = append(result, gin.H{
+			"sequence": seq,
+			"current":  counter.Value,
+			"next":     formatSequence(seq, counter.Value+1, now),
+		})
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// UpdateSequence 修改编号规则
+func UpdateSequence(c *gin.Context) {
+	var seq models.Sequence
+	if err := database.DB.Where("name = ?", c.Param("name")).First(&seq).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "编号规则不存在"})
+		return
+	}
+
+	var input models.Sequence
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	seq.Pattern = input.Pattern
+	seq.Padding = input.Padding
+	seq.Reset = input.Reset
+	if err := validateSequence(&seq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	database.DB.Save(&seq)
+	c.JSON(http.StatusOK, seq)
+}
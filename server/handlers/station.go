@@ -0,0 +1,337 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"trace-server/database"
+	"trace-server/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 流程工位的编码。扫码流转按编码匹配工位，工位改名不影响流程；流程工位的编码不能修改
+const (
+	stationCodeCutting  = "XL" // 下料
+	stationCodeFabric   = "CM" // 裁面
+	stationCodeCover    = "FM" // 封面
+	stationCodeDelivery = "SH" // 送货
+	stationCodePayment  = "SK" // 收款
+)
+
+// workflowStep 流程工位扫码前后的订单状态
+type workflowStep struct {
+	Code string
+	From string
+	To   string
+}
+
+// orderWorkflow 订单流程: 待下料 -> 待裁面 -> 待封面 -> 待送货 -> 待收款 -> 已完成
+var orderWorkflow = []workflowStep{
+	{stationCodeCutting, "待下料", "待裁面"},
+	{stationCodeFabric, "待裁面", "待封面"},
+	{stationCodeCover, "待封面", "待送货"},
+	{stationCodeDelivery, "待送货", "待收款"},
+	{stationCodePayment, "待收款", "已完成"},
+}
+
+// workflowCodes 流程工位编码（按流程顺序）
+func workflowCodes() []string {
+	codes := make([]string, len(orderWorkflow))
+	for i, step := range orderWorkflow {
+		codes[i] = step.Code
+	}
+	return codes
+}
+
+// workflowStepFor 按工位编码查找流程步骤
+func workflowStepFor(code string) (workflowStep, bool) {
+	for _, step := range orderWorkflow {
+		if step.Code == code {
+			return step, true
+		}
+	}
+	return workflowStep{}, false
+}
+
+// findStation 按工位名、编码或别名查找工位；名称和编码有唯一索引，找不到时再按别名查
+func findStation(name string) (models.Station, bool) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return models.Station{}, false
+	}
+	var station models.Station
+	if database.DB.Where("name = ? OR code = ?", name, name).First(&station).Error == nil {
+		return station, true
+	}
+	var candidates []models.Station
+	database.DB.Where("aliases LIKE ?", "%"+name+"%").Find(&candidates)
+	for _, s := range candidates {
+		if stationMatches(&s, name) {
+			return s, true
+		}
+	}
+	return models.Station{}, false
+}
+
+// stationByCode 按编码查找工位
+func stationByCode(code string) (models.Station, bool) {
+	var station models.Station
+	err := database.DB.Where("code = ?", code).First(&station).Error
+	return station, err == nil
+}
+
+// stationNames 工位名及其别名
+func stationNames(s models.Station) []string {
+	names := []string{s.Name}
+	for _, alias := range strings.Split(s.Aliases, ",") {
+		if alias = strings.TrimSpace(alias); alias != "" {
+			names = append(names, alias)
+		}
+	}
+	return names
+}
+
+// expandStationNames 将工位名扩展为工位表中的工位名及别名，用于按名称查询旧记录
+func expandStationNames(names []string) []string {
+	var out []string
+	for _, name := range names {
+		if s, ok := findStation(name); ok {
+			out = append(out, stationNames(s)...)
+		} else {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// stationIndex 一次加载的工位表，批量处理时在内存中按名称、编码或别名查找
+type stationIndex []models.Station
+
+func loadStationIndex(db *gorm.DB) stationIndex {
+	var stations []models.Station
+	db.Order("sort_order asc, id asc").Find(&stations)
+	return stations
+}
+
+func (idx stationIndex) find(name string) (models.Station, bool) {
+	for i := range idx {
+		if stationMatches(&idx[i], name) {
+			return idx[i], true
+		}
+	}
+	return models.Station{}, false
+}
+
+// canonical 工位表中的工位名，找不到时原样返回
+func (idx stationIndex) canonical(name string) string {
+	if s, ok := idx.find(name); ok {
+		return s.Name
+	}
+	return name
+}
+
+func stationMatches(s *models.Station, name string) bool {
+	if s.Name == name || s.Code == name {
+		return true
+	}
+	for _, alias := range strings.Split(s.Aliases, ",") {
+		if strings.TrimSpace(alias) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveStation 校验工位名，返回工位表中的工位；名称为空时返回零值
+func resolveStation(name string) (models.Station, error) {
+	if strings.TrimSpace(name) == "" {
+		return models.Station{}, nil
+	}
+	station, ok := findStation(name)
+	if !ok {
+		return station, errors.New("工位不存在: " + name)
+	}
+	return station, nil
+}
+
+// sameStation 工位名是否指同一工位（如送货与运货）
+func sameStation(a, b string) bool {
+	if a == b {
+		return true
+	}
+	sa, okA := findStation(a)
+	sb, okB := findStation(b)
+	return okA && okB && sa.ID == sb.ID
+}
+
+// GetStations 工位列表（按显示顺序），附带绑定的扫码枪和可上岗人数
+func GetStations(c *gin.Context) {
+	var stations []models.Station
+	database.DB.Preload("Scanners").Order("sort_order asc, id asc").Find(&stations)
+
+	var counts []struct {
+		StationID uint
+		Count     int64
+	}
+	database.DB.Model(&models.WorkerStation{}).Select("station_id, count(*) as count").Group("station_id").Scan(&counts)
+	workers := map[uint]int64{}
+	for _, r := range counts {
+		workers[r.StationID] = r.Count
+	}
+	// 没有工位分配记录的工人按默认工位计
+	database.DB.Model(&models.Worker{}).
+		Select("station_id, count(*) as count").
+		Where("id NOT IN (?)", database.DB.Model(&models.WorkerStation{}).Select("worker_id")).
+		Group("station_id").Scan(&counts)
+	for _, r := range counts {
+		workers[r.StationID] += r.Count
+	}
+
+	type stationRow struct {
+		models.Station
+		WorkerCount int64 `json:"worker_count"`
+	}
+	rows := make([]stationRow, 0, len(stations))
+	for _, s := range stations {
+		rows = append(rows, stationRow{Station: s, WorkerCount: workers[s.ID]})
+	}
+	c.JSON(http.StatusOK, rows)
+}
+
+type stationInput struct {
+	Code         string  `json:"code"`
+	Name         string  `json:"name"`
+	Aliases      string  `json:"aliases"`
+	SortOrder    int     `json:"sort_order"`
+	Capacity     int     `json:"capacity"`
+	MaxQueue     int     `json:"max_queue"`
+	MaxWaitHours float64 `json:"max_wait_hours"`
+	Remark       string  `json:"remark"`
+}
+
+func (in *stationInput) apply(s *models.Station) error {
+	s.Code = strings.TrimSpace(in.Code)
+	s.Name = strings.TrimSpace(in.Name)
+	s.SortOrder = in.SortOrder
+	s.Capacity = in.Capacity
+	s.Remark = in.Remark
+	s.MaxQueue = in.MaxQueue
+	s.MaxWaitHours = in.MaxWaitHours
+	if s.Code == "" || s.Name == "" {
+		return errors.New("工位编码和名称不能为空")
+	}
+	if s.Capacity < 0 || s.MaxQueue < 0 || s.MaxWaitHours < 0 {
+		return errors.New("产能和看板阈值不能为负数")
+	}
+	var aliases []string
+	for _, a := range strings.Split(strings.ReplaceAll(in.Aliases, "，", ","), ",") {
+		if a = strings.TrimSpace(a); a != "" && a != s.Name {
+			aliases = append(aliases, a)
+		}
+	}
+	s.Aliases = strings.Join(aliases, ",")
+
+	// 编码、名称和别名在所有工位中不能重复
+	var others []models.Station
+	database.DB.Where("id <> ?", s.ID).Find(&others)
+	for i := range others {
+		for _, name := range append([]string{s.Code, s.Name}, aliases...) {
+			if stationMatches(&others[i], name) {
+				return errors.New("与工位 " + others[i].Name + " 重复: " + name)
+			}
+		}
+	}
+	return nil
+}
+
+// CreateStation 新增工位
+func CreateStation(c *gin.Context) {
+	var input stationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var station models.Station
+	if err := input.apply(&station); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := database.DB.Create(&station).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, station)
+}
+
+// UpdateStation 修改工位；改名时同步更新各记录中的工位名
+func UpdateStation(c *gin.Context) {
+	var station models.Station
+	if err := database.DB.First(&station, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "工位不存在"})
+		return
+	}
+	var input stationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	oldName, oldCode := station.Name, station.Code
+	if err := input.apply(&station); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, ok := workflowStepFor(oldCode); ok && station.Code != oldCode {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "流程工位的编码不能修改"})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Scanners").Save(&station).Error; err != nil {
+			return err
+		}
+		if station.Name == oldName {
+			return nil
+		}
+		for _, table := range database.StationNameTables {
+			query := tx.Table(table.Name).Where("station = ?", oldName)
+			if table.HasID {
+				query = tx.Table(table.Name).Where("station_id = ?", station.ID)
+			}
+			if err := query.Update("station", station.Name).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, station)
+}
+
+// DeleteStation 删除工位，仍有工人或扫码枪使用时不能删除
+func DeleteStation(c *gin.Context) {
+	var station models.Station
+	if err := database.DB.First(&station, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "工位不存在"})
+		return
+	}
+	if _, ok := workflowStepFor(station.Code); ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "流程工位不能删除"})
+		return
+	}
+	var workers, assignments, scanners int64
+	database.DB.Model(&models.Worker{}).Where("station_id = ?", station.ID).Count(&workers)
+	database.DB.Model(&models.WorkerStation{}).Where("station_id = ?", station.ID).Count(&assignments)
+	database.DB.Model(&models.ScannerDevice{}).Where("station_id = ?", station.ID).Count(&scanners)
+	if workers+assignments+scanners > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "该工位仍有工人或扫码枪，无法删除"})
+		return
+	}
+	// 物理删除以便重新使用编码和名称；历史工序仍保留工位名
+	database.DB.Unscoped().Delete(&station)
+	c.JSON(http.StatusOK, gin.H{"message": "工位已删除"})
+}
@@ -175,9 +175,11 @@ func GetStationStats(c *gin.Context) {
 		Count   int64  `json:"value"`
 	}, 0)
 	database.DB.Model(&models.Process{}).
-		Select("station, count(*) as count").
-		Where("created_at >= ? AND created_at < ?", startOfDay, endOfDay).
-		Group("station").
+		Joins(processStationJoin).
+		Select(processStationName+" as station, count(*) as count").
+		Where("processes.created_at >= ? AND processes.created_at < ?", startOfDay, endOfDay).
+		Group(processStationName).
+		Order("min(coalesce(stations.sort_order, 999)) asc").
 		Scan(&stationStats)
 
 	// 5. Recent Logs (with Order Details)
@@ -255,18 +257,30 @@ func GetStationStats(c *gin.Context) {
 	})
 }
 
+// processPiecesJoin 关联工序对应订单的明细数量合计（oq.qty），用于统计件数
+const processPiecesJoin = "left join (select order_id, sum(quantity) as qty from order_products where deleted_at is null group by order_id) oq on oq.order_id = processes.order_id"
+
+// processStationJoin 关联工位表，按工位分组时同一工位的别名合并；未关联工位表的旧记录按原工位名
+const (
+	processStationJoin = "left join stations on stations.id = processes.station_id"
+	processStationName = "coalesce(stations.name, processes.station)"
+)
+
+// workerStatsRange 工作量统计的日期范围参数，默认最近 7 天；end 为结束日期次日零点
+func workerStatsRange(c *gin.Context) (startDate, endDate string, start, end time.Time) {
+	startDate = c.DefaultQuery("start_date", time.Now().AddDate(0, 0, -7).Format("2006-01-02"))
+	endDate = c.DefaultQuery("end_date", time.Now().Format("2006-01-02"))
+	start, _ = time.Parse("2006-01-02", startDate)
+	end, _ = time.Parse("2006-01-02", endDate)
+	end = end.Add(24 * time.Hour) // 包含结束日期整天
+	return
+}
+
 // GetWorkerStats 获取工人工作量统计
 func GetWorkerStats(c *gin.Context) {
-	// 日期范围参数
-	startDate := c.DefaultQuery("start_date", time.Now().AddDate(0, 0, -7).Format("2006-01-02"))
-	endDate := c.DefaultQuery("end_date", time.Now().Format("2006-01-02"))
+	startDate, endDate, start, end := workerStatsRange(c)
 	workerID := c.Query("worker_id") // 可选，指定工人
 
-	// 解析日期
-	start, _ := time.Parse("2006-01-02", startDate)
-	end, _ := time.Parse("2006-01-02", endDate)
-	end = end.Add(24 * time.Hour) // 包含结束日期整天
-
 	// 1. 按工人统计总工作量
 	type WorkerTotal struct {
 		WorkerID   uint   `json:"worker_id"`
@@ -320,12 +334,13 @@ func GetWorkerStats(c *gin.Context) {
 	}
 	stationWork := make([]StationWork, 0)
 	stationQuery := database.DB.Model(&models.Process{}).
-		Select("station, count(*) as count").
-		Where("created_at >= ? AND created_at < ?", start, end).
-		Group("station").
+		Joins(processStationJoin).
+		Select(processStationName+" as station, count(*) as count").
+		Where("processes.created_at >= ? AND processes.created_at < ?", start, end).
+		Group(processStationName).
 		Order("count desc")
 	if workerID != "" {
-		stationQuery = stationQuery.Where("worker_id = ?", workerID)
+		stationQuery = stationQuery.Where("processes.worker_id = ?", workerID)
 	}
 	stationQuery.Scan(&stationWork)
 
@@ -1,41 +1,430 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
+	"trace-server/config"
+	"trace-server/middleware"
+	"trace-server/storage"
 
+	"github.com/disintegration/imaging"
 	"github.com/gin-gonic/gin"
+	_ "golang.org/x/image/webp"
 )
 
-func UploadFile(c *gin.Context) {
-	file, err := c.FormFile("file")
+// 上传文件访问路径前缀，其后为存储中的 key；存储后端更换后地址不变
+const (
+	uploadURLPrefix = "/uploads/"
+	thumbDir        = "thumbs" // 缩略图子目录
+)
+
+const defaultSignedURLMinutes = 10
+
+const (
+	defaultUploadMaxSizeMB = 10
+	jpegQuality            = 90
+	maxImagePixels         = 50_000_000 // 图片像素上限，解码前按文件头检查，防止小文件解压出超大图
+)
+
+var defaultThumbnailSizes = []int{200, 800}
+
+// allowedUploadTypes 允许上传的文件类型（按文件内容判断）及保存的扩展名
+var allowedUploadTypes = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"application/pdf": ".pdf",
+}
+
+var (
+	errUploadTooLarge = errors.New("文件过大")
+	errUploadType     = errors.New("只支持上传 JPG、PNG、GIF、WebP 图片或 PDF 文件")
+	errImageTooLarge  = errors.New("图片尺寸过大")
+)
+
+// uploadMaxSize 单个上传文件大小上限（字节）
+func uploadMaxSize() int64 {
+	mb := config.Current.Upload.MaxSizeMB
+	if mb <= 0 {
+		mb = defaultUploadMaxSizeMB
+	}
+	return int64(mb) << 20
+}
+
+// thumbnailSizes 需要生成的缩略图尺寸
+func thumbnailSizes() []int {
+	if sizes := config.Current.Upload.ThumbnailSizes; len(sizes) > 0 {
+		return sizes
+	}
+	return defaultThumbnailSizes
+}
+
+// savedUpload 已保存的上传文件
+type savedUpload struct {
+	Filename   string         // 上传目录下的文件名
+	MimeType   string         // 保存后的实际类型
+	Size       int64          // 保存后的大小
+	Thumbnails map[int]string // 缩略图尺寸 -> URL
+}
+
+// URL 文件访问地址
+func (u *savedUpload) URL() string {
+	return uploadURLPrefix + u.Filename
+}
+
+// ThumbnailsJSON 缩略图URL，JSON对象 {"200": "/uploads/thumbs/..."}
+func (u *savedUpload) ThumbnailsJSON() string {
+	return thumbnailsJSON(u.Thumbnails)
+}
+
+func thumbnailsJSON(thumbs map[int]string) string {
+	if len(thumbs) == 0 {
+		return ""
+	}
+	m := make(map[string]string, len(thumbs))
+	for size, url := range thumbs {
+		m[strconv.Itoa(size)] = url
+	}
+	data, _ := json.Marshal(m)
+	return string(data)
+}
+
+// thumbnailName 缩略图文件名：原文件名_尺寸.jpg
+func thumbnailName(filename string, size int) string {
+	return fmt.Sprintf("%s_%d.jpg", strings.TrimSuffix(filename, filepath.Ext(filename)), size)
+}
+
+// existingThumbnails 查找已生成的缩略图
+func existingThumbnails(ctx context.Context, filename string) map[int]string {
+	thumbs := make(map[int]string)
+	for _, size := range thumbnailSizes() {
+		key := thumbDir + "/" + thumbnailName(filename, size)
+		if _, err := storage.Current.Stat(ctx, key); err == nil {
+			thumbs[size] = uploadURLPrefix + key
+		}
+	}
+	return thumbs
+}
+
+// removeUploadFile 删除上传文件及其缩略图
+func removeUploadFile(ctx context.Context, filename string) error {
+	filename = filepath.Base(filename)
+	for _, size := range thumbnailSizes() {
+		storage.Current.Delete(ctx, thumbDir+"/"+thumbnailName(filename, size))
+	}
+	return storage.Current.Delete(ctx, filename)
+}
+
+// readUpload 读取上传内容并按文件头校验类型和大小
+func readUpload(file *multipart.FileHeader) ([]byte, string, error) {
+	max := uploadMaxSize()
+	if file.Size > max {
+		return nil, "", errUploadTooLarge
+	}
+	f, err := file.Open()
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
-		return
+		return nil, "", err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, max+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(len(data)) > max {
+		return nil, "", errUploadTooLarge
+	}
+
+	mimeType := http.DetectContentType(data)
+	if _, ok := allowedUploadTypes[mimeType]; !ok {
+		return nil, "", errUploadType
+	}
+	return data, mimeType, nil
+}
+
+// normalizeImage 按 EXIF 方向旋正图片并重新编码，去除 EXIF 等元数据（含拍摄位置）。
+// GIF 保留原文件以免丢失动画；WebP 无法编码，转为 JPG。
+func normalizeImage(data []byte, mimeType string) ([]byte, string, image.Image, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", nil, errUploadType
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > maxImagePixels {
+		return nil, "", nil, errImageTooLarge
+	}
+
+	img, err := imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, "", nil, errUploadType
+	}
+
+	var buf bytes.Buffer
+	switch mimeType {
+	case "image/gif":
+		return data, mimeType, img, nil
+	case "image/png":
+		err = png.Encode(&buf, img)
+	default:
+		mimeType = "image/jpeg"
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	}
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return buf.Bytes(), mimeType, img, nil
+}
+
+// saveThumbnails 生成各尺寸缩略图（JPG），小于目标尺寸的图片不放大
+func saveThumbnails(ctx context.Context, img image.Image, filename string) (map[int]string, error) {
+	thumbs := make(map[int]string)
+	for _, size := range thumbnailSizes() {
+		if size <= 0 {
+			continue
+		}
+		thumb := img
+		if b := img.Bounds(); b.Dx() > size || b.Dy() > size {
+			thumb = imaging.Fit(img, size, size, imaging.Lanczos)
+		}
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, err
+		}
+		key := thumbDir + "/" + thumbnailName(filename, size)
+		if err := storage.Current.Put(ctx, key, &buf, int64(buf.Len()), "image/jpeg"); err != nil {
+			return nil, err
+		}
+		thumbs[size] = uploadURLPrefix + key
+	}
+	return thumbs, nil
+}
+
+// saveUploadedFile 校验并保存上传文件：只接受图片和 PDF，图片旋正去元数据并生成缩略图。
+// 文件名由服务端生成，扩展名按实际内容决定。
+func saveUploadedFile(c *gin.Context, file *multipart.FileHeader) (*savedUpload, error) {
+	data, mimeType, err := readUpload(file)
+	if err != nil {
+		return nil, err
 	}
 
-	// Create uploads directory if not exists
-	uploadDir := "./uploads"
-	if _, err := os.Stat(uploadDir); os.IsNotExist(err) {
-		os.Mkdir(uploadDir, 0755)
+	var img image.Image
+	if strings.HasPrefix(mimeType, "image/") {
+		if data, mimeType, img, err = normalizeImage(data, mimeType); err != nil {
+			return nil, err
+		}
 	}
 
-	// Generate unique filename
-	ext := filepath.Ext(file.Filename)
-	filename := fmt.Sprintf("%d%s", time.Now().UnixNano(), ext)
-	filepath := filepath.Join(uploadDir, filename)
+	ctx := c.Request.Context()
+	filename := fmt.Sprintf("%d%s", time.Now().UnixNano(), allowedUploadTypes[mimeType])
+	if err := storage.Current.Put(ctx, filename, bytes.NewReader(data), int64(len(data)), mimeType); err != nil {
+		return nil, err
+	}
 
-	// Save file
-	if err := c.SaveUploadedFile(file, filepath); err != nil {
+	saved := &savedUpload{Filename: filename, MimeType: mimeType, Size: int64(len(data))}
+	if img != nil {
+		if saved.Thumbnails, err = saveThumbnails(ctx, img, filename); err != nil {
+			removeUploadFile(ctx, filename)
+			return nil, err
+		}
+	}
+	return saved, nil
+}
+
+// respondUploadError 返回上传失败原因
+func respondUploadError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errUploadTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("文件大小不能超过 %d MB", uploadMaxSize()>>20)})
+	case errors.Is(err, errUploadType), errors.Is(err, errImageTooLarge):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+	}
+}
+
+// limitUploadBody 限制请求体大小，超大文件不必完整接收
+func limitUploadBody(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, uploadMaxSize()+1<<20)
+}
+
+// inlineUpload 文件类型在上传白名单内才在浏览器中直接打开；
+// 白名单之前上传的旧文件（如 .html）一律作为附件下载
+func inlineUpload(key string) bool {
+	ext := strings.ToLower(filepath.Ext(key))
+	if ext == ".jpeg" {
+		return true
+	}
+	for _, allowed := range allowedUploadTypes {
+		if ext == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// serveUploadAttachment 以附件形式返回文件内容
+func serveUploadAttachment(c *gin.Context, key string) {
+	r, err := storage.Current.Open(c.Request.Context(), key)
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	defer r.Close()
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(key)))
+	c.DataFromReader(http.StatusOK, -1, "application/octet-stream", r, nil)
+}
+
+// uploadKey 从 /uploads/ 地址中取出存储 key
+func uploadKey(url string) (string, bool) {
+	if !strings.HasPrefix(url, uploadURLPrefix) {
+		return "", false
+	}
+	key, err := storage.CleanKey(strings.TrimPrefix(url, uploadURLPrefix))
+	return key, err == nil
+}
+
+// signedURLExpiry 签名链接默认有效期
+func signedURLExpiry() time.Duration {
+	minutes := config.Current.Storage.SignedURLMinutes
+	if minutes <= 0 {
+		minutes = defaultSignedURLMinutes
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// uploadTokenValid 请求是否带有效登录令牌（Authorization 头或 token 参数，<img> 无法带请求头）
+func uploadTokenValid(c *gin.Context) bool {
+	token := c.Query("token")
+	if auth := c.GetHeader("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	if token == "" {
+		return false
+	}
+	_, err := middleware.ParseToken(token)
+	return err == nil
+}
+
+// ServeUpload 访问上传文件：本地存储直接返回文件，S3 存储跳转到限时签名地址。
+// 配置 require_signed 时，本地存储只接受有效的签名链接或登录令牌；
+// S3 存储每次都会签发新地址，必须带登录令牌。
+// 类型不在上传白名单内的旧文件以附件形式下载，不在浏览器中打开。
+func ServeUpload(c *gin.Context) {
+	key, err := storage.CleanKey(c.Param("filepath"))
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	c.Header("X-Content-Type-Options", "nosniff")
+	inline := inlineUpload(key)
+
+	switch s := storage.Current.(type) {
+	case *storage.Local:
+		expires, signature := c.Query("expires"), c.Query("signature")
+		if signature != "" && !s.VerifySignature(key, expires, signature) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "链接无效或已过期"})
+			return
+		}
+		if signature == "" && config.Current.Storage.RequireSigned && !uploadTokenValid(c) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "需要登录或签名链接"})
+			return
+		}
+		path, _ := s.Path(key)
+		if _, err := os.Stat(path); err != nil {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		if !inline {
+			serveUploadAttachment(c, key)
+			return
+		}
+		c.File(path)
+	default:
+		if !uploadTokenValid(c) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "需要登录或签名链接"})
+			return
+		}
+		if !inline {
+			serveUploadAttachment(c, key)
+			return
+		}
+		url, err := s.SignedURL(c.Request.Context(), key, signedURLExpiry())
+		if err != nil {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.Redirect(http.StatusFound, url)
+	}
+}
+
+// GetSignedURL 生成上传文件的限时下载地址（url=/uploads/..., expires_in 秒）
+func GetSignedURL(c *gin.Context) {
+	key, ok := uploadKey(c.Query("url"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的文件地址"})
+		return
+	}
+	ctx := c.Request.Context()
+	if _, err := storage.Current.Stat(ctx, key); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
+		return
+	}
+
+	expiry := signedURLExpiry()
+	if seconds, _ := strconv.Atoi(c.Query("expires_in")); seconds > 0 {
+		expiry = time.Duration(seconds) * time.Second
+		// S3 签名最长 7 天
+		if expiry > 7*24*time.Hour {
+			expiry = 7 * 24 * time.Hour
+		}
+	}
+	url, err := storage.Current.SignedURL(ctx, key, expiry)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"url": url, "expires_at": time.Now().Add(expiry)})
+}
+
+func UploadFile(c *gin.Context) {
+	limitUploadBody(c)
+	file, err := c.FormFile("file")
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			respondUploadError(c, errUploadTooLarge)
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+		return
+	}
+
+	saved, err := saveUploadedFile(c, file)
+	if err != nil {
+		respondUploadError(c, err)
 		return
 	}
 
 	// Return URL
 	// Assuming running on same domain/port or proxied
-	url := fmt.Sprintf("/uploads/%s", filename)
-	c.JSON(http.StatusOK, gin.H{"url": url})
+	c.JSON(http.StatusOK, gin.H{
+		"url":        saved.URL(),
+		"mime_type":  saved.MimeType,
+		"size":       saved.Size,
+		"thumbnails": saved.Thumbnails,
+	})
 }
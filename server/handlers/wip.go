@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"time"
+	"trace-server/config"
+	"trace-server/database"
+	"trace-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// wipThresholds 看板阈值：工位单独设置优先，否则使用配置，配置未设置时默认 20 单、24 小时
+func wipThresholds(station *models.Station) (maxQueue int, maxWaitHours float64) {
+	maxQueue, maxWaitHours = config.Current.WIP.MaxQueue, config.Current.WIP.MaxWaitHours
+	if maxQueue <= 0 {
+		maxQueue = 20
+	}
+	if maxWaitHours <= 0 {
+		maxWaitHours = 24
+	}
+	if station != nil && station.MaxQueue > 0 {
+		maxQueue = station.MaxQueue
+	}
+	if station != nil && station.MaxWaitHours > 0 {
+		maxWaitHours = station.MaxWaitHours
+	}
+	return maxQueue, maxWaitHours
+}
+
+// GetWIP 在制品看板：每个流程工位前的排队订单数、最久等待订单、平均等待时间，超过阈值的工位标记。
+// 工位看板无需登录，不返回客户信息
+func GetWIP(c *gin.Context) {
+	now := time.Now()
+	statuses := make([]string, len(orderWorkflow))
+	for i, step := range orderWorkflow {
+		statuses[i] = step.From
+	}
+
+	var orders []models.Order
+	database.DB.Select("id, order_no, status, status_changed_at, created_at").
+		Where("status IN ?", statuses).
+		Order("id asc").
+		Find(&orders)
+
+	var stations []models.Station
+	database.DB.Where("code IN ?", workflowCodes()).Find(&stations)
+	byCode := make(map[string]*models.Station, len(stations))
+	for i := range stations {
+		byCode[stations[i].Code] = &stations[i]
+	}
+
+	type wipOrder struct {
+		OrderID      uint      `json:"order_id"`
+		OrderNo      string    `json:"order_no"`
+		WaitingSince time.Time `json:"waiting_since"`
+		WaitHours    float64   `json:"wait_hours"`
+	}
+	type wipStage struct {
+		Stage        string    `json:"stage"` // 订单状态，如 待封面
+		Station      string    `json:"station"`
+		StationID    uint      `json:"station_id"`
+		Queue        int       `json:"queue"`
+		Capacity     int       `json:"capacity"`
+		AvgWaitHours float64   `json:"avg_wait_hours"`
+		Oldest       *wipOrder `json:"oldest"`
+		MaxQueue     int       `json:"max_queue"`
+		MaxWaitHours float64   `json:"max_wait_hours"`
+		Flags        []string  `json:"flags"`
+	}
+
+	stages := make([]wipStage, 0, len(orderWorkflow))
+	total := 0
+	bottleneck := ""
+	worstWait := 0.0
+	for _, step := range orderWorkflow {
+		stage := wipStage{Stage: step.From, Station: step.Code, Flags: []string{}}
+		station := byCode[step.Code]
+		if station != nil {
+			stage.Station, stage.StationID, stage.Capacity = station.Name, station.ID, station.Capacity
+		}
+		stage.MaxQueue, stage.MaxWaitHours = wipThresholds(station)
+
+		var waitSum float64
+		for _, o := range orders {
+			if o.Status != stage.Stage {
+				continue
+			}
+			since := o.CreatedAt
+			if o.StatusChangedAt != nil {
+				since = *o.StatusChangedAt
+			}
+			wait := now.Sub(since).Hours()
+			stage.Queue++
+			waitSum += wait
+			if stage.Oldest == nil || since.Before(stage.Oldest.WaitingSince) {
+				stage.Oldest = &wipOrder{OrderID: o.ID, OrderNo: o.OrderNo, WaitingSince: since}
+			}
+		}
+		if stage.Oldest != nil {
+			stage.Oldest.WaitHours = math.Round(now.Sub(stage.Oldest.WaitingSince).Hours()*10) / 10
+		}
+		if stage.Queue > 0 {
+			stage.AvgWaitHours = math.Round(waitSum/float64(stage.Queue)*10) / 10
+		}
+
+		if stage.Queue > stage.MaxQueue {
+			stage.Flags = append(stage.Flags, "排队过多")
+		}
+		if stage.AvgWaitHours > stage.MaxWaitHours {
+			stage.Flags = append(stage.Flags, "等待过久")
+		}
+		if stage.Capacity > 0 && stage.Queue > stage.Capacity {
+			stage.Flags = append(stage.Flags, "超出日产能")
+		}
+		// 有标记的工位中平均等待最久的视为瓶颈
+		if len(stage.Flags) > 0 && stage.AvgWaitHours >= worstWait {
+			bottleneck, worstWait = stage.Station, stage.AvgWaitHours
+		}
+		total += stage.Queue
+		stages = append(stages, stage)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":         stages,
+		"total":        total,
+		"bottleneck":   bottleneck,
+		"generated_at": now,
+	})
+}
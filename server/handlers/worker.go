@@ -9,24 +9,47 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// adminWorker 后台工人接口的出入参，附带工牌编码；工牌是打卡凭证，公开接口不返回
+type adminWorker struct {
+	models.Worker
+	BadgeCode string `json:"badge_code"`
+}
+
+func toAdminWorker(worker models.Worker) adminWorker {
+	return adminWorker{Worker: worker, BadgeCode: worker.BadgeCode}
+}
+
 func CreateWorker(c *gin.Context) {
-	var worker models.Worker
-	if err := c.ShouldBindJSON(&worker); err != nil {
+	var input adminWorker
+	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	worker := input.Worker
+	worker.BadgeCode = input.BadgeCode
 
 	if worker.Name == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "工人姓名不能为空"})
 		return
 	}
+	if badgeTaken(worker.BadgeCode, 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "工牌编码已被其他工人使用"})
+		return
+	}
+	station, err := resolveStation(worker.Station)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	worker.Station, worker.StationID = station.Name, station.ID
+	worker.Stations = nil // 工位分配通过 /workers/:id/stations 设置
 
 	if err := database.DB.Create(&worker).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, worker)
+	c.JSON(http.StatusOK, toAdminWorker(worker))
 }
 
 func UpdateWorker(c *gin.Context) {
@@ -37,7 +60,7 @@ func UpdateWorker(c *gin.Context) {
 		return
 	}
 
-	var input models.Worker
+	var input adminWorker
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -47,14 +70,42 @@ func UpdateWorker(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "工人姓名不能为空"})
 		return
 	}
+	if badgeTaken(input.BadgeCode, worker.ID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "工牌编码已被其他工人使用"})
+		return
+	}
+	station, err := resolveStation(input.Station)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// 已分配工位的工人，默认工位须在分配中
+	var assigned int64
+	database.DB.Model(&models.WorkerStation{}).Where("worker_id = ?", worker.ID).Count(&assigned)
+	if _, ok := workerSkill(&worker, station); assigned > 0 && !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "默认工位须在工人已分配的工位中"})
+		return
+	}
 
 	worker.Name = input.Name
-	worker.Station = input.Station
+	worker.Station, worker.StationID = station.Name, station.ID
 	worker.Phone = input.Phone
 	worker.ScannerCode = input.ScannerCode
+	worker.BadgeCode = input.BadgeCode
+	worker.ShiftID = input.ShiftID
 
 	database.DB.Save(&worker)
-	c.JSON(http.StatusOK, worker)
+	c.JSON(http.StatusOK, toAdminWorker(worker))
+}
+
+// badgeTaken 工牌编码是否已被其他工人使用
+func badgeTaken(badge string, exceptID uint) bool {
+	if badge == "" {
+		return false
+	}
+	var count int64
+	database.DB.Model(&models.Worker{}).Where("badge_code = ? AND id <> ?", badge, exceptID).Count(&count)
+	return count > 0
 }
 
 func GetWorkers(c *gin.Context) {
@@ -79,10 +130,14 @@ func GetWorkers(c *gin.Context) {
 	}
 
 	query.Count(&total)
-	query.Offset(offset).Limit(pageSize).Find(&workers)
+	query.Preload("Stations").Offset(offset).Limit(pageSize).Find(&workers)
+	data := make([]adminWorker, 0, len(workers))
+	for _, w := range workers {
+		data = append(data, toAdminWorker(w))
+	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"data":  workers,
+		"data":  data,
 		"total": total,
 		"page":  page,
 	})
@@ -90,7 +145,7 @@ func GetWorkers(c *gin.Context) {
 
 func GetWorker(c *gin.Context) {
 	var worker models.Worker
-	if err := database.DB.First(&worker, c.Param("id")).Error; err != nil {
+	if err := database.DB.Preload("Stations").First(&worker, c.Param("id")).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Worker not found"})
 		return
 	}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"trace-server/database"
+	"trace-server/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// workerSkill 工人在某工位的技能等级，未分配返回 false；
+// 没有分配记录的工人按默认工位、熟练处理，兼容一人一工位的旧数据
+func workerSkill(worker *models.Worker, station models.Station) (int, bool) {
+	var assignments []models.WorkerStation
+	database.DB.Where("worker_id = ?", worker.ID).Find(&assignments)
+	if len(assignments) == 0 {
+		return models.SkillSkilled, worker.StationID == station.ID || sameStation(worker.Station, station.Name)
+	}
+	for _, a := range assignments {
+		if a.StationID == station.ID || sameStation(a.Station, station.Name) {
+			return a.Skill, true
+		}
+	}
+	return 0, false
+}
+
+// scanStation 确定本次扫码的工位：扫码枪绑定了工位时以设备为准，否则使用工人的默认工位
+func scanStation(worker *models.Worker, scannerCode string) (models.Station, error) {
+	name := deviceStation(scannerCode)
+	if name == "" {
+		name = worker.Station
+	}
+	if name == "" {
+		return models.Station{}, errors.New("无法确定工位：扫码枪未绑定工位且工人没有默认工位")
+	}
+	station, ok := findStation(name)
+	if !ok {
+		return models.Station{Name: name}, errors.New("工位不存在: " + name)
+	}
+	if _, ok := workerSkill(worker, station); !ok {
+		return station, fmt.Errorf("%s 未分配到 %s 工位", worker.Name, station.Name)
+	}
+	return station, nil
+}
+
+// ---------- 工人工位分配 ----------
+
+// GetWorkerStations 工人可上岗的工位
+func GetWorkerStations(c *gin.Context) {
+	var worker models.Worker
+	if err := database.DB.Preload("Stations").First(&worker, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "工人不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, worker.Stations)
+}
+
+// SetWorkerStations 整体替换工人的工位分配；默认工位不在分配中时改为第一个分配的工位
+func SetWorkerStations(c *gin.Context) {
+	var worker models.Worker
+	if err := database.DB.First(&worker, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "工人不存在"})
+		return
+	}
+	var input []struct {
+		Station string `json:"station"`
+		Skill   int    `json:"skill"`
+		Remark  string `json:"remark"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	assignments := make([]models.WorkerStation, 0, len(input))
+	keepDefault := false
+	for _, in := range input {
+		station, ok := findStation(in.Station)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "工位不存在: " + in.Station})
+			return
+		}
+		if in.Skill == 0 {
+			in.Skill = models.SkillSkilled
+		}
+		if in.Skill < models.SkillTrainee || in.Skill > models.SkillMaster {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "技能等级应为 1 学徒、2 熟练或 3 师傅"})
+			return
+		}
+		for _, a := range assignments {
+			if a.StationID == station.ID {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "工位重复: " + station.Name})
+				return
+			}
+		}
+		assignments = append(assignments, models.WorkerStation{
+			WorkerID:  worker.ID,
+			Station:   station.Name,
+			StationID: station.ID,
+			Skill:     in.Skill,
+			Remark:    in.Remark,
+		})
+		keepDefault = keepDefault || worker.StationID == station.ID
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("worker_id = ?", worker.ID).Delete(&models.WorkerStation{}).Error; err != nil {
+			return err
+		}
+		if len(assignments) > 0 {
+			if err := tx.Create(&assignments).Error; err != nil {
+				return err
+			}
+			if !keepDefault {
+				worker.Station, worker.StationID = assignments[0].Station, assignments[0].StationID
+				return tx.Model(&worker).Updates(map[string]interface{}{"station": worker.Station, "station_id": worker.StationID}).Error
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	worker.Stations = assignments
+	c.JSON(http.StatusOK, worker)
+}
+
+// GetSkillMatrix 技能矩阵：工人 × 工位的技能等级
+func GetSkillMatrix(c *gin.Context) {
+	var workers []models.Worker
+	database.DB.Preload("Stations").Order("station asc, id asc").Find(&workers)
+
+	type matrixRow struct {
+		WorkerID   uint           `json:"worker_id"`
+		WorkerName string         `json:"worker_name"`
+		Station    string         `json:"station"` // 默认工位
+		Skills     map[string]int `json:"skills"`
+	}
+	seen := map[string]bool{}
+	rows := make([]matrixRow, 0, len(workers))
+	for _, w := range workers {
+		row := matrixRow{WorkerID: w.ID, WorkerName: w.Name, Station: w.Station, Skills: map[string]int{}}
+		for _, a := range w.Stations {
+			row.Skills[a.Station] = a.Skill
+			seen[a.Station] = true
+		}
+		if len(w.Stations) == 0 && w.Station != "" {
+			row.Skills[w.Station] = models.SkillSkilled
+			seen[w.Station] = true
+		}
+		rows = append(rows, row)
+	}
+
+	// 每个工位可上岗人数，便于发现只有一人会做的工位
+	stations := make([]string, 0, len(seen))
+	for s := range seen {
+		stations = append(stations, s)
+	}
+	sort.Strings(stations)
+	coverage := map[string]int{}
+	for _, row := range rows {
+		for s := range row.Skills {
+			coverage[s]++
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"stations": stations,
+		"data":     rows,
+		"coverage": coverage,
+	})
+}
@@ -2,11 +2,13 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"os"
 	"trace-server/database"
 	"trace-server/handlers"
 	"trace-server/middleware"
 	"trace-server/models"
+	"trace-server/storage"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
@@ -14,8 +16,19 @@ import (
 )
 
 func main() {
+	// 命令行子命令，如 ./trace-server migrate-storage -from local -to s3
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1:])
+		return
+	}
+
 	database.Connect()
+	if err := storage.Init(); err != nil {
+		log.Fatal("Failed to init storage:", err)
+	}
 	seedAdmin()
+	handlers.StartPrintQueue()
+	handlers.StartScannerMonitor()
 
 	r := gin.Default()
 
@@ -54,6 +67,18 @@ func main() {
 
 		api.PUT("/orders/:id/status", handlers.UpdateOrderStatus) // Used by Worker to update status
 		api.GET("/station/stats", handlers.GetStationStats)       // Public for Station Dashboard
+		api.GET("/station/wip", handlers.GetWIP)                  // 在制品看板
+		api.POST("/station/print", handlers.StationPrint)         // 工位打印订单标签
+		api.POST("/attendance/punch", handlers.PunchAttendance)   // 工位打卡
+
+		// Driver App (delivery tasks & proof of delivery)，凭后台签发的司机令牌访问
+		driver := api.Group("/driver")
+		driver.Use(middleware.DriverAuth(), handlers.RequireDriverWorker)
+		{
+			driver.GET("/deliveries", handlers.GetDriverDeliveries)
+			driver.PUT("/delivery-stops/:id", handlers.DriverUpdateDeliveryStop)
+			driver.POST("/upload", handlers.UploadFile) // 签名、送达照片
+		}
 
 		// Protected Admin Routes
 		admin := api.Group("/")
@@ -61,12 +86,94 @@ func main() {
 		{
 			// Dashboard
 			admin.GET("/dashboard/stats", handlers.GetDashboardStats)
+			admin.GET("/stats/lead-time", handlers.GetLeadTimeStats)
+
+			// Unified Search (orders, customers, products)
+			admin.GET("/search", handlers.Search)
 
 			// Orders (Admin Operations)
 			admin.POST("/orders", handlers.CreateOrder)
 			admin.DELETE("/orders/:id", handlers.DeleteOrder)
 			admin.PUT("/orders/:id", handlers.UpdateOrderDetails)
+			admin.GET("/orders/:id/pdf/invoice", handlers.GetOrderInvoicePDF)
+			admin.GET("/orders/:id/pdf/delivery-note", handlers.GetOrderDeliveryNotePDF)
+			admin.GET("/orders/:id/pdf/label", handlers.GetOrderLabelPDF)
+			admin.GET("/orders/labels/pdf", handlers.GetOrderLabelsPDF)
+			admin.POST("/orders/:id/print", handlers.PrintOrder)
 			admin.GET("/orders", handlers.GetOrders)
+			admin.GET("/orders/export", handlers.ExportOrders)
+			admin.GET("/orders/by-no/:orderNo", handlers.GetOrderByNo)
+			admin.POST("/orders/:id/clone", handlers.CloneOrder)
+			admin.POST("/orders/:id/template", handlers.SaveOrderAsTemplate)
+			admin.POST("/orders/:id/split", handlers.SplitOrder)
+			admin.POST("/orders/merge", handlers.MergeOrders)
+			admin.POST("/import/orders", middleware.AdminOnly(), handlers.ImportOrders)
+
+			// Order Templates (repeat orders)
+			admin.GET("/customers/:id/templates", handlers.GetCustomerTemplates)
+			admin.POST("/order-templates", handlers.CreateOrderTemplate)
+			admin.GET("/order-templates/:id", handlers.GetOrderTemplate)
+			admin.PUT("/order-templates/:id", handlers.UpdateOrderTemplate)
+			admin.DELETE("/order-templates/:id", handlers.DeleteOrderTemplate)
+			admin.POST("/order-templates/:id/orders", handlers.CreateOrderFromTemplate)
+
+			// Payments & Receivables
+			admin.GET("/orders/:id/payments", handlers.GetOrderPayments)
+			admin.POST("/orders/:id/payments", handlers.CreateOrderPayment)
+			admin.DELETE("/payments/:id", handlers.DeletePayment)
+			admin.GET("/customers/:id/balance", handlers.GetCustomerBalance)
+			admin.GET("/receivables/aging", handlers.GetReceivablesAging)
+
+			// Recycle Bin (deleted orders)
+			admin.GET("/recycle-bin/orders", handlers.GetDeletedOrders)
+			admin.POST("/recycle-bin/orders/:id/restore", handlers.RestoreOrder)
+			admin.DELETE("/recycle-bin/orders/:id", middleware.AdminOnly(), handlers.PurgeOrder)
+			admin.POST("/recycle-bin/purge", middleware.AdminOnly(), handlers.PurgeExpiredOrders)
+
+			// Deliveries
+			admin.GET("/deliveries/pending", handlers.GetPendingDeliveries)
+			admin.POST("/deliveries/auto", handlers.AutoCreateDeliveryBatches)
+			admin.GET("/deliveries", handlers.GetDeliveryBatches)
+			admin.POST("/deliveries", handlers.CreateDeliveryBatch)
+			admin.GET("/deliveries/:id", handlers.GetDeliveryBatch)
+			admin.PUT("/deliveries/:id", handlers.UpdateDeliveryBatch)
+			admin.DELETE("/deliveries/:id", handlers.DeleteDeliveryBatch)
+			admin.POST("/deliveries/:id/stops", handlers.AddDeliveryStops)
+			admin.POST("/deliveries/:id/depart", handlers.DepartDeliveryBatch)
+			admin.PUT("/delivery-stops/:id", handlers.UpdateDeliveryStop)
+			admin.DELETE("/delivery-stops/:id", handlers.RemoveDeliveryStop)
+			admin.GET("/orders/:id/deliveries", handlers.GetOrderDeliveries)
+			admin.POST("/workers/:id/driver-token", handlers.IssueDriverToken)
+
+			// After-sales
+			admin.GET("/after-sales", handlers.GetAfterSaleTickets)
+			admin.POST("/after-sales", handlers.CreateAfterSaleTicket)
+			admin.GET("/after-sales/:id", handlers.GetAfterSaleTicket)
+			admin.PUT("/after-sales/:id", handlers.UpdateAfterSaleTicket)
+			admin.DELETE("/after-sales/:id", handlers.DeleteAfterSaleTicket)
+			admin.POST("/after-sales/:id/resolve", handlers.ResolveAfterSaleTicket)
+			admin.POST("/after-sales/:id/close", handlers.CloseAfterSaleTicket)
+			admin.GET("/orders/:id/after-sales", handlers.GetOrderAfterSales)
+
+			// Attachments
+			admin.GET("/orders/:id/attachments", handlers.GetAttachments(models.AttachmentOwnerOrder))
+			admin.POST("/orders/:id/attachments", handlers.UploadAttachment(models.AttachmentOwnerOrder))
+			admin.GET("/products/:id/attachments", handlers.GetAttachments(models.AttachmentOwnerProduct))
+			admin.POST("/products/:id/attachments", handlers.UploadAttachment(models.AttachmentOwnerProduct))
+			admin.GET("/after-sales/:id/attachments", handlers.GetAttachments(models.AttachmentOwnerAfterSale))
+			admin.POST("/after-sales/:id/attachments", handlers.UploadAttachment(models.AttachmentOwnerAfterSale))
+			admin.PUT("/attachments/:id", handlers.UpdateAttachment)
+			admin.DELETE("/attachments/:id", handlers.DeleteAttachment)
+			admin.POST("/attachments/cleanup", middleware.AdminOnly(), handlers.CleanupOrphanAttachments)
+
+			// Quotations
+			admin.GET("/quotations", handlers.GetQuotations)
+			admin.POST("/quotations", handlers.CreateQuotation)
+			admin.GET("/quotations/:id", handlers.GetQuotation)
+			admin.PUT("/quotations/:id", handlers.UpdateQuotation)
+			admin.DELETE("/quotations/:id", handlers.DeleteQuotation)
+			admin.PUT("/quotations/:id/status", handlers.UpdateQuotationStatus)
+			admin.POST("/quotations/:id/convert", handlers.ConvertQuotation)
 
 			// Products
 			admin.POST("/products", handlers.CreateProduct)
@@ -83,20 +190,94 @@ func main() {
 			admin.DELETE("/workers/:id", handlers.DeleteWorker)
 			admin.GET("/workers", handlers.GetWorkers)
 			admin.GET("/workers/stats", handlers.GetWorkerStats)
+			admin.GET("/workers/stats/export", handlers.ExportWorkerStats)
+			admin.GET("/workers/skills", handlers.GetSkillMatrix)
+			admin.GET("/workers/:id/stations", handlers.GetWorkerStations)
+			admin.PUT("/workers/:id/stations", handlers.SetWorkerStations)
+			admin.GET("/stations", handlers.GetStations)
+			admin.POST("/stations", handlers.CreateStation)
+			admin.PUT("/stations/:id", handlers.UpdateStation)
+			admin.DELETE("/stations/:id", handlers.DeleteStation)
+			admin.GET("/scanners", handlers.GetScanners)
+			admin.POST("/scanners", handlers.CreateScanner)
+			admin.PUT("/scanners/:id", handlers.UpdateScanner)
+			admin.DELETE("/scanners/:id", handlers.DeleteScanner)
+			admin.PUT("/scanners/:id/worker", handlers.AssignScanner)
+			admin.GET("/scanner-alerts", handlers.GetScannerAlerts)
+			admin.POST("/scanner-alerts/:id/ack", handlers.AckScannerAlert)
+
+			// Piece-rate Payroll
+			admin.GET("/piece-rates", handlers.GetPieceRates)
+			admin.POST("/piece-rates", handlers.CreatePieceRate)
+			admin.PUT("/piece-rates/:id", handlers.UpdatePieceRate)
+			admin.DELETE("/piece-rates/:id", handlers.DeletePieceRate)
+			admin.GET("/payroll/periods", handlers.GetPayrollPeriods)
+			admin.POST("/payroll/periods", handlers.CreatePayrollPeriod)
+			admin.GET("/payroll/periods/:id", handlers.GetPayrollPeriod)
+			admin.DELETE("/payroll/periods/:id", handlers.DeletePayrollPeriod)
+			admin.GET("/payroll/periods/:id/workers/:workerId", handlers.GetPayrollWorker)
+			admin.GET("/payroll/periods/:id/export", handlers.ExportPayrollPeriod)
+			admin.POST("/payroll/periods/:id/calculate", handlers.RecalculatePayrollPeriod)
+			admin.POST("/payroll/periods/:id/adjustments", handlers.CreatePayrollAdjustment)
+			admin.DELETE("/payroll/adjustments/:id", handlers.DeletePayrollAdjustment)
+			admin.POST("/payroll/periods/:id/lock", handlers.LockPayrollPeriod)
+			admin.POST("/payroll/periods/:id/unlock", middleware.AdminOnly(), handlers.UnlockPayrollPeriod)
+			admin.POST("/payroll/periods/:id/approve", middleware.AdminOnly(), handlers.ApprovePayrollPeriod)
+
+			// 考勤
+			admin.GET("/shifts", handlers.GetShifts)
+			admin.POST("/shifts", handlers.CreateShift)
+			admin.PUT("/shifts/:id", handlers.UpdateShift)
+			admin.DELETE("/shifts/:id", handlers.DeleteShift)
+			admin.GET("/attendance", handlers.GetAttendances)
+			admin.POST("/attendance", handlers.CreateAttendance)
+			admin.PUT("/attendance/:id", handlers.UpdateAttendance)
+			admin.DELETE("/attendance/:id", handlers.DeleteAttendance)
+			admin.GET("/attendance/daily", handlers.GetDailyAttendance)
+			admin.GET("/attendance/report", handlers.GetAttendanceReport)
+
+			// Printers & Print Queue (thermal printers on port 9100)
+			admin.GET("/printers", handlers.GetPrinters)
+			admin.POST("/printers", handlers.CreatePrinter)
+			admin.PUT("/printers/:id", handlers.UpdatePrinter)
+			admin.DELETE("/printers/:id", handlers.DeletePrinter)
+			admin.POST("/printers/:id/test", handlers.TestPrinter)
+			admin.GET("/print-jobs", handlers.GetPrintJobs)
+			admin.GET("/print-jobs/:id", handlers.GetPrintJob)
+			admin.POST("/print-jobs/:id/retry", handlers.RetryPrintJob)
+			admin.POST("/print-jobs/:id/cancel", handlers.CancelPrintJob)
 
 			// Upload
 			admin.POST("/upload", handlers.UploadFile)
+			admin.GET("/files/signed-url", handlers.GetSignedURL)
 
 			// Customers
 			admin.GET("/customers", handlers.GetCustomers)
+			admin.GET("/customers/export", handlers.ExportCustomers)
 			admin.POST("/customers", handlers.CreateCustomer)
 			admin.PUT("/customers/:id", handlers.UpdateCustomer)
 			admin.DELETE("/customers/:id", handlers.DeleteCustomer)
+
+			// Price Lists
+			admin.GET("/price-lists", handlers.GetPriceLists)
+			admin.POST("/price-lists", handlers.CreatePriceList)
+			admin.GET("/price-lists/:id", handlers.GetPriceList)
+			admin.PUT("/price-lists/:id", handlers.UpdatePriceList)
+			admin.DELETE("/price-lists/:id", handlers.DeletePriceList)
+			admin.POST("/price-lists/:id/items", handlers.CreatePriceListItem)
+			admin.PUT("/price-lists/:id/items/:itemId", handlers.UpdatePriceListItem)
+			admin.DELETE("/price-lists/:id/items/:itemId", handlers.DeletePriceListItem)
+			admin.GET("/pricing/quote", handlers.GetPriceQuote)
+
+			// Numbering Sequences
+			admin.GET("/sequences", handlers.GetSequences)
+			admin.PUT("/sequences/:name", handlers.UpdateSequence)
 		}
 	}
 
-	// Serve Uploaded Images
-	r.Static("/uploads", "./uploads")
+	// Serve Uploaded Images (本地存储直接返回，S3 存储跳转签名地址)
+	r.GET("/uploads/*filepath", handlers.ServeUpload)
+	r.HEAD("/uploads/*filepath", handlers.ServeUpload)
 
 	// Serve Static Files (Frontend)
 	r.Static("/assets", "./dist/assets")
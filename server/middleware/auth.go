@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 	"time"
@@ -13,45 +14,104 @@ var SecretKey = []byte("your-secret-key-should-be-in-env") // In a real app, loa
 
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
+		claims, ok := parseToken(c)
+		if !ok {
 			return
 		}
-
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
+		// 司机令牌只能访问司机端接口
+		if claims["role"] == RoleDriver {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "司机令牌无权访问"})
 			return
 		}
+		c.Set("username", claims["username"])
+		c.Set("role", claims["role"])
 
-		tokenString := parts[1]
+		c.Next()
+	}
+}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid
-			}
-			return SecretKey, nil
-		})
+// RoleDriver 司机令牌的角色，由后台为司机签发
+const RoleDriver = "driver"
 
-		if err != nil || !token.Valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+// DriverAuth 校验司机令牌，司机身份（worker_id）取自令牌
+func DriverAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := parseToken(c)
+		if !ok {
 			return
 		}
-
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			// Check expiration
-			if float64(time.Now().Unix()) > claims["exp"].(float64) {
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token expired"})
-				return
-			}
-			c.Set("username", claims["username"])
-			c.Set("role", claims["role"])
-		} else {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		workerID, _ := claims["worker_id"].(float64)
+		if claims["role"] != RoleDriver || workerID <= 0 {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "需要司机令牌"})
 			return
 		}
+		c.Set("worker_id", uint(workerID))
+		c.Set("username", claims["username"])
+		c.Set("role", RoleDriver)
+
+		c.Next()
+	}
+}
+
+// parseToken 解析并校验 Bearer 令牌，失败时中止请求
+func parseToken(c *gin.Context) (jwt.MapClaims, bool) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
+		return nil, false
+	}
+
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
+		return nil, false
+	}
+
+	claims, err := ParseToken(parts[1])
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return claims, true
+}
+
+var (
+	errInvalidToken  = errors.New("Invalid or expired token")
+	errInvalidClaims = errors.New("Invalid token claims")
+	errTokenExpired  = errors.New("Token expired")
+)
+
+// ParseToken 校验令牌字符串（签名和有效期），返回其中的声明
+func ParseToken(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return SecretKey, nil
+	})
+
+	if err != nil || !token.Valid {
+		return nil, errInvalidToken
+	}
 
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errInvalidClaims
+	}
+	// Check expiration
+	if exp, ok := claims["exp"].(float64); !ok || float64(time.Now().Unix()) > exp {
+		return nil, errTokenExpired
+	}
+	return claims, nil
+}
+
+// AdminOnly 仅允许管理员角色访问，需放在 AuthMiddleware 之后
+func AdminOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("role") != "admin" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "需要管理员权限"})
+			return
+		}
 		c.Next()
 	}
 }
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 售后工单状态
+const (
+	AfterSalePending    = "待处理"
+	AfterSaleProcessing = "处理中" // 重做单生产中
+	AfterSaleResolved   = "已解决"
+	AfterSaleClosed     = "已关闭" // 不予处理
+)
+
+// 售后处理方式
+const (
+	ResolutionRepair = "repair" // 上门维修
+	ResolutionRemake = "remake" // 重做，生成重做订单
+	ResolutionRefund = "refund" // 退款
+)
+
+// AfterSaleTicket 售后工单，关联原订单及有问题的产品明细
+type AfterSaleTicket struct {
+	gorm.Model
+	TicketNo      string          `json:"ticket_no" gorm:"uniqueIndex;size:64"`
+	OrderID       uint            `json:"order_id" gorm:"index"`
+	Order         *Order          `json:"order,omitempty"`
+	CustomerID    uint            `json:"customer_id" gorm:"index"`
+	CustomerName  string          `json:"customer_name"`
+	Phone         string          `json:"phone"`
+	Reason        string          `json:"reason"` // 塌陷、尺寸不符、运输损坏等
+	Description   string          `json:"description"`
+	Resolution    string          `json:"resolution"` // repair, remake, refund
+	Status        string          `json:"status"`     // 待处理, 处理中, 已解决, 已关闭
+	RemakeOrderID *uint           `json:"remake_order_id"`
+	RefundAmount  float64         `json:"refund_amount"`
+	PaymentID     *uint           `json:"payment_id"` // 退款记录
+	Operator      string          `json:"operator"`
+	Remark        string          `json:"remark"` // 处理说明
+	ResolvedAt    *time.Time      `json:"resolved_at"`
+	Items         []AfterSaleItem `json:"items" gorm:"foreignKey:TicketID"`
+	Attachments   []Attachment    `json:"attachments" gorm:"polymorphic:Owner;polymorphicValue:after_sale"` // 问题照片
+}
+
+// AfterSaleItem 售后涉及的订单明细及数量
+type AfterSaleItem struct {
+	gorm.Model
+	TicketID       uint          `json:"ticket_id" gorm:"index"`
+	OrderProductID uint          `json:"order_product_id"`
+	OrderProduct   *OrderProduct `json:"order_product,omitempty"`
+	Quantity       int           `json:"quantity"`
+	Remark         string        `json:"remark"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import "gorm.io/gorm"
+
+// 附件所属对象类型
+const (
+	AttachmentOwnerOrder     = "order"
+	AttachmentOwnerProduct   = "product"
+	AttachmentOwnerAfterSale = "after_sale"
+	AttachmentOwnerDelivery  = "delivery" // 配送站点的签收凭证
+)
+
+// Attachment 附件（订单图片、产品图片、售后照片等）
+type Attachment struct {
+	gorm.Model
+	OwnerType  string `json:"owner_type" gorm:"index:idx_attachment_owner;size:32"` // order, product, after_sale, delivery
+	OwnerID    uint   `json:"owner_id" gorm:"index:idx_attachment_owner"`
+	FileName   string `json:"file_name"` // 上传时的原始文件名
+	Path       string `json:"path"`      // 上传目录下的相对路径
+	URL        string `json:"url"`
+	MimeType   string `json:"mime_type"`
+	Size       int64  `json:"size"`
+	Thumbnails string `json:"thumbnails"` // 缩略图URL，JSON对象 {"200": "/uploads/thumbs/..."}
+	Caption    string `json:"caption"`
+	SortOrder  int    `json:"sort_order"`
+	Uploader   string `json:"uploader"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 打卡来源
+const (
+	AttendanceBadge   = "badge"   // 工位扫工牌
+	AttendanceScanner = "scanner" // 工位扫码枪
+	AttendanceManual  = "manual"  // 后台补录
+)
+
+// Shift 班次，时间为 "08:00" 形式；下班时间早于上班时间表示跨天
+type Shift struct {
+	gorm.Model
+	Name       string `json:"name"`
+	StartTime  string `json:"start_time"`
+	EndTime    string `json:"end_time"`
+	BreakStart string `json:"break_start"` // 固定休息（如午休），不计入工时；为空表示无
+	BreakEnd   string `json:"break_end"`
+	LateGrace  int    `json:"late_grace"` // 迟到宽限分钟
+	IsDefault  bool   `json:"is_default"` // 未指定班次的工人使用默认班次
+	Remark     string `json:"remark"`
+}
+
+// Attendance 一次出勤：上班打卡到下班打卡
+type Attendance struct {
+	gorm.Model
+	WorkerID     uint       `json:"worker_id" gorm:"index"`
+	Worker       *Worker    `json:"worker,omitempty"`
+	WorkDate     string     `json:"work_date" gorm:"index;size:10"` // 上班打卡日期 2006-01-02
+	ShiftID      *uint      `json:"shift_id"`
+	Shift        *Shift     `json:"shift,omitempty"`
+	ClockIn      time.Time  `json:"clock_in"`
+	ClockOut     *time.Time `json:"clock_out"`
+	BreakStartAt *time.Time `json:"break_start_at"` // 正在休息时的开始时间
+	BreakMinutes int        `json:"break_minutes"`  // 临时休息累计分钟（不含班次固定休息）
+	Source       string     `json:"source"`
+	Remark       string     `json:"remark"`
+}
@@ -10,4 +10,7 @@ type Customer struct {
 	Phone   string `json:"phone" gorm:"unique"` // Phone should be unique
 	Address string `json:"address"`
 	Remark  string `json:"remark"`
+
+	PriceListID *uint      `json:"price_list_id"` // 客户专属价目表，为空时使用默认价目表
+	PriceList   *PriceList `json:"price_list,omitempty" gorm:"foreignKey:PriceListID"`
 }
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 配送批次状态
+const (
+	DeliveryBatchPending   = "待出车"
+	DeliveryBatchOnRoute   = "配送中"
+	DeliveryBatchCompleted = "已完成"
+)
+
+// 配送站点状态
+const (
+	DeliveryStopPending   = "待配送"
+	DeliveryStopDelivered = "已送达"
+	DeliveryStopFailed    = "未送达" // 客户不在、拒收等，订单可重新排入其他批次
+)
+
+// DeliveryBatch 配送批次：同一天、同一片区的订单由一名司机一趟送完
+type DeliveryBatch struct {
+	gorm.Model
+	BatchNo      string         `json:"batch_no" gorm:"uniqueIndex;size:64"`
+	DeliveryDate time.Time      `json:"delivery_date" gorm:"index"`
+	Area         string         `json:"area"` // 片区，默认由订单地址提取
+	DriverID     *uint          `json:"driver_id" gorm:"index"`
+	Driver       *Worker        `json:"driver,omitempty"`
+	Vehicle      string         `json:"vehicle"` // 车牌号
+	Status       string         `json:"status"`  // 待出车, 配送中, 已完成
+	Remark       string         `json:"remark"`
+	DepartedAt   *time.Time     `json:"departed_at"`
+	CompletedAt  *time.Time     `json:"completed_at"`
+	Stops        []DeliveryStop `json:"stops" gorm:"foreignKey:BatchID"`
+}
+
+// DeliveryStop 配送站点，一个订单一站，含签收凭证
+type DeliveryStop struct {
+	gorm.Model
+	BatchID      uint         `json:"batch_id" gorm:"index"`
+	OrderID      uint         `json:"order_id" gorm:"index"`
+	Order        *Order       `json:"order,omitempty"`
+	Seq          int          `json:"seq"`     // 配送顺序
+	Address      string       `json:"address"` // 下单时的送货地址快照
+	Status       string       `json:"status"`  // 待配送, 已送达, 未送达
+	ReceiverName string       `json:"receiver_name"`
+	SignatureURL string       `json:"signature_url"` // 签名图片（通过上传接口获取URL），同时存为附件
+	Photos       string       `json:"photos"`        // 旧版送达照片URL列表 (JSON数组)，新登记的照片存为附件
+	FailReason   string       `json:"fail_reason"`
+	DeliveredAt  *time.Time   `json:"delivered_at"`
+	Attachments  []Attachment `json:"attachments,omitempty" gorm:"polymorphic:Owner;polymorphicValue:delivery"`
+}
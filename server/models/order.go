@@ -8,25 +8,37 @@ import (
 
 type Order struct {
 	gorm.Model
-	CustomerName  string         `json:"customer_name"`
-	Phone         string         `json:"phone"`
-	Address       string         `json:"address"` // 送货地址
-	Amount        float64        `json:"amount"`
-	Specs         string         `json:"specs"` // JSON string or comma-separated
-	Remark        string         `json:"remark"`
-	Status        string         `json:"status"`   // "Pending", "In Progress", "Completed", "Delivered"
-	Deadline      *time.Time     `json:"deadline"` // Estimated Completion Date
-	OrderNo       string         `json:"order_no"`
-	QRCode        string         `json:"qr_code"`
-	Attachments   string         `json:"attachments"` // 附件图片URL列表 (JSON数组)
-	OrderProducts []OrderProduct `json:"order_products" gorm:"foreignKey:OrderID"`
-	Processes     []Process      `json:"processes"`
+	CustomerID      uint           `json:"customer_id"`
+	CustomerName    string         `json:"customer_name"`
+	Phone           string         `json:"phone"`
+	Address         string         `json:"address"` // 送货地址
+	Amount          float64        `json:"amount"`
+	Subtotal        float64        `json:"subtotal"`       // 明细合计（整单折扣前）
+	DiscountType    string         `json:"discount_type"`  // 整单折扣类型: percent, fixed
+	DiscountValue   float64        `json:"discount_value"` // 折扣值（百分比或金额）
+	Discount        float64        `json:"discount"`       // 实际减免金额
+	PaidAmount      float64        `json:"paid_amount"`    // 已收金额（收款合计 - 退款），由收款记录汇总
+	Specs           string         `json:"specs"`          // JSON string or comma-separated
+	Remark          string         `json:"remark"`
+	Status          string         `json:"status"`                         // "Pending", "In Progress", "Completed", "Delivered"
+	StatusChangedAt *time.Time     `json:"status_changed_at" gorm:"index"` // 进入当前状态的时间
+	Deadline        *time.Time     `json:"deadline"`                       // Estimated Completion Date
+	OrderNo         string         `json:"order_no" gorm:"uniqueIndex;size:64"`
+	QRCode          string         `json:"qr_code"`
+	ParentID        *uint          `json:"parent_id" gorm:"index"`     // 拆单时指向原订单
+	MergedIntoID    *uint          `json:"merged_into_id"`             // 合并后指向目标订单（本单随即删除）
+	AfterSaleID     *uint          `json:"after_sale_id" gorm:"index"` // 售后重做单指向售后工单
+	Children        []Order        `json:"children,omitempty" gorm:"foreignKey:ParentID"`
+	OrderProducts   []OrderProduct `json:"order_products" gorm:"foreignKey:OrderID"`
+	Attachments     []Attachment   `json:"attachments" gorm:"polymorphic:Owner;polymorphicValue:order"`
+	Processes       []Process      `json:"processes"`
 }
 
 type Process struct {
 	gorm.Model
 	OrderID     uint      `json:"order_id"`
 	Station     string    `json:"station"`
+	StationID   uint      `json:"station_id" gorm:"index"`
 	Status      string    `json:"status"` // "Pending", "In Progress", "Completed"
 	WorkerID    uint      `json:"worker_id"`
 	CompletedAt time.Time `json:"completed_at"`
@@ -17,8 +17,14 @@ type OrderProduct struct {
 	Height     float64 `json:"height"`      // e.g. cm
 	Quantity   int     `json:"quantity"`    // Number of items with these specs
 	Unit       string  `json:"unit"`        // 计量单位: 块、平米、个等
+	ListPrice  float64 `json:"list_price"`  // 价目表单价（未命中价目表时为 0）
 	UnitPrice  float64 `json:"unit_price"`  // Price per unit
-	TotalPrice float64 `json:"total_price"` // Quantity * UnitPrice
+	TotalPrice float64 `json:"total_price"` // Quantity * UnitPrice - Discount
+
+	// 行折扣
+	DiscountType  string  `json:"discount_type"`  // percent, fixed
+	DiscountValue float64 `json:"discount_value"` // 折扣值（百分比或金额）
+	Discount      float64 `json:"discount"`       // 实际减免金额
 
 	// 额外属性值 (JSON 格式，如 {"颜色": "红色", "材质": "棉麻"})
 	ExtraAttrs string `json:"extra_attrs"`
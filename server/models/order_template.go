@@ -0,0 +1,34 @@
+package models
+
+import "gorm.io/gorm"
+
+// OrderTemplate 客户常用订单模板（如酒店、学校每年重复下单的规格）
+type OrderTemplate struct {
+	gorm.Model
+	CustomerID    uint                `json:"customer_id" gorm:"index"`
+	Name          string              `json:"name"`
+	Address       string              `json:"address"`
+	Specs         string              `json:"specs"`
+	Remark        string              `json:"remark"`
+	DiscountType  string              `json:"discount_type"`
+	DiscountValue float64             `json:"discount_value"`
+	Items         []OrderTemplateItem `json:"items" gorm:"foreignKey:TemplateID"`
+}
+
+// OrderTemplateItem 模板明细，单价为 0 时下单按客户价目表取价
+type OrderTemplateItem struct {
+	gorm.Model
+	TemplateID uint     `json:"template_id"`
+	ProductID  uint     `json:"product_id"`
+	Product    *Product `json:"product" gorm:"foreignKey:ProductID"`
+
+	Length        float64 `json:"length"`
+	Width         float64 `json:"width"`
+	Height        float64 `json:"height"`
+	Quantity      int     `json:"quantity"`
+	Unit          string  `json:"unit"`
+	UnitPrice     float64 `json:"unit_price"`
+	DiscountType  string  `json:"discount_type"`
+	DiscountValue float64 `json:"discount_value"`
+	ExtraAttrs    string  `json:"extra_attrs"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 收款类型
+const (
+	PaymentDeposit = "deposit" // 定金
+	PaymentNormal  = "payment" // 收款（含分期/尾款）
+	PaymentRefund  = "refund"  // 退款
+	// 折让：不收付现金，冲减订单应收（售后退款、免费重做），订单金额保持原销售额
+	PaymentAllowance = "allowance"
+)
+
+// 收款方式
+const (
+	PayMethodCash   = "cash"
+	PayMethodWeChat = "wechat"
+	PayMethodAlipay = "alipay"
+	PayMethodBank   = "bank_transfer"
+	PayMethodOther  = "other"
+)
+
+// Payment 订单收付款记录，退款金额同样记为正数，由 Type 区分方向
+type Payment struct {
+	gorm.Model
+	OrderID    uint      `json:"order_id" gorm:"index"`
+	CustomerID uint      `json:"customer_id" gorm:"index"`
+	Type       string    `json:"type"`   // deposit, payment, refund, allowance
+	Method     string    `json:"method"` // cash, wechat, alipay, bank_transfer, other
+	Amount     float64   `json:"amount"`
+	PaidAt     time.Time `json:"paid_at"`
+	Operator   string    `json:"operator"` // 操作人（后台用户名或工人姓名）
+	Remark     string    `json:"remark"`
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 计件单位
+const (
+	RateUnitPiece = "件"  // 按明细数量计
+	RateUnitSqm   = "平米" // 按长×宽（厘米）折算平米数再乘数量
+)
+
+// 工资期状态：草稿可重算和调整，锁定后只能审核或解锁，审核后不可更改
+const (
+	PayrollDraft    = "草稿"
+	PayrollLocked   = "已锁定"
+	PayrollApproved = "已审核"
+)
+
+// PieceRate 计件工价：工位 × 产品，ProductID 为 0 时适用于该工位的其他产品
+type PieceRate struct {
+	gorm.Model
+	Station   string   `json:"station" gorm:"index"`
+	ProductID uint     `json:"product_id" gorm:"index"`
+	Product   *Product `json:"product,omitempty" gorm:"foreignKey:ProductID"`
+	Unit      string   `json:"unit"` // 件 或 平米
+	Rate      float64  `json:"rate"` // 每件或每平米工钱
+	Remark    string   `json:"remark"`
+}
+
+// PayrollPeriod 工资期，按扫码完成时间 [StartDate, EndDate] 结算
+type PayrollPeriod struct {
+	gorm.Model
+	Name         string     `json:"name"` // 如 "2026年10月"
+	StartDate    time.Time  `json:"start_date"`
+	EndDate      time.Time  `json:"end_date"` // 含当天
+	Status       string     `json:"status" gorm:"index"`
+	Amount       float64    `json:"amount"` // 计件 + 调整合计
+	CalculatedAt *time.Time `json:"calculated_at"`
+	LockedBy     string     `json:"locked_by"`
+	LockedAt     *time.Time `json:"locked_at"`
+	ApprovedBy   string     `json:"approved_by"`
+	ApprovedAt   *time.Time `json:"approved_at"`
+	Remark       string     `json:"remark"`
+}
+
+// PayrollLine 计件明细：一次工序完成记录 × 一条订单明细
+type PayrollLine struct {
+	gorm.Model
+	PeriodID       uint      `json:"period_id" gorm:"index"`
+	WorkerID       uint      `json:"worker_id" gorm:"index"`
+	WorkerName     string    `json:"worker_name"`
+	ProcessID      uint      `json:"process_id" gorm:"index"`
+	CompletedAt    time.Time `json:"completed_at"`
+	Station        string    `json:"station"`
+	OrderID        uint      `json:"order_id"`
+	OrderNo        string    `json:"order_no"`
+	OrderProductID uint      `json:"order_product_id"`
+	ProductID      uint      `json:"product_id"`
+	ProductName    string    `json:"product_name"`
+	Length         float64   `json:"length"`
+	Width          float64   `json:"width"`
+	Quantity       int       `json:"quantity"`
+	Area           float64   `json:"area"` // 平米数（已乘数量）
+	Unit           string    `json:"unit"`
+	Rate           float64   `json:"rate"`
+	Amount         float64   `json:"amount"`
+	Note           string    `json:"note"` // 如 "未设置工价"
+}
+
+// PayrollAdjustment 工资调整（奖励为正、扣款为负）
+type PayrollAdjustment struct {
+	gorm.Model
+	PeriodID uint    `json:"period_id" gorm:"index"`
+	WorkerID uint    `json:"worker_id" gorm:"index"`
+	Amount   float64 `json:"amount"`
+	Reason   string  `json:"reason"`
+	Operator string  `json:"operator"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import "gorm.io/gorm"
+
+// 折扣类型
+const (
+	DiscountPercent = "percent" // 按百分比折扣，DiscountValue 为 0-100
+	DiscountFixed   = "fixed"   // 固定金额减免
+)
+
+// PriceList 价目表（如经销商价、零售价），可分配给客户
+type PriceList struct {
+	gorm.Model
+	Name      string          `json:"name"`
+	Remark    string          `json:"remark"`
+	IsDefault bool            `json:"is_default"` // 未分配价目表的客户使用默认价目表
+	Items     []PriceListItem `json:"items" gorm:"foreignKey:PriceListID"`
+}
+
+// PriceListItem 价目表中的产品单价，同一产品可按起订数量设置阶梯价
+type PriceListItem struct {
+	gorm.Model
+	PriceListID uint     `json:"price_list_id"`
+	ProductID   uint     `json:"product_id"`
+	Product     *Product `json:"product" gorm:"foreignKey:ProductID"`
+	MinQuantity int      `json:"min_quantity"` // 阶梯起订数量，0 或 1 表示基础价
+	UnitPrice   float64  `json:"unit_price"`
+}
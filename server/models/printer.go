@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 打印任务状态
+const (
+	PrintJobPending  = "待打印" // 含等待重试
+	PrintJobPrinting = "打印中"
+	PrintJobDone     = "已完成"
+	PrintJobFailed   = "失败" // 重试次数用完
+	PrintJobCanceled = "已取消"
+)
+
+// 打印内容
+const (
+	PrintKindLabel   = "label"   // 订单/明细标签
+	PrintKindReceipt = "receipt" // 小票
+	PrintKindTest    = "test"    // 测试页
+)
+
+// Printer 工位上的热敏打印机，通过 9100 端口直连
+type Printer struct {
+	gorm.Model
+	Name     string  `json:"name"`
+	Station  string  `json:"station" gorm:"index"` // 所在工位
+	Protocol string  `json:"protocol"`             // zpl, tspl, escpos
+	Host     string  `json:"host"`
+	Port     int     `json:"port"`      // 默认 9100
+	WidthMM  float64 `json:"width_mm"`  // 标签/小票纸宽度
+	HeightMM float64 `json:"height_mm"` // 标签高度
+	DPI      int     `json:"dpi"`       // 默认 203
+	Font     string  `json:"font"`      // ZPL 中文字体，如 E:SIMSUN.TTF
+	Enabled  bool    `json:"enabled"`
+	Remark   string  `json:"remark"`
+}
+
+// PrintJob 打印队列中的任务，打印指令在入队时生成，失败后按间隔自动重试
+type PrintJob struct {
+	gorm.Model
+	PrinterID   uint       `json:"printer_id" gorm:"index"`
+	Printer     *Printer   `json:"printer,omitempty"`
+	OrderID     *uint      `json:"order_id" gorm:"index"`
+	Kind        string     `json:"kind"`        // label, receipt, test
+	Description string     `json:"description"` // 如 "TT2610-0001 标签 ×4"
+	Data        []byte     `json:"-"`           // 打印指令
+	Copies      int        `json:"copies"`
+	Status      string     `json:"status" gorm:"index"`
+	Attempts    int        `json:"attempts"`
+	MaxAttempts int        `json:"max_attempts"`
+	LastError   string     `json:"last_error"`
+	NextRunAt   *time.Time `json:"next_run_at"` // 下次重试时间
+	PrintedAt   *time.Time `json:"printed_at"`
+	Operator    string     `json:"operator"`
+}
@@ -5,12 +5,13 @@ import "gorm.io/gorm"
 // Product 产品（原分类，现直接作为可绑定订单的产品）
 type Product struct {
 	gorm.Model
-	Name       string             `json:"name"`
-	Code       string             `json:"code"`       // 产品编号
-	Icon       string             `json:"icon"`       // 图标 emoji
-	Image      string             `json:"image"`      // 产品图片
-	SortOrder  int                `json:"sort_order"` // 排序
-	Attributes []ProductAttribute `json:"attributes" gorm:"foreignKey:ProductID"`
+	Name        string             `json:"name"`
+	Code        string             `json:"code"`       // 产品编号
+	Icon        string             `json:"icon"`       // 图标 emoji
+	Image       string             `json:"image"`      // 产品图片
+	SortOrder   int                `json:"sort_order"` // 排序
+	Attributes  []ProductAttribute `json:"attributes" gorm:"foreignKey:ProductID"`
+	Attachments []Attachment       `json:"attachments,omitempty" gorm:"polymorphic:Owner;polymorphicValue:product"`
 }
 
 // ProductAttribute 产品属性定义
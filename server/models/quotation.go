@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 报价单状态
+const (
+	QuotationPending   = "待确认"
+	QuotationAccepted  = "已接受"
+	QuotationRejected  = "已拒绝"
+	QuotationConverted = "已转订单"
+)
+
+// Quotation 报价单，客户确认后可转为订单进入生产流程
+type Quotation struct {
+	gorm.Model
+	QuoteNo       string          `json:"quote_no" gorm:"uniqueIndex;size:64"`
+	CustomerID    uint            `json:"customer_id"`
+	CustomerName  string          `json:"customer_name"`
+	Phone         string          `json:"phone"`
+	Address       string          `json:"address"`
+	Subtotal      float64         `json:"subtotal"`
+	DiscountType  string          `json:"discount_type"`
+	DiscountValue float64         `json:"discount_value"`
+	Discount      float64         `json:"discount"`
+	Amount        float64         `json:"amount"`
+	Remark        string          `json:"remark"`
+	Status        string          `json:"status"`
+	ValidUntil    *time.Time      `json:"valid_until"` // 报价有效期
+	OrderID       *uint           `json:"order_id"`    // 转换后的订单
+	Items         []QuotationItem `json:"items" gorm:"foreignKey:QuotationID"`
+}
+
+// QuotationItem 报价明细，字段与 OrderProduct 一致
+type QuotationItem struct {
+	gorm.Model
+	QuotationID uint     `json:"quotation_id"`
+	ProductID   uint     `json:"product_id"`
+	Product     *Product `json:"product" gorm:"foreignKey:ProductID"`
+
+	Length     float64 `json:"length"`
+	Width      float64 `json:"width"`
+	Height     float64 `json:"height"`
+	Quantity   int     `json:"quantity"`
+	Unit       string  `json:"unit"`
+	ListPrice  float64 `json:"list_price"`
+	UnitPrice  float64 `json:"unit_price"`
+	TotalPrice float64 `json:"total_price"`
+
+	DiscountType  string  `json:"discount_type"`
+	DiscountValue float64 `json:"discount_value"`
+	Discount      float64 `json:"discount"`
+
+	ExtraAttrs string `json:"extra_attrs"`
+}
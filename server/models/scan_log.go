@@ -7,6 +7,7 @@ type ScanLog struct {
 	WorkerID    uint   `json:"worker_id"`
 	WorkerName  string `json:"worker_name"`
 	Station     string `json:"station"`
+	StationID   uint   `json:"station_id" gorm:"index"`
 	Content     string `json:"content"` // The raw QR code or parsed relevant part
 	IsSuccess   bool   `json:"is_success"`
 	Message     string `json:"message"` // Error message or Success details
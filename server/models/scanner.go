@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ScannerDevice 扫码枪。绑定工位后扫码按设备所在工位流转；指定工人后扫码记在该工人名下，
+// 未指定时按工人的扫码枪代码识别
+type ScannerDevice struct {
+	gorm.Model
+	Code          string     `json:"code" gorm:"uniqueIndex;size:50"` // 扫码枪代码前缀，如 "FM1#"
+	Name          string     `json:"name"`
+	Station       string     `json:"station" gorm:"index"`
+	StationID     uint       `json:"station_id" gorm:"index"`
+	WorkerID      *uint      `json:"worker_id" gorm:"index"`
+	Worker        *Worker    `json:"worker,omitempty"`
+	SilentMinutes int        `json:"silent_minutes"` // 工作时间内超过该分钟数没有扫码则告警，0 使用默认值
+	LastSeenAt    *time.Time `json:"last_seen_at"`
+	Remark        string     `json:"remark"`
+}
+
+// ScannerAlert 扫码枪静默告警：工作时间内工位扫码枪长时间没有扫码，恢复扫码后自动关闭
+type ScannerAlert struct {
+	gorm.Model
+	DeviceID   uint           `json:"device_id" gorm:"index"`
+	Device     *ScannerDevice `json:"device,omitempty"`
+	Code       string         `json:"code"`
+	Station    string         `json:"station"`
+	Message    string         `json:"message"`
+	SilentFrom time.Time      `json:"silent_from"` // 最后一次扫码或当天上班时间
+	ResolvedAt *time.Time     `json:"resolved_at"`
+	AckBy      string         `json:"ack_by"` // 已知悉（如设备送修），不再重复告警直到恢复扫码
+	AckAt      *time.Time     `json:"ack_at"`
+}
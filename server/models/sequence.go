@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 编号规则名称
+const (
+	SequenceOrder     = "order"
+	SequenceQuotation = "quotation"
+	SequenceDelivery  = "delivery"
+	SequenceAfterSale = "after_sale"
+)
+
+// 编号重置周期
+const (
+	SequenceResetDay   = "day"
+	SequenceResetMonth = "month"
+	SequenceResetYear  = "year"
+	SequenceResetNever = "never"
+)
+
+// Sequence 编号规则，如订单号、报价单号
+// Pattern 支持占位符 {YYYY} {YY} {MM} {DD} {SEQ}，例如 "TT{YY}{MM}-{SEQ}" 生成 TT2510-0042
+type Sequence struct {
+	gorm.Model
+	Name    string `json:"name" gorm:"uniqueIndex;size:32"` // order, quotation, delivery, after_sale
+	Pattern string `json:"pattern"`
+	Padding int    `json:"padding"` // 序号位数，不足补零
+	Reset   string `json:"reset"`   // day, month, year, never
+}
+
+// SequenceCounter 编号计数器，每个规则在每个周期内一行
+type SequenceCounter struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	Name      string    `json:"name" gorm:"uniqueIndex:idx_sequence_period;size:32"`
+	PeriodKey string    `json:"period_key" gorm:"uniqueIndex:idx_sequence_period;size:16"`
+	Value     int64     `json:"value"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import "gorm.io/gorm"
+
+// Station 工位；Name 为扫码流转使用的工位名，Aliases 为同一工位的其他叫法（逗号分隔，如送货的 "运货"）
+type Station struct {
+	gorm.Model
+	Code         string          `json:"code" gorm:"uniqueIndex;size:20"` // 如 "XL"
+	Name         string          `json:"name" gorm:"uniqueIndex;size:50"`
+	Aliases      string          `json:"aliases"`
+	SortOrder    int             `json:"sort_order"`
+	Capacity     int             `json:"capacity"`       // 每日产能（单），0 表示不限
+	MaxQueue     int             `json:"max_queue"`      // 在制品看板：排队订单数上限，0 使用配置默认值
+	MaxWaitHours float64         `json:"max_wait_hours"` // 在制品看板：平均等待小时数上限，0 使用配置默认值
+	Remark       string          `json:"remark"`
+	Scanners     []ScannerDevice `json:"scanners,omitempty" gorm:"foreignKey:StationID"`
+}
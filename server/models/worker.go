@@ -4,8 +4,29 @@ import "gorm.io/gorm"
 
 type Worker struct {
 	gorm.Model
-	Name        string `json:"name"`
-	Station     string `json:"station"` // e.g., "MaterialLoading", "Production", "Assembly"
-	Phone       string `json:"phone"`
-	ScannerCode string `json:"scanner_code" gorm:"unique"` // e.g. "XL1#"
+	Name        string          `json:"name"`
+	Station     string          `json:"station"` // 默认工位；扫码枪未绑定工位时按此工位流转
+	StationID   uint            `json:"station_id" gorm:"index"`
+	Phone       string          `json:"phone"`
+	ScannerCode string          `json:"scanner_code" gorm:"unique"` // e.g. "XL1#"
+	BadgeCode   string          `json:"-" gorm:"index"`             // 工牌二维码内容，工位扫工牌打卡；属于凭证，只由后台工人接口返回
+	ShiftID     *uint           `json:"shift_id"`                   // 班次，为空时使用默认班次
+	Stations    []WorkerStation `json:"stations,omitempty" gorm:"foreignKey:WorkerID"`
+}
+
+// 技能等级
+const (
+	SkillTrainee = 1 // 学徒
+	SkillSkilled = 2 // 熟练
+	SkillMaster  = 3 // 师傅，可带徒弟
+)
+
+// WorkerStation 工人可上岗的工位及技能等级；工人没有分配记录时只能在默认工位扫码
+type WorkerStation struct {
+	gorm.Model
+	WorkerID  uint   `json:"worker_id" gorm:"uniqueIndex:idx_worker_station"`
+	Station   string `json:"station" gorm:"uniqueIndex:idx_worker_station;size:50"`
+	StationID uint   `json:"station_id" gorm:"index"`
+	Skill     int    `json:"skill"` // 1 学徒 2 熟练 3 师傅
+	Remark    string `json:"remark"`
 }
@@ -0,0 +1,174 @@
+package printing
+
+import (
+	"bytes"
+	"strings"
+)
+
+// ESC/POS 指令
+var (
+	escInit        = []byte{0x1B, 0x40}       // 初始化
+	escChinese     = []byte{0x1C, 0x26}       // 进入汉字模式
+	escAlignLeft   = []byte{0x1B, 0x61, 0x00} // 左对齐
+	escAlignCenter = []byte{0x1B, 0x61, 0x01} // 居中
+	escSizeNormal  = []byte{0x1D, 0x21, 0x00}
+	escSizeDouble  = []byte{0x1D, 0x21, 0x11}                   // 倍宽倍高
+	escFeedCut     = []byte{0x1B, 0x64, 0x04, 0x1D, 0x56, 0x01} // 走纸 4 行后半切
+)
+
+// escposWriter 按 GBK 编码写入文字
+type escposWriter struct {
+	buf  bytes.Buffer
+	cols int // 每行半角字符数
+	err  error
+}
+
+func newESCPOS(m Media) *escposWriter {
+	w := &escposWriter{cols: 32}
+	if m.WidthMM >= 72 {
+		w.cols = 48
+	}
+	return w
+}
+
+func (w *escposWriter) raw(b []byte) {
+	w.buf.Write(b)
+}
+
+func (w *escposWriter) line(s string) {
+	data, err := toGBK(s)
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	w.buf.Write(data)
+	w.buf.WriteByte('\n')
+}
+
+// wrapped 超出一行的文字自动换行
+func (w *escposWriter) wrapped(s string, cols int) {
+	for _, line := range wrapText(s, cols) {
+		w.line(line)
+	}
+}
+
+// columns 左右两端对齐
+func (w *escposWriter) columns(left, right string) {
+	space := w.cols - textWidth(left) - textWidth(right)
+	if space < 1 {
+		w.line(left)
+		w.line(strings.Repeat(" ", maxInt(w.cols-textWidth(right), 0)) + right)
+		return
+	}
+	w.line(left + strings.Repeat(" ", space) + right)
+}
+
+func (w *escposWriter) separator() {
+	w.line(strings.Repeat("-", w.cols))
+}
+
+// title 倍宽倍高居中标题
+func (w *escposWriter) title(s string) {
+	w.raw(escAlignCenter)
+	w.raw(escSizeDouble)
+	w.wrapped(s, w.cols/2)
+	w.raw(escSizeNormal)
+	w.raw(escAlignLeft)
+}
+
+// qrcode 居中打印二维码（GS ( k，模型 2，纠错等级 M）
+func (w *escposWriter) qrcode(data string, module byte) {
+	if data == "" {
+		return
+	}
+	w.raw(escAlignCenter)
+	w.raw([]byte{0x1D, 0x28, 0x6B, 0x04, 0x00, 0x31, 0x41, 0x32, 0x00})
+	w.raw([]byte{0x1D, 0x28, 0x6B, 0x03, 0x00, 0x31, 0x43, module})
+	w.raw([]byte{0x1D, 0x28, 0x6B, 0x03, 0x00, 0x31, 0x45, 0x31})
+	n := len(data) + 3
+	w.raw([]byte{0x1D, 0x28, 0x6B, byte(n), byte(n >> 8), 0x31, 0x50, 0x30})
+	w.raw([]byte(data))
+	w.raw([]byte{0x1D, 0x28, 0x6B, 0x03, 0x00, 0x31, 0x51, 0x30})
+	w.buf.WriteByte('\n')
+	w.raw(escAlignLeft)
+}
+
+func (w *escposWriter) centered(lines []string) {
+	w.raw(escAlignCenter)
+	for _, s := range lines {
+		w.wrapped(s, w.cols)
+	}
+	w.raw(escAlignLeft)
+}
+
+func (w *escposWriter) begin() {
+	w.raw(escInit)
+	w.raw(escChinese)
+}
+
+func (w *escposWriter) end() {
+	w.raw(escFeedCut)
+}
+
+// escposLabels 小票机打印标签：内容与标签相同，逐张切纸
+func escposLabels(m Media, labels []Label, copies int) ([]byte, error) {
+	w := newESCPOS(m)
+	for _, l := range labels {
+		for i := 0; i < copies; i++ {
+			w.begin()
+			if l.Title != "" {
+				w.title(l.Title)
+				w.separator()
+			}
+			for _, f := range l.Fields {
+				if f[1] != "" {
+					w.wrapped(f[0]+" "+f[1], w.cols)
+				}
+			}
+			for _, line := range l.Lines {
+				w.wrapped(line, w.cols)
+			}
+			w.qrcode(l.QRCode, 8)
+			w.centered(l.Footer)
+			w.end()
+		}
+	}
+	return w.buf.Bytes(), w.err
+}
+
+// escposReceipt 生成小票：标题、订单信息、明细、合计和二维码
+func escposReceipt(m Media, r Receipt, copies int) ([]byte, error) {
+	w := newESCPOS(m)
+	for i := 0; i < copies; i++ {
+		w.begin()
+		w.title(r.Title)
+		for _, s := range r.Header {
+			w.wrapped(s, w.cols)
+		}
+		w.separator()
+		for _, item := range r.Items {
+			w.wrapped(item.Name, w.cols)
+			if item.Detail != "" {
+				w.wrapped("  "+item.Detail, w.cols)
+			}
+			w.columns("  "+item.Qty, item.Amount)
+		}
+		w.separator()
+		for _, t := range r.Totals {
+			w.columns(t[0], t[1])
+		}
+		if len(r.Footer) > 0 {
+			w.separator()
+			w.centered(r.Footer)
+		}
+		w.qrcode(r.QRCode, 6)
+		w.end()
+	}
+	return w.buf.Bytes(), w.err
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,108 @@
+package printing
+
+import "strings"
+
+// 标签排版元素
+const (
+	itemText = iota
+	itemLine
+	itemQR
+)
+
+// labelItem 标签上已定位的元素，坐标单位为打印点
+type labelItem struct {
+	kind int
+	x, y int
+	w    int // 横线长度
+	size int // 字高、横线粗细或二维码模块大小
+	text string
+}
+
+// qrModules 二维码（版本 2 加边距）约占的模块数，用于估算模块大小
+const qrModules = 29
+
+// layoutLabel 标签排版：标题居中，字段和明细在左侧，二维码在右上，底部居中显示订单号等。
+// ZPL 和 TSPL 共用同一排版，文字按字高的一半估算半角字符宽度。
+func layoutLabel(m Media, l Label) []labelItem {
+	W, H := m.dots(m.WidthMM), m.dots(m.HeightMM)
+	margin, gap := m.dots(2), m.dots(1)
+	titleH, fieldH, lineH := m.dots(5), m.dots(3.5), m.dots(3)
+
+	var items []labelItem
+	addText := func(x, y, h int, text string) {
+		items = append(items, labelItem{kind: itemText, x: x, y: y, size: h, text: text})
+	}
+	center := func(y, h int, text string) {
+		x := (W - textWidth(text)*h/2) / 2
+		if x < margin {
+			x = margin
+		}
+		addText(x, y, h, text)
+	}
+
+	y := margin
+	if l.Title != "" {
+		center(y, titleH, l.Title)
+		y += titleH + gap
+		items = append(items, labelItem{kind: itemLine, x: margin, y: y, w: W - 2*margin, size: 2})
+		y += 2 + gap
+	}
+
+	// 底部文字
+	footerTop := H - margin - len(l.Footer)*(lineH+gap)
+	for i, text := range l.Footer {
+		center(footerTop+i*(lineH+gap), lineH, text)
+	}
+
+	// 右上二维码，空间不足时缩小
+	qrBottom, textRight := y, W-margin
+	if l.QRCode != "" {
+		size := m.dots(24)
+		if space := footerTop - gap - y; space < size {
+			size = space
+		}
+		if mag := size / qrModules; mag >= 1 {
+			size = mag * qrModules
+			qrX := W - margin - size
+			items = append(items, labelItem{kind: itemQR, x: qrX, y: y, size: mag, text: l.QRCode})
+			qrBottom, textRight = y+size, qrX-gap
+		}
+	}
+
+	// 字段和明细：二维码旁边的宽度较窄，之后为整行；放不下的内容省略
+	write := func(text string, h int) bool {
+		for _, part := range strings.Split(text, "\n") {
+			runes := []rune(part)
+			for {
+				if y+h > footerTop-gap {
+					return false
+				}
+				right := W - margin
+				if y < qrBottom {
+					right = textRight
+				}
+				n := fitRunes(runes, (right-margin)*2/h)
+				addText(margin, y, h, string(runes[:n]))
+				y += h + gap
+				if runes = runes[n:]; len(runes) == 0 {
+					break
+				}
+			}
+		}
+		return true
+	}
+	for _, f := range l.Fields {
+		if f[1] == "" {
+			continue
+		}
+		if !write(f[0]+" "+f[1], fieldH) {
+			return items
+		}
+	}
+	for _, line := range l.Lines {
+		if !write(line, lineH) {
+			return items
+		}
+	}
+	return items
+}
@@ -0,0 +1,185 @@
+// Package printing 生成热敏打印机指令（ZPL/TSPL 标签、ESC/POS 小票），并通过 9100 端口直接发送到打印机
+package printing
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// 打印机指令集
+const (
+	ProtocolZPL    = "zpl"    // 斑马等标签机
+	ProtocolTSPL   = "tspl"   // TSC、佳博等标签机
+	ProtocolESCPOS = "escpos" // 小票机
+)
+
+// DefaultPort 打印机 RAW 端口
+const DefaultPort = 9100
+
+// IsLabelProtocol 是否为标签机指令集
+func IsLabelProtocol(protocol string) bool {
+	return protocol == ProtocolZPL || protocol == ProtocolTSPL
+}
+
+// Valid 是否为支持的指令集
+func Valid(protocol string) bool {
+	return IsLabelProtocol(protocol) || protocol == ProtocolESCPOS
+}
+
+// Media 纸张规格
+type Media struct {
+	WidthMM  float64 // 标签或小票纸宽度
+	HeightMM float64 // 标签高度，小票机不用
+	DPI      int     // 打印精度，常见 203 / 300
+	Font     string  // ZPL 中文字体，如 E:SIMSUN.TTF
+}
+
+// 未配置时的默认纸张
+const (
+	defaultWidthMM  = 80
+	defaultHeightMM = 60
+	defaultDPI      = 203
+	defaultZPLFont  = "E:SIMSUN.TTF"
+)
+
+func (m Media) withDefaults() Media {
+	if m.WidthMM <= 0 {
+		m.WidthMM = defaultWidthMM
+	}
+	if m.HeightMM <= 0 {
+		m.HeightMM = defaultHeightMM
+	}
+	if m.DPI <= 0 {
+		m.DPI = defaultDPI
+	}
+	if m.Font == "" {
+		m.Font = defaultZPLFont
+	}
+	return m
+}
+
+// dots 毫米换算为打印点数
+func (m Media) dots(mm float64) int {
+	return int(mm * float64(m.DPI) / 25.4)
+}
+
+// Label 一张标签：标题、字段、明细、二维码和底部文字
+type Label struct {
+	Title  string
+	Fields [][2]string // 名称-内容，如 客户-张三
+	Lines  []string    // 产品明细
+	QRCode string
+	Footer []string
+}
+
+// Receipt 一张小票
+type Receipt struct {
+	Title  string
+	Header []string // 订单号、客户等
+	Items  []ReceiptItem
+	Totals [][2]string // 名称-金额，右对齐
+	Footer []string
+	QRCode string
+}
+
+// ReceiptItem 小票明细行
+type ReceiptItem struct {
+	Name   string
+	Detail string // 规格、属性
+	Qty    string // 如 2 块 × 350.00
+	Amount string
+}
+
+// EncodeLabels 按打印机指令集生成标签打印数据
+func EncodeLabels(protocol string, media Media, labels []Label, copies int) ([]byte, error) {
+	if copies <= 0 {
+		copies = 1
+	}
+	media = media.withDefaults()
+	switch protocol {
+	case ProtocolZPL:
+		return zplLabels(media, labels, copies), nil
+	case ProtocolTSPL:
+		return tsplLabels(media, labels, copies)
+	case ProtocolESCPOS:
+		return escposLabels(media, labels, copies)
+	}
+	return nil, fmt.Errorf("不支持的打印指令: %s", protocol)
+}
+
+// EncodeReceipt 生成 ESC/POS 小票打印数据
+func EncodeReceipt(media Media, receipt Receipt, copies int) ([]byte, error) {
+	if copies <= 0 {
+		copies = 1
+	}
+	return escposReceipt(media.withDefaults(), receipt, copies)
+}
+
+// Send 通过 RAW 端口（默认 9100）发送打印数据
+func Send(ctx context.Context, host string, port int, data []byte) error {
+	if port <= 0 {
+		port = DefaultPort
+	}
+	dialer := net.Dialer{Timeout: 5 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, fmt.Sprint(port)))
+	if err != nil {
+		return fmt.Errorf("连接打印机失败: %w", err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(30 * time.Second)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+	if _, err := conn.Write(data); err != nil {
+		return fmt.Errorf("发送打印数据失败: %w", err)
+	}
+	return nil
+}
+
+// textWidth 文字显示宽度：中文等全角字符为 2，其余为 1
+func textWidth(s string) int {
+	w := 0
+	for _, r := range s {
+		w += runeWidth(r)
+	}
+	return w
+}
+
+func runeWidth(r rune) int {
+	if r >= 0x2E80 {
+		return 2
+	}
+	return 1
+}
+
+// fitRunes 一行最多能放下的字符数（max 为半角字符数），至少为 1
+func fitRunes(runes []rune, max int) int {
+	w := 0
+	for i, r := range runes {
+		if w += runeWidth(r); w > max && i > 0 {
+			return i
+		}
+	}
+	return len(runes)
+}
+
+// wrapText 按显示宽度换行，max 为半角字符数
+func wrapText(s string, max int) []string {
+	var lines []string
+	for _, part := range strings.Split(s, "\n") {
+		runes := []rune(part)
+		for {
+			n := fitRunes(runes, max)
+			lines = append(lines, string(runes[:n]))
+			if runes = runes[n:]; len(runes) == 0 {
+				break
+			}
+		}
+	}
+	return lines
+}
@@ -0,0 +1,52 @@
+package printing
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// tsplFont 标签机内置的 24 点阵简体中文字体，放大倍数为整数
+const (
+	tsplFont     = "TSS24.BF2"
+	tsplFontSize = 24
+)
+
+// toGBK 国产打印机中文需为 GBK 编码，无法编码的字符替换为 ?
+func toGBK(s string) ([]byte, error) {
+	return encoding.ReplaceUnsupported(simplifiedchinese.GBK.NewEncoder()).Bytes([]byte(s))
+}
+
+// tsplLabels 生成 TSPL 标签，整段指令按 GBK 编码
+func tsplLabels(m Media, labels []Label, copies int) ([]byte, error) {
+	quote := strings.NewReplacer(`"`, `\["]`)
+	var b strings.Builder
+	fmt.Fprintf(&b, "SIZE %s mm,%s mm\r\n", mmString(m.WidthMM), mmString(m.HeightMM))
+	b.WriteString("GAP 2 mm,0 mm\r\nDIRECTION 1\r\n")
+	for _, l := range labels {
+		b.WriteString("CLS\r\n")
+		for _, it := range layoutLabel(m, l) {
+			switch it.kind {
+			case itemText:
+				// 向下取整，避免放大后超出排版位置
+				mul := it.size / tsplFontSize
+				if mul < 1 {
+					mul = 1
+				}
+				fmt.Fprintf(&b, "TEXT %d,%d,\"%s\",0,%d,%d,\"%s\"\r\n", it.x, it.y, tsplFont, mul, mul, quote.Replace(it.text))
+			case itemLine:
+				fmt.Fprintf(&b, "BAR %d,%d,%d,%d\r\n", it.x, it.y, it.w, it.size)
+			case itemQR:
+				fmt.Fprintf(&b, "QRCODE %d,%d,M,%d,A,0,\"%s\"\r\n", it.x, it.y, it.size, quote.Replace(it.text))
+			}
+		}
+		fmt.Fprintf(&b, "PRINT 1,%d\r\n", copies)
+	}
+	return toGBK(b.String())
+}
+
+func mmString(mm float64) string {
+	return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.1f", mm), "0"), ".")
+}
@@ -0,0 +1,31 @@
+package printing
+
+import (
+	"fmt"
+	"strings"
+)
+
+// zplEscape 字段数据中的 ^ ~ _ 需用 ^FH 十六进制转义
+var zplEscape = strings.NewReplacer("_", "_5F", "^", "_5E", "~", "_7E")
+
+// zplLabels 生成 ZPL 标签，文字使用 UTF-8（^CI28）和打印机上的中文字体
+func zplLabels(m Media, labels []Label, copies int) []byte {
+	var b strings.Builder
+	for _, l := range labels {
+		b.WriteString("^XA\n^CI28\n")
+		fmt.Fprintf(&b, "^PW%d\n^LL%d\n", m.dots(m.WidthMM), m.dots(m.HeightMM))
+		fmt.Fprintf(&b, "^CW1,%s\n", m.Font)
+		for _, it := range layoutLabel(m, l) {
+			switch it.kind {
+			case itemText:
+				fmt.Fprintf(&b, "^FO%d,%d^A1N,%d,%d^FH^FD%s^FS\n", it.x, it.y, it.size, it.size, zplEscape.Replace(it.text))
+			case itemLine:
+				fmt.Fprintf(&b, "^FO%d,%d^GB%d,%d,%d^FS\n", it.x, it.y, it.w, it.size, it.size)
+			case itemQR:
+				fmt.Fprintf(&b, "^FO%d,%d^BQN,2,%d^FH^FDQA,%s^FS\n", it.x, it.y, it.size, zplEscape.Replace(it.text))
+			}
+		}
+		fmt.Fprintf(&b, "^PQ%d\n^XZ\n", copies)
+	}
+	return []byte(b.String())
+}
@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCleanKey(t *testing.T) {
+	cases := map[string]string{
+		"a.jpg":               "a.jpg",
+		"/a.jpg":              "a.jpg",
+		"thumbs/a_200.jpg":    "thumbs/a_200.jpg",
+		"../../etc/passwd":    "etc/passwd",
+		"thumbs/../../secret": "secret",
+	}
+	for in, want := range cases {
+		got, err := CleanKey(in)
+		if err != nil || got != want {
+			t.Errorf("CleanKey(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "/", "..", "/../"} {
+		if _, err := CleanKey(in); !errors.Is(err, ErrNotFound) {
+			t.Errorf("CleanKey(%q) err = %v; want ErrNotFound", in, err)
+		}
+	}
+}
+
+func TestLocalPutOpenStatDelete(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	l := NewLocal(dir, "secret")
+
+	data := "\x89PNG\r\n\x1a\n0000"
+	if err := l.Put(ctx, "thumbs/a.png", strings.NewReader(data), int64(len(data)), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "thumbs", "a.png")); err != nil {
+		t.Fatalf("file not written: %v", err)
+	}
+
+	obj, err := l.Stat(ctx, "thumbs/a.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.Size != int64(len(data)) || obj.ContentType != "image/png" {
+		t.Errorf("Stat = %+v", obj)
+	}
+
+	r, err := l.Open(ctx, "/thumbs/a.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(r)
+	r.Close()
+	if string(got) != data {
+		t.Errorf("Open read %q", got)
+	}
+
+	if err := l.Delete(ctx, "thumbs/a.png"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Stat(ctx, "thumbs/a.png"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat after delete err = %v", err)
+	}
+	if _, err := l.Open(ctx, "thumbs/a.png"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Open after delete err = %v", err)
+	}
+	// 删除不存在的文件不报错
+	if err := l.Delete(ctx, "thumbs/a.png"); err != nil {
+		t.Errorf("Delete missing err = %v", err)
+	}
+	// 目录不算文件
+	if _, err := l.Stat(ctx, "thumbs"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat dir err = %v", err)
+	}
+}
+
+func TestLocalPutStaysInDir(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	dir := filepath.Join(root, "uploads")
+	l := NewLocal(dir, "secret")
+
+	if err := l.Put(ctx, "../escape.txt", strings.NewReader("x"), 1, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "escape.txt")); err == nil {
+		t.Fatal("file written outside storage dir")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escape.txt")); err != nil {
+		t.Fatalf("file not written inside storage dir: %v", err)
+	}
+}
+
+func TestLocalList(t *testing.T) {
+	ctx := context.Background()
+	l := NewLocal(t.TempDir(), "secret")
+	for _, key := range []string{"a.jpg", "b.pdf", "thumbs/a_200.jpg"} {
+		if err := l.Put(ctx, key, strings.NewReader(key), int64(len(key)), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 临时文件不列出
+	os.WriteFile(filepath.Join(l.Dir, ".upload-123"), []byte("x"), 0644)
+
+	var all, thumbs []string
+	l.List(ctx, "", func(o Object) error { all = append(all, o.Key); return nil })
+	l.List(ctx, "thumbs/", func(o Object) error { thumbs = append(thumbs, o.Key); return nil })
+	if strings.Join(all, ",") != "a.jpg,b.pdf,thumbs/a_200.jpg" {
+		t.Errorf("List all = %v", all)
+	}
+	if strings.Join(thumbs, ",") != "thumbs/a_200.jpg" {
+		t.Errorf("List thumbs = %v", thumbs)
+	}
+
+	// 目录不存在时为空
+	missing := NewLocal(filepath.Join(t.TempDir(), "none"), "secret")
+	if err := missing.List(ctx, "", func(Object) error { t.Error("unexpected object"); return nil }); err != nil {
+		t.Errorf("List missing dir err = %v", err)
+	}
+
+	// 回调出错时中止
+	stop := errors.New("stop")
+	if err := l.List(ctx, "", func(Object) error { return stop }); !errors.Is(err, stop) {
+		t.Errorf("List err = %v; want stop", err)
+	}
+}
+
+func TestLocalSignedURL(t *testing.T) {
+	ctx := context.Background()
+	l := NewLocal(t.TempDir(), "secret")
+
+	signed, err := l.SignedURL(ctx, "/thumbs/a.jpg", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Path != "/uploads/thumbs/a.jpg" {
+		t.Errorf("path = %q", u.Path)
+	}
+	expires, signature := u.Query().Get("expires"), u.Query().Get("signature")
+	if !l.VerifySignature("thumbs/a.jpg", expires, signature) {
+		t.Error("valid signature rejected")
+	}
+	if l.VerifySignature("thumbs/b.jpg", expires, signature) {
+		t.Error("signature accepted for another key")
+	}
+	if l.VerifySignature("thumbs/a.jpg", expires+"0", signature) {
+		t.Error("signature accepted with changed expiry")
+	}
+	if NewLocal(l.Dir, "other").VerifySignature("thumbs/a.jpg", expires, signature) {
+		t.Error("signature accepted with another secret")
+	}
+
+	expired, _ := l.SignedURL(ctx, "a.jpg", -time.Minute)
+	u, _ = url.Parse(expired)
+	if l.VerifySignature("a.jpg", u.Query().Get("expires"), u.Query().Get("signature")) {
+		t.Error("expired signature accepted")
+	}
+	if l.VerifySignature("a.jpg", "abc", "") {
+		t.Error("malformed expiry accepted")
+	}
+}
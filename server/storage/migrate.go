@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"log"
+)
+
+// MigrateResult 迁移结果
+type MigrateResult struct {
+	Copied  int
+	Skipped int // 目标中已存在且大小一致
+	Failed  int
+	Bytes   int64
+}
+
+// Migrate 将 src 中的全部文件复制到 dst，目标中已存在且大小一致的跳过。
+// removeSource 为 true 时复制成功后删除源文件；dryRun 只统计不复制。
+func Migrate(ctx context.Context, src, dst Storage, removeSource, dryRun bool) (MigrateResult, error) {
+	var result MigrateResult
+	err := src.List(ctx, "", func(obj Object) error {
+		if existing, err := dst.Stat(ctx, obj.Key); err == nil && existing.Size == obj.Size {
+			result.Skipped++
+			if removeSource && !dryRun {
+				removeSourceObject(ctx, src, obj.Key)
+			}
+			return nil
+		} else if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		if dryRun {
+			result.Copied++
+			result.Bytes += obj.Size
+			return nil
+		}
+
+		if err := copyObject(ctx, src, dst, obj); err != nil {
+			log.Printf("Failed to migrate %s: %v\n", obj.Key, err)
+			result.Failed++
+			return nil
+		}
+		result.Copied++
+		result.Bytes += obj.Size
+		if removeSource {
+			removeSourceObject(ctx, src, obj.Key)
+		}
+		return nil
+	})
+	return result, err
+}
+
+func removeSourceObject(ctx context.Context, src Storage, key string) {
+	if err := src.Delete(ctx, key); err != nil {
+		log.Printf("Failed to remove %s from source: %v\n", key, err)
+	}
+}
+
+func copyObject(ctx context.Context, src, dst Storage, obj Object) error {
+	if obj.ContentType == "" {
+		if info, err := src.Stat(ctx, obj.Key); err == nil {
+			obj.ContentType = info.ContentType
+		}
+	}
+	r, err := src.Open(ctx, obj.Key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return dst.Put(ctx, obj.Key, r, obj.Size, obj.ContentType)
+}
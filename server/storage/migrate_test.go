@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func putAll(t *testing.T, s Storage, files map[string]string) {
+	t.Helper()
+	for key, data := range files {
+		if err := s.Put(context.Background(), key, strings.NewReader(data), int64(len(data)), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readAll(t *testing.T, s Storage, key string) string {
+	t.Helper()
+	r, err := s.Open(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Open(%q): %v", key, err)
+	}
+	defer r.Close()
+	data, _ := io.ReadAll(r)
+	return string(data)
+}
+
+func TestMigrateLocalToS3(t *testing.T) {
+	ctx := context.Background()
+	src := NewLocal(t.TempDir(), "secret")
+	dst := newTestS3(t, "uploads")
+	putAll(t, src, map[string]string{
+		"a.png":            "\x89PNG\r\n\x1a\n0000",
+		"b.pdf":            "%PDF-1.4",
+		"thumbs/a_200.jpg": "thumb",
+	})
+	// 目标中已有同样大小的文件跳过
+	putAll(t, dst, map[string]string{"b.pdf": "%PDF-1.4"})
+
+	dry, err := Migrate(ctx, src, dst, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dry.Copied != 2 || dry.Skipped != 1 || dry.Failed != 0 {
+		t.Errorf("dry run = %+v", dry)
+	}
+	if _, err := dst.Stat(ctx, "a.png"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("dry run copied a.png: %v", err)
+	}
+
+	result, err := Migrate(ctx, src, dst, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Copied != 2 || result.Skipped != 1 || result.Bytes != int64(len("\x89PNG\r\n\x1a\n0000")+len("thumb")) {
+		t.Errorf("migrate = %+v", result)
+	}
+	if got := readAll(t, dst, "thumbs/a_200.jpg"); got != "thumb" {
+		t.Errorf("thumbs/a_200.jpg = %q", got)
+	}
+	// 本地文件没有记录类型，按内容识别后写入
+	if obj, _ := dst.Stat(ctx, "a.png"); obj.ContentType != "image/png" {
+		t.Errorf("a.png content type = %q", obj.ContentType)
+	}
+	// 未要求删除时保留源文件
+	if _, err := src.Stat(ctx, "a.png"); err != nil {
+		t.Errorf("source removed: %v", err)
+	}
+
+	// 再次迁移全部跳过
+	again, err := Migrate(ctx, src, dst, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Copied != 0 || again.Skipped != 3 {
+		t.Errorf("second migrate = %+v", again)
+	}
+}
+
+func TestMigrateS3ToLocalRemoveSource(t *testing.T) {
+	ctx := context.Background()
+	src := newTestS3(t, "")
+	dst := NewLocal(t.TempDir(), "secret")
+	putAll(t, src, map[string]string{"a.jpg": "aaa", "thumbs/a_200.jpg": "t"})
+	// 目标中大小不同的文件会被覆盖
+	putAll(t, dst, map[string]string{"a.jpg": "old content"})
+
+	result, err := Migrate(ctx, src, dst, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Copied != 2 || result.Skipped != 0 || result.Failed != 0 {
+		t.Errorf("migrate = %+v", result)
+	}
+	if got := readAll(t, dst, "a.jpg"); got != "aaa" {
+		t.Errorf("a.jpg = %q", got)
+	}
+	var left []string
+	src.List(ctx, "", func(o Object) error { left = append(left, o.Key); return nil })
+	if len(left) != 0 {
+		t.Errorf("source not removed: %v", left)
+	}
+}
+
+func TestMigrateRemoveSourceDryRunKeepsFiles(t *testing.T) {
+	ctx := context.Background()
+	src := NewLocal(t.TempDir(), "secret")
+	dst := NewLocal(t.TempDir(), "secret")
+	putAll(t, src, map[string]string{"a.jpg": "a"})
+	putAll(t, dst, map[string]string{"a.jpg": "a"})
+
+	result, err := Migrate(ctx, src, dst, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Skipped != 1 {
+		t.Errorf("dry run = %+v", result)
+	}
+	if _, err := src.Stat(ctx, "a.jpg"); err != nil {
+		t.Errorf("dry run removed source: %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	"github.com/minio/minio-go/v7"
+)
+
+const testBucket = "trace"
+
+// newTestS3 启动内存中的 S3 兼容服务（代替 MinIO），返回连接到它的存储
+func newTestS3(t *testing.T, prefix string) *S3 {
+	t.Helper()
+	backend := s3mem.New()
+	if err := backend.CreateBucket(testBucket); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(gofakes3.New(backend).Server())
+	t.Cleanup(srv.Close)
+
+	s, err := NewS3(S3Options{
+		Endpoint:  strings.TrimPrefix(srv.URL, "http://"),
+		Region:    "us-east-1",
+		Bucket:    testBucket,
+		AccessKey: "test",
+		SecretKey: "test-secret",
+		Prefix:    prefix,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestNewS3RequiresEndpointAndBucket(t *testing.T) {
+	if _, err := NewS3(S3Options{Bucket: "b"}); err == nil {
+		t.Error("missing endpoint accepted")
+	}
+	if _, err := NewS3(S3Options{Endpoint: "127.0.0.1:9000"}); err == nil {
+		t.Error("missing bucket accepted")
+	}
+}
+
+func TestS3PutOpenStatDelete(t *testing.T) {
+	ctx := context.Background()
+	s := newTestS3(t, "/uploads/")
+
+	data := "hello"
+	if err := s.Put(ctx, "/thumbs/a.jpg", strings.NewReader(data), int64(len(data)), "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+
+	obj, err := s.Stat(ctx, "thumbs/a.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.Key != "thumbs/a.jpg" || obj.Size != int64(len(data)) || obj.ContentType != "image/jpeg" {
+		t.Errorf("Stat = %+v", obj)
+	}
+
+	r, err := s.Open(ctx, "thumbs/a.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(r)
+	r.Close()
+	if string(got) != data {
+		t.Errorf("Open read %q", got)
+	}
+
+	// 对象名带前缀
+	if _, err := s.client.StatObject(ctx, testBucket, "uploads/thumbs/a.jpg", minio.StatObjectOptions{}); err != nil {
+		t.Errorf("object not stored under prefix: %v", err)
+	}
+
+	if err := s.Delete(ctx, "thumbs/a.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Stat(ctx, "thumbs/a.jpg"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat after delete err = %v", err)
+	}
+	if _, err := s.Open(ctx, "thumbs/a.jpg"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Open after delete err = %v", err)
+	}
+	if err := s.Delete(ctx, "thumbs/a.jpg"); err != nil {
+		t.Errorf("Delete missing err = %v", err)
+	}
+	if _, err := s.Stat(ctx, "/"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat empty key err = %v", err)
+	}
+}
+
+func TestS3List(t *testing.T) {
+	ctx := context.Background()
+	s := newTestS3(t, "uploads")
+	for _, key := range []string{"a.jpg", "b.pdf", "thumbs/a_200.jpg"} {
+		if err := s.Put(ctx, key, strings.NewReader(key), int64(len(key)), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 前缀之外的对象不列出
+	other := &S3{client: s.client, bucket: s.bucket, prefix: "other/"}
+	other.Put(ctx, "c.jpg", strings.NewReader("c"), 1, "")
+
+	var all, thumbs []string
+	if err := s.List(ctx, "", func(o Object) error { all = append(all, o.Key); return nil }); err != nil {
+		t.Fatal(err)
+	}
+	s.List(ctx, "thumbs/", func(o Object) error { thumbs = append(thumbs, o.Key); return nil })
+	if strings.Join(all, ",") != "a.jpg,b.pdf,thumbs/a_200.jpg" {
+		t.Errorf("List all = %v", all)
+	}
+	if strings.Join(thumbs, ",") != "thumbs/a_200.jpg" {
+		t.Errorf("List thumbs = %v", thumbs)
+	}
+}
+
+func TestS3SignedURL(t *testing.T) {
+	ctx := context.Background()
+	s := newTestS3(t, "uploads")
+	s.Put(ctx, "a.jpg", strings.NewReader("img"), 3, "image/jpeg")
+
+	signed, err := s.SignedURL(ctx, "a.jpg", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(signed, "/"+testBucket+"/uploads/a.jpg") || !strings.Contains(signed, "X-Amz-Signature=") {
+		t.Errorf("SignedURL = %q", signed)
+	}
+	resp, err := http.Get(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "img" {
+		t.Errorf("GET signed url = %d %q", resp.StatusCode, body)
+	}
+
+	if _, err := s.SignedURL(ctx, "", time.Minute); err == nil {
+		t.Error("empty key accepted")
+	}
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strings"
+	"time"
+	"trace-server/config"
+)
+
+// 存储后端
+const (
+	DriverLocal = "local"
+	DriverS3    = "s3"
+)
+
+const defaultLocalDir = "./uploads"
+
+// ErrNotFound 文件不存在
+var ErrNotFound = errors.New("file not found")
+
+// Object 存储中的文件信息
+type Object struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// Storage 文件存储后端。key 为相对路径，如 "123.jpg"、"thumbs/123_200.jpg"
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Stat(ctx context.Context, key string) (Object, error)
+	Delete(ctx context.Context, key string) error // 文件不存在时不报错
+	List(ctx context.Context, prefix string, fn func(Object) error) error
+	// SignedURL 生成限时下载地址
+	SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
+
+// Current 当前使用的存储后端，默认为本地 ./uploads 目录
+var Current Storage = NewLocal(defaultLocalDir, "")
+
+// Init 按配置初始化存储后端
+func Init() error {
+	s, err := New(config.Current.Storage.Driver)
+	if err != nil {
+		return err
+	}
+	Current = s
+	return nil
+}
+
+// New 按名称创建存储后端，参数取自配置文件 storage 段
+func New(driver string) (Storage, error) {
+	cfg := config.Current.Storage
+	switch driver {
+	case "", DriverLocal:
+		dir := cfg.LocalDir
+		if dir == "" {
+			dir = defaultLocalDir
+		}
+		if cfg.SignSecret == "" {
+			log.Println("storage.sign_secret 未配置，签名链接在服务重启后失效")
+		}
+		return NewLocal(dir, cfg.SignSecret), nil
+	case DriverS3:
+		return NewS3(S3Options{
+			Endpoint:  cfg.S3.Endpoint,
+			Region:    cfg.S3.Region,
+			Bucket:    cfg.S3.Bucket,
+			AccessKey: cfg.S3.AccessKey,
+			SecretKey: cfg.S3.SecretKey,
+			UseSSL:    cfg.S3.UseSSL,
+			Prefix:    cfg.S3.Prefix,
+		})
+	}
+	return nil, fmt.Errorf("unknown storage driver %q", driver)
+}
+
+// CleanKey 规范化文件 key，去掉开头的斜杠并禁止跳出存储目录
+func CleanKey(key string) (string, error) {
+	cleaned := strings.TrimPrefix(path.Clean("/"+key), "/")
+	if cleaned == "" || cleaned == "." {
+		return "", ErrNotFound
+	}
+	return cleaned, nil
+}